@@ -13,6 +13,7 @@ import (
 )
 
 func main() {
+	utils.Init()
 	utils.InitFirebase()
 	zerolog.InitLogger()
 
@@ -31,6 +32,12 @@ func main() {
 
 	routes.Route(app, db)
 
+	utils.StartRevokedTokenSweeper()
+	utils.StartKeyringReloader()
+	utils.StartWebSocketBackplane()
+	utils.StartDriverPresenceMonitor()
+	utils.StartLocationHistoryPurge()
+
 	if err := app.Listen(viper.GetString("BASE_URL")); err != nil {
         panic(err)
     }
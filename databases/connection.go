@@ -18,18 +18,29 @@ import (
 var postgresDB *sqlx.DB
 var mongoClient *mongo.Client
 var once sync.Once
+var configOnce sync.Once
+
+// The .env is read on the first connection, so packages importing this one
+// can be loaded without it, in tests for instance
+func loadConfig() {
+	configOnce.Do(func() {
+		viper.SetConfigFile(".env")
+		err := viper.ReadInConfig()
+		if err != nil {
+			panic(err)
+		}
+	})
+}
 
-func init() {
-	viper.SetConfigFile(".env")
-	err := viper.ReadInConfig()
-	if err != nil {
-		panic(err)
-	}
+// Also used on its own by connections that can't go through the pool, like LISTEN
+func PostgresURI() string {
+	loadConfig()
+	return "postgres://" + viper.GetString("DB_USER") + ":" + viper.GetString("DB_PASSWORD") + "@" + viper.GetString("DB_HOST") + ":" + viper.GetString("DB_PORT") + "/" + viper.GetString("DB_NAME") + "?sslmode=disable"
 }
 
 func PostgresConnection() (*sqlx.DB, error) {
 	once.Do(func() {
-		dbURI := "postgres://" + viper.GetString("DB_USER") + ":" + viper.GetString("DB_PASSWORD") + "@" + viper.GetString("DB_HOST") + ":" + viper.GetString("DB_PORT") + "/" + viper.GetString("DB_NAME") + "?sslmode=disable"
+		dbURI := PostgresURI()
 
 		conn, err := sqlx.Connect("postgres", dbURI)
 		if err != nil {
@@ -64,6 +75,7 @@ func ClosePostgresConnection() error {
 }
 
 func MongoConnection() (*mongo.Client, error) {
+	loadConfig()
 	once.Do(func() {
 		clientOptions := options.Client().ApplyURI(viper.GetString("MONGO_URI"))
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Access tokens are revoked by their jti, and since 000024 by their session
+-- (sid). Tokens issued before these claims existed are rejected by the
+-- authentication middleware, every user has to log in again after upgrading.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_uuid UUID NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expired_at TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (user_uuid) REFERENCES users (user_uuid) ON UPDATE NO ACTION ON DELETE CASCADE
+);
+
+CREATE INDEX idx_revoked_tokens_expired_at ON revoked_tokens (expired_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS revoked_tokens;
+-- +goose StatementEnd
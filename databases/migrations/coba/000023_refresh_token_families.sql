@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE refresh_tokens
+    DROP CONSTRAINT IF EXISTS refresh_tokens_user_uuid_key,
+    DROP CONSTRAINT IF EXISTS unique_user_uuid,
+    ADD COLUMN IF NOT EXISTS family_uuid UUID NULL DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS replaced_by BIGINT NULL DEFAULT NULL;
+
+UPDATE refresh_tokens SET family_uuid = gen_random_uuid() WHERE family_uuid IS NULL;
+
+ALTER TABLE refresh_tokens ALTER COLUMN family_uuid SET NOT NULL;
+
+CREATE INDEX idx_refresh_tokens_user_uuid ON refresh_tokens (user_uuid);
+CREATE INDEX idx_refresh_tokens_family_uuid ON refresh_tokens (family_uuid);
+CREATE UNIQUE INDEX idx_refresh_tokens_refresh_token ON refresh_tokens (refresh_token);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_refresh_tokens_refresh_token;
+DROP INDEX IF EXISTS idx_refresh_tokens_family_uuid;
+DROP INDEX IF EXISTS idx_refresh_tokens_user_uuid;
+
+DELETE FROM refresh_tokens rt
+USING refresh_tokens newer
+WHERE rt.user_uuid = newer.user_uuid AND rt.issued_at < newer.issued_at;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS replaced_by,
+    DROP COLUMN IF EXISTS family_uuid,
+    ADD CONSTRAINT refresh_tokens_user_uuid_key UNIQUE (user_uuid);
+-- +goose StatementEnd
@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_sessions (
+    session_id BIGINT PRIMARY KEY,
+    session_uuid UUID UNIQUE NOT NULL,
+    user_uuid UUID NOT NULL,
+    device_label VARCHAR(100) NULL DEFAULT NULL,
+    user_agent TEXT NULL DEFAULT NULL,
+    ip_address VARCHAR(45) NULL DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMPTZ NULL DEFAULT NULL,
+    revoked_at TIMESTAMPTZ NULL DEFAULT NULL,
+    revoked_by VARCHAR(255) NULL DEFAULT NULL,
+    FOREIGN KEY (user_uuid) REFERENCES users (user_uuid) ON UPDATE NO ACTION ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_sessions_user_uuid ON user_sessions (user_uuid);
+
+-- Every existing refresh token family becomes a session
+INSERT INTO user_sessions (session_id, session_uuid, user_uuid, created_at)
+SELECT DISTINCT ON (family_uuid) id, family_uuid, user_uuid, COALESCE(issued_at, CURRENT_TIMESTAMP)
+FROM refresh_tokens
+ORDER BY family_uuid, issued_at;
+
+ALTER TABLE refresh_tokens
+    ADD CONSTRAINT refresh_tokens_family_uuid_fkey FOREIGN KEY (family_uuid) REFERENCES user_sessions (session_uuid) ON UPDATE NO ACTION ON DELETE CASCADE;
+
+-- Device tokens now belong to a session instead of a user
+ALTER TABLE fcm_tokens
+    DROP CONSTRAINT IF EXISTS fcm_tokens_user_uuid_key,
+    ADD COLUMN IF NOT EXISTS session_uuid UUID NULL DEFAULT NULL,
+    ADD CONSTRAINT fcm_tokens_session_uuid_fkey FOREIGN KEY (session_uuid) REFERENCES user_sessions (session_uuid) ON UPDATE NO ACTION ON DELETE CASCADE;
+
+UPDATE fcm_tokens f
+SET session_uuid = (
+    SELECT s.session_uuid FROM user_sessions s
+    WHERE s.user_uuid = f.user_uuid
+    ORDER BY s.created_at DESC
+    LIMIT 1
+);
+
+CREATE UNIQUE INDEX idx_fcm_tokens_session_uuid ON fcm_tokens (session_uuid);
+CREATE INDEX idx_fcm_tokens_user_uuid ON fcm_tokens (user_uuid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_fcm_tokens_user_uuid;
+DROP INDEX IF EXISTS idx_fcm_tokens_session_uuid;
+
+DELETE FROM fcm_tokens f
+USING fcm_tokens newer
+WHERE f.user_uuid = newer.user_uuid AND f.created_at < newer.created_at;
+
+ALTER TABLE fcm_tokens
+    DROP CONSTRAINT IF EXISTS fcm_tokens_session_uuid_fkey,
+    DROP COLUMN IF EXISTS session_uuid,
+    ADD CONSTRAINT fcm_tokens_user_uuid_key UNIQUE (user_uuid);
+
+ALTER TABLE refresh_tokens DROP CONSTRAINT IF EXISTS refresh_tokens_family_uuid_fkey;
+
+DROP TABLE IF EXISTS user_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS password_reset_codes (
+    id BIGINT PRIMARY KEY,
+    user_uuid UUID NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expired_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ NULL DEFAULT NULL,
+    FOREIGN KEY (user_uuid) REFERENCES users (user_uuid) ON UPDATE NO ACTION ON DELETE CASCADE
+);
+
+CREATE INDEX idx_password_reset_codes_user_uuid ON password_reset_codes (user_uuid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS password_reset_codes;
+-- +goose StatementEnd
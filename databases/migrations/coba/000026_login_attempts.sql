@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGINT PRIMARY KEY,
+    user_uuid UUID NULL DEFAULT NULL,
+    email VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(45) NULL DEFAULT NULL,
+    user_agent TEXT NULL DEFAULT NULL,
+    success BOOLEAN NOT NULL,
+    failure_reason VARCHAR(50) NULL DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_uuid) REFERENCES users (user_uuid) ON UPDATE NO ACTION ON DELETE SET NULL
+);
+
+CREATE INDEX idx_login_attempts_user_uuid ON login_attempts (user_uuid, created_at);
+CREATE INDEX idx_login_attempts_email ON login_attempts (email, created_at);
+CREATE INDEX idx_login_attempts_ip_address ON login_attempts (ip_address, created_at);
+
+-- Failed-attempt counters, keyed by "account:<email>" or "ip:<address>"
+CREATE TABLE IF NOT EXISTS login_throttles (
+    throttle_key VARCHAR(300) PRIMARY KEY,
+    failed_count INT NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMPTZ NULL DEFAULT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_throttles;
+DROP TABLE IF EXISTS login_attempts;
+-- +goose StatementEnd
@@ -0,0 +1,109 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS roles (
+    role_code VARCHAR(5) PRIMARY KEY,
+    role_name VARCHAR(100) NOT NULL,
+    role_description TEXT NULL DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255),
+    updated_at TIMESTAMPTZ NULL DEFAULT NULL,
+    updated_by VARCHAR(255) NULL DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    permission_code VARCHAR(100) PRIMARY KEY,
+    permission_description TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_code VARCHAR(5) NOT NULL,
+    permission_code VARCHAR(100) NOT NULL,
+    PRIMARY KEY (role_code, permission_code),
+    FOREIGN KEY (role_code) REFERENCES roles (role_code) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (permission_code) REFERENCES permissions (permission_code) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+INSERT INTO roles (role_code, role_name, created_by) VALUES
+    ('SA', 'Super Admin', 'system'),
+    ('AS', 'School Admin', 'system'),
+    ('D', 'Driver', 'system'),
+    ('P', 'Parent', 'system');
+
+INSERT INTO permissions (permission_code, permission_description) VALUES
+    ('account:self', 'Manage own profile, password, sessions and device tokens'),
+    ('user:read', 'View users of every school'),
+    ('user:write', 'Create and update users of every school'),
+    ('user:delete', 'Delete users of every school'),
+    ('user:session:manage', 'View sessions of any user and log them out'),
+    ('user:lockout:manage', 'View login history and unlock locked accounts'),
+    ('role:manage', 'Manage roles and their permissions'),
+    ('school:read', 'View schools'),
+    ('school:write', 'Create and update schools'),
+    ('school:delete', 'Delete schools'),
+    ('vehicle:read', 'View vehicles of every school'),
+    ('vehicle:write', 'Create and update vehicles of every school'),
+    ('vehicle:delete', 'Delete vehicles of every school'),
+    ('report:read', 'View shuttle and student statistics'),
+    ('school:student:read', 'View students of the own school'),
+    ('school:student:write', 'Create and update students of the own school'),
+    ('school:student:delete', 'Delete students of the own school'),
+    ('school:driver:read', 'View drivers of the own school'),
+    ('school:driver:write', 'Create and update drivers of the own school'),
+    ('school:driver:delete', 'Delete drivers of the own school'),
+    ('school:vehicle:read', 'View vehicles of the own school'),
+    ('school:vehicle:write', 'Create and update vehicles of the own school'),
+    ('school:vehicle:delete', 'Delete vehicles of the own school'),
+    ('route:read', 'View routes of the own school'),
+    ('route:write', 'Create and update routes of the own school'),
+    ('route:delete', 'Delete routes of the own school'),
+    ('driver:route:read', 'View own assigned routes'),
+    ('driver:distance:read', 'View own driving distance'),
+    ('route:order:update', 'Reorder students on own route'),
+    ('shuttle:read', 'View own shuttle trips'),
+    ('shuttle:write', 'Start shuttle trips'),
+    ('shuttle:status:update', 'Update the status of own shuttle trips'),
+    ('child:read', 'View own children'),
+    ('child:write', 'Update own children'),
+    ('child:shuttle:read', 'Track shuttles of own children');
+
+INSERT INTO role_permissions (role_code, permission_code)
+SELECT 'SA', permission_code FROM permissions
+WHERE permission_code IN (
+    'account:self', 'user:read', 'user:write', 'user:delete', 'user:session:manage', 'user:lockout:manage',
+    'role:manage', 'school:read', 'school:write', 'school:delete', 'vehicle:read', 'vehicle:write',
+    'vehicle:delete', 'report:read'
+);
+
+INSERT INTO role_permissions (role_code, permission_code)
+SELECT 'AS', permission_code FROM permissions
+WHERE permission_code IN (
+    'account:self', 'school:student:read', 'school:student:write', 'school:student:delete',
+    'school:driver:read', 'school:driver:write', 'school:driver:delete', 'school:vehicle:read',
+    'school:vehicle:write', 'school:vehicle:delete', 'route:read', 'route:write', 'route:delete'
+);
+
+INSERT INTO role_permissions (role_code, permission_code)
+SELECT 'D', permission_code FROM permissions
+WHERE permission_code IN (
+    'account:self', 'driver:route:read', 'driver:distance:read', 'route:order:update',
+    'shuttle:read', 'shuttle:write', 'shuttle:status:update'
+);
+
+INSERT INTO role_permissions (role_code, permission_code)
+SELECT 'P', permission_code FROM permissions
+WHERE permission_code IN (
+    'account:self', 'child:read', 'child:write', 'child:shuttle:read'
+);
+
+-- Existing rows are not re-checked, new and updated users must use a known role
+ALTER TABLE users
+    ADD CONSTRAINT users_user_role_code_fkey FOREIGN KEY (user_role_code) REFERENCES roles (role_code) ON UPDATE CASCADE NOT VALID;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_user_role_code_fkey;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
+-- +goose StatementEnd
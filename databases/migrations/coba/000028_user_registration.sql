@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS user_register_status VARCHAR(20) NOT NULL DEFAULT 'APPROVED',
+    ADD COLUMN IF NOT EXISTS register_school_uuid UUID NULL DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS register_reviewed_by VARCHAR(255) NULL DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS register_reviewed_at TIMESTAMPTZ NULL DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS register_review_reason TEXT NULL DEFAULT NULL;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_user_register_status_check CHECK (user_register_status IN ('PENDING', 'APPROVED', 'REJECTED')) NOT VALID,
+    ADD CONSTRAINT users_register_school_uuid_fkey FOREIGN KEY (register_school_uuid) REFERENCES schools (school_uuid) ON UPDATE NO ACTION ON DELETE SET NULL;
+
+CREATE INDEX idx_users_register_status ON users (user_register_status, register_school_uuid);
+
+INSERT INTO permissions (permission_code, permission_description) VALUES
+    ('registration:review', 'Approve or reject driver and school admin registrations'),
+    ('school:registration:review', 'Approve or reject parent registrations for the own school');
+
+INSERT INTO role_permissions (role_code, permission_code) VALUES
+    ('SA', 'registration:review'),
+    ('AS', 'school:registration:review');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE permission_code IN ('registration:review', 'school:registration:review');
+
+DROP INDEX IF EXISTS idx_users_register_status;
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_register_school_uuid_fkey,
+    DROP CONSTRAINT IF EXISTS users_user_register_status_check,
+    DROP COLUMN IF EXISTS register_review_reason,
+    DROP COLUMN IF EXISTS register_reviewed_at,
+    DROP COLUMN IF EXISTS register_reviewed_by,
+    DROP COLUMN IF EXISTS register_school_uuid;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_two_factor (
+    user_uuid UUID PRIMARY KEY,
+    secret TEXT NOT NULL,
+    enabled_at TIMESTAMPTZ NULL DEFAULT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NULL DEFAULT NULL,
+    FOREIGN KEY (user_uuid) REFERENCES users (user_uuid) ON UPDATE NO ACTION ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_uuid UUID NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ NULL DEFAULT NULL,
+    FOREIGN KEY (user_uuid) REFERENCES user_two_factor (user_uuid) ON UPDATE NO ACTION ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_recovery_codes_user_uuid ON user_recovery_codes (user_uuid, code_hash);
+
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS role_two_factor_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+INSERT INTO permissions (permission_code, permission_description) VALUES
+    ('user:two_factor:manage', 'Reset the two-factor authentication of any user');
+
+INSERT INTO role_permissions (role_code, permission_code) VALUES
+    ('SA', 'user:two_factor:manage');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE permission_code = 'user:two_factor:manage';
+
+ALTER TABLE roles DROP COLUMN IF EXISTS role_two_factor_required;
+
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_two_factor;
+-- +goose StatementEnd
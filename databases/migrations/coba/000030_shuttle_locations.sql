@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS shuttle_locations (
+    id BIGINT PRIMARY KEY,
+    shuttle_uuid UUID NOT NULL,
+    driver_uuid UUID NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    speed REAL NULL DEFAULT NULL,
+    heading REAL NULL DEFAULT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (driver_uuid) REFERENCES users (user_uuid) ON UPDATE NO ACTION ON DELETE CASCADE
+);
+
+CREATE INDEX idx_shuttle_locations_shuttle ON shuttle_locations (shuttle_uuid, recorded_at);
+CREATE INDEX idx_shuttle_locations_driver ON shuttle_locations (driver_uuid, recorded_at);
+
+INSERT INTO permissions (permission_code, permission_description) VALUES
+    ('location:history:read', 'Replay the location history of any shuttle or driver'),
+    ('school:location:history:read', 'Replay the location history of shuttles and drivers of the own school');
+
+INSERT INTO role_permissions (role_code, permission_code) VALUES
+    ('SA', 'location:history:read'),
+    ('AS', 'school:location:history:read');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE permission_code IN ('location:history:read', 'school:location:history:read');
+
+DROP TABLE IF EXISTS shuttle_locations;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO permissions (permission_code, permission_description) VALUES
+    ('realtime:metrics:read', 'Read websocket connection, queue and drop metrics');
+
+INSERT INTO role_permissions (role_code, permission_code) VALUES
+    ('SA', 'realtime:metrics:read');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE permission_code = 'realtime:metrics:read';
+-- +goose StatementEnd
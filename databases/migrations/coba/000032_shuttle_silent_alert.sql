@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Set when parents and school admins were told the driver went silent, a
+-- newer ping starts a new silence that is alerted again
+ALTER TABLE shuttle ADD COLUMN silent_alerted_at TIMESTAMPTZ NULL DEFAULT NULL;
+
+CREATE INDEX idx_shuttle_active_trips ON shuttle (status, created_at) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_shuttle_active_trips;
+
+ALTER TABLE shuttle DROP COLUMN IF EXISTS silent_alerted_at;
+-- +goose StatementEnd
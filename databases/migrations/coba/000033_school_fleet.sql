@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO permissions (permission_code, permission_description) VALUES
+    ('school:fleet:read', 'Read the live position and status of every vehicle of the school');
+
+INSERT INTO role_permissions (role_code, permission_code) VALUES
+    ('AS', 'school:fleet:read');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE permission_code = 'school:fleet:read';
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Where the driver sets off in the morning, the depot or their home, in the
+-- same {"latitude": ..., "longitude": ...} format as the pickup points
+ALTER TABLE driver_details ADD COLUMN IF NOT EXISTS user_depot_point JSON NULL DEFAULT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE driver_details DROP COLUMN IF EXISTS user_depot_point;
+-- +goose StatementEnd
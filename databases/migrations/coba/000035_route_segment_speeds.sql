@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Average speed driven between two stops, learned from past trips. Stops are
+-- "student:<student_uuid>" for pickup points and "school:<school_uuid>".
+CREATE TABLE IF NOT EXISTS route_segment_speeds (
+    id BIGINT PRIMARY KEY,
+    from_point VARCHAR(64) NOT NULL,
+    to_point VARCHAR(64) NOT NULL,
+    average_speed REAL NOT NULL,
+    sample_count INTEGER NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (from_point, to_point)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS route_segment_speeds;
+-- +goose StatementEnd
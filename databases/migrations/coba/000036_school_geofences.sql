@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Fences around the pickup points and the school that move a shuttle to its
+-- next status when the bus drives in. In confirm mode the driver is asked
+-- first, in auto mode the status changes right away. Schools without a row
+-- get the defaults in models/entity/school_entity.go.
+CREATE TABLE IF NOT EXISTS school_geofences (
+    school_uuid UUID PRIMARY KEY REFERENCES schools (school_uuid) ON DELETE CASCADE,
+    pickup_radius REAL NOT NULL,
+    school_radius REAL NOT NULL,
+    transition_mode VARCHAR(10) NOT NULL CHECK (transition_mode IN ('auto', 'confirm')),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR(255)
+);
+
+INSERT INTO permissions (permission_code, permission_description) VALUES
+    ('school:geofence:read', 'Read the geofence settings of the school'),
+    ('school:geofence:write', 'Change the geofence settings of the school');
+
+INSERT INTO role_permissions (role_code, permission_code) VALUES
+    ('AS', 'school:geofence:read'),
+    ('AS', 'school:geofence:write');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE permission_code IN ('school:geofence:read', 'school:geofence:write');
+DROP TABLE IF EXISTS school_geofences;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Drivers are linked to their school when the registration is approved.
+-- Applicants that registered before that still carry the school link.
+UPDATE driver_details dd
+SET school_uuid = NULL
+FROM users u
+WHERE u.user_uuid = dd.user_uuid AND u.user_register_status <> 'APPROVED';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE driver_details dd
+SET school_uuid = u.register_school_uuid
+FROM users u
+WHERE u.user_uuid = dd.user_uuid AND u.user_register_status <> 'APPROVED' AND dd.school_uuid IS NULL;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every node refreshes seen_at for the drivers it holds a websocket of. A
+-- driver goes offline once no node has refreshed it for DRIVER_OFFLINE_AFTER,
+-- so closing the connections on one node doesn't matter while another node
+-- still holds one.
+CREATE TABLE IF NOT EXISTS driver_presence (
+    user_uuid UUID PRIMARY KEY REFERENCES users (user_uuid) ON DELETE CASCADE,
+    seen_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_driver_presence_seen_at ON driver_presence (seen_at);
+
+-- Drivers shown online right now are swept like the others
+INSERT INTO driver_presence (user_uuid, seen_at)
+SELECT user_uuid, NOW() FROM users
+WHERE user_role = 'driver' AND user_status IN ('online', 'idle') AND deleted_at IS NULL
+ON CONFLICT (user_uuid) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS driver_presence;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Pings older than SHUTTLE_LOCATION_RETENTION are purged in batches by age,
+-- the other indexes start with the shuttle or the driver and can't serve that
+CREATE INDEX IF NOT EXISTS idx_shuttle_locations_recorded_at ON shuttle_locations (recorded_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_shuttle_locations_recorded_at;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- School admins are linked to their school when the registration is
+-- approved, like the drivers in 000037. Until then the school is empty.
+ALTER TABLE school_admin_details ALTER COLUMN school_uuid DROP NOT NULL;
+
+UPDATE school_admin_details sad
+SET school_uuid = NULL
+FROM users u
+WHERE u.user_uuid = sad.user_uuid AND u.user_register_status <> 'APPROVED';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE school_admin_details sad
+SET school_uuid = u.register_school_uuid
+FROM users u
+WHERE u.user_uuid = sad.user_uuid AND sad.school_uuid IS NULL;
+
+ALTER TABLE school_admin_details ALTER COLUMN school_uuid SET NOT NULL;
+-- +goose StatementEnd
@@ -3,30 +3,48 @@ package handler
 import (
 	"fmt"
 	"log"
+	"math"
+	"shuttle/errors"
 	"shuttle/logger"
 	"shuttle/models/dto"
 	"shuttle/services"
 	"shuttle/utils"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type AuthHandlerInterface interface {
 	Login(c *fiber.Ctx) error
+	LoginTwoFactor(c *fiber.Ctx) error
+	SetupTwoFactorOnLogin(c *fiber.Ctx) error
 	Logout(c *fiber.Ctx) error
 	GetMyProfile(c *fiber.Ctx) error
 	IssueNewAccessToken(c *fiber.Ctx) error
 	AddDeviceToken(c *fiber.Ctx) error
+	ChangePassword(c *fiber.Ctx) error
+	ForgotPassword(c *fiber.Ctx) error
+	ResetPassword(c *fiber.Ctx) error
 }
 
 type authHandler struct {
-	authService services.AuthService
+	authService         services.AuthService
+	sessionService      services.SessionService
+	loginAttemptService services.LoginAttemptService
+	twoFactorService    services.TwoFactorService
+	mailer              utils.Mailer
 }
 
-func NewAuthHttpHandler(authService services.AuthService) AuthHandlerInterface {
+func NewAuthHttpHandler(authService services.AuthService, sessionService services.SessionService, loginAttemptService services.LoginAttemptService, twoFactorService services.TwoFactorService, mailer utils.Mailer) AuthHandlerInterface {
 	return &authHandler{
-		authService: authService,
+		authService:         authService,
+		sessionService:      sessionService,
+		loginAttemptService: loginAttemptService,
+		twoFactorService:    twoFactorService,
+		mailer:              mailer,
 	}
 }
 
@@ -36,52 +54,247 @@ func (handler *authHandler) Login(c *fiber.Ctx) error {
 		return utils.BadRequestResponse(c, "Invalid request data", nil)
 	}
 
+	ipAddress := c.IP()
+	userAgent := c.Get("User-Agent")
+
+	retryAfter, err := handler.loginAttemptService.CheckLoginAllowed(loginRequest.Email, ipAddress)
+	if err != nil {
+		logger.LogError(err, "Failed to check login throttle", map[string]interface{}{
+			"email": loginRequest.Email,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+	if retryAfter > 0 {
+		handler.loginAttemptService.RecordLoginFailure(loginRequest.Email, ipAddress, userAgent, "locked")
+
+		retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds))
+		return utils.ErrorResponse(c, fiber.StatusTooManyRequests, "Too many failed login attempts, please try again later", map[string]interface{}{
+			"retry_after_seconds": retryAfterSeconds,
+		})
+	}
+
 	userDataOnLogin, err := handler.authService.Login(loginRequest.Email, loginRequest.Password)
 	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok && customErr.StatusCode == fiber.StatusForbidden {
+			handler.loginAttemptService.RecordLoginFailure(loginRequest.Email, ipAddress, userAgent, "not_approved")
+			return utils.ForbiddenResponse(c, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
 		logger.LogError(err, "Failed to login", map[string]interface{}{
 			"email": loginRequest.Email,
 		})
+		handler.loginAttemptService.RecordLoginFailure(loginRequest.Email, ipAddress, userAgent, "invalid_credentials")
 		return utils.UnauthorizedResponse(c, "Invalid email or password", nil)
 	}
 
+	twoFactorStatus, err := handler.twoFactorService.GetTwoFactorStatus(userDataOnLogin.UserUUID, userDataOnLogin.RoleCode)
+	if err != nil {
+		logger.LogError(err, "Failed to check two-factor status", map[string]interface{}{
+			"user_id": userDataOnLogin.UserID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	// Tokens are only issued after the second factor has been verified
+	if twoFactorStatus.Enabled || twoFactorStatus.Required {
+		preAuthToken, err := utils.GeneratePreAuthToken(fmt.Sprintf("%d", userDataOnLogin.UserID), userDataOnLogin.UserUUID, userDataOnLogin.Username, userDataOnLogin.RoleCode, loginRequest.Email)
+		if err != nil {
+			logger.LogError(err, "Failed to generate pre-auth token", map[string]interface{}{
+				"user_id": userDataOnLogin.UserID,
+			})
+			return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+		}
+
+		return utils.SuccessResponse(c, "Two-factor verification required", map[string]interface{}{
+			"two_factor_required":       true,
+			"two_factor_setup_required": !twoFactorStatus.Enabled,
+			"pre_auth_token":            preAuthToken,
+		})
+	}
+
+	responseData, err := handler.startSession(c, fmt.Sprintf("%d", userDataOnLogin.UserID), userDataOnLogin.UserUUID, userDataOnLogin.Username, userDataOnLogin.RoleCode, loginRequest.DeviceLabel, loginRequest.FCMToken)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	handler.loginAttemptService.RecordLoginSuccess(loginRequest.Email, ipAddress, userAgent, userDataOnLogin.UserUUID)
+
+	return utils.SuccessResponse(c, "User logged in successfully", responseData)
+}
+
+// Second login step, verifies the TOTP or recovery code for a pre-auth token.
+// When 2FA is mandatory but not set up yet, the first code confirms the enrolment.
+func (handler *authHandler) LoginTwoFactor(c *fiber.Ctx) error {
+	twoFactorRequest := new(dto.TwoFactorLoginRequest)
+	if err := c.BodyParser(twoFactorRequest); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, twoFactorRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	claims, err := utils.ValidatePreAuthToken(twoFactorRequest.PreAuthToken)
+	if err != nil {
+		return utils.UnauthorizedResponse(c, "Pre-auth token is invalid or expired, please log in again", nil)
+	}
+
+	userID, _ := claims["sub"].(string)
+	userUUID, _ := claims["user_uuid"].(string)
+	username, _ := claims["user_name"].(string)
+	roleCode, _ := claims["role_code"].(string)
+	email, _ := claims["email"].(string)
+
+	ipAddress := c.IP()
+	userAgent := c.Get("User-Agent")
+
+	retryAfter, err := handler.loginAttemptService.CheckLoginAllowed(email, ipAddress)
+	if err != nil {
+		logger.LogError(err, "Failed to check login throttle", map[string]interface{}{
+			"email": email,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+	if retryAfter > 0 {
+		handler.loginAttemptService.RecordLoginFailure(email, ipAddress, userAgent, "locked")
+
+		retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds))
+		return utils.ErrorResponse(c, fiber.StatusTooManyRequests, "Too many failed login attempts, please try again later", map[string]interface{}{
+			"retry_after_seconds": retryAfterSeconds,
+		})
+	}
+
+	twoFactorStatus, err := handler.twoFactorService.GetTwoFactorStatus(userUUID, roleCode)
+	if err != nil {
+		logger.LogError(err, "Failed to check two-factor status", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	var recoveryCodes []string
+	if twoFactorStatus.Enabled {
+		err = handler.twoFactorService.VerifyCode(userUUID, twoFactorRequest.Code)
+	} else {
+		recoveryCodes, err = handler.twoFactorService.ConfirmEnrolment(userUUID, twoFactorRequest.Code)
+	}
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			if customErr.StatusCode == fiber.StatusUnauthorized {
+				handler.loginAttemptService.RecordLoginFailure(email, ipAddress, userAgent, "invalid_two_factor_code")
+			}
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to verify two-factor code", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	// A pre-auth token can only complete one login
+	if err := utils.InvalidateToken(twoFactorRequest.PreAuthToken); err != nil {
+		logger.LogError(err, "Failed to invalidate pre-auth token", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	responseData, err := handler.startSession(c, userID, userUUID, username, roleCode, twoFactorRequest.DeviceLabel, twoFactorRequest.FCMToken)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	handler.loginAttemptService.RecordLoginSuccess(email, ipAddress, userAgent, userUUID)
+
+	if recoveryCodes != nil {
+		responseData["recovery_codes"] = recoveryCodes
+	}
+
+	return utils.SuccessResponse(c, "User logged in successfully", responseData)
+}
+
+// Start the 2FA enrolment during login for accounts whose role requires it
+func (handler *authHandler) SetupTwoFactorOnLogin(c *fiber.Ctx) error {
+	setupRequest := new(dto.TwoFactorSetupRequest)
+	if err := c.BodyParser(setupRequest); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, setupRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	claims, err := utils.ValidatePreAuthToken(setupRequest.PreAuthToken)
+	if err != nil {
+		return utils.UnauthorizedResponse(c, "Pre-auth token is invalid or expired, please log in again", nil)
+	}
+
+	userUUID, _ := claims["user_uuid"].(string)
+	email, _ := claims["email"].(string)
+
+	enrolment, err := handler.twoFactorService.BeginEnrolment(userUUID, email)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to start two-factor enrolment", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Scan the QR code with your authenticator app, then log in with the code", enrolment)
+}
+
+// Create the device session and issue its access and refresh tokens
+func (handler *authHandler) startSession(c *fiber.Ctx, userID, userUUID, username, roleCode, deviceLabel, fcmToken string) (map[string]interface{}, error) {
 	logger.LogInfo("User logged in", map[string]interface{}{
-		"id":    userDataOnLogin.UserID,
-		"email": loginRequest.Email,
+		"id":        userID,
+		"user_uuid": userUUID,
 	})
 
+	// Every login is its own device session
+	sessionUUID, err := handler.sessionService.CreateSession(userUUID, deviceLabel, c.Get("User-Agent"), c.IP(), fcmToken)
+	if err != nil {
+		logger.LogError(err, "Failed to create session", map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, err
+	}
+
 	// Access token (short expiration)
-	accessToken, err := utils.GenerateToken(fmt.Sprintf("%d", userDataOnLogin.UserID), userDataOnLogin.UserUUID, userDataOnLogin.Username, userDataOnLogin.RoleCode)
+	accessToken, err := utils.GenerateToken(userID, userUUID, username, roleCode, sessionUUID.String())
 	if err != nil {
 		logger.LogError(err, "Failed to generate access token", map[string]interface{}{
-			"user_id": userDataOnLogin.UserID,
+			"user_id": userID,
 		})
-		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+		return nil, err
 	}
 
 	// Refresh token (long expiration)
-	refreshToken, err := utils.GenerateRefreshToken(fmt.Sprintf("%d", userDataOnLogin.UserID), userDataOnLogin.UserUUID, userDataOnLogin.Username, userDataOnLogin.RoleCode)
+	refreshToken, err := utils.GenerateRefreshToken(userID, userUUID, username, roleCode, sessionUUID.String())
 	if err != nil {
 		logger.LogError(err, "Failed to generate refresh token", map[string]interface{}{
-			"user_id": userDataOnLogin.UserID,
+			"user_id": userID,
 		})
-		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+		return nil, err
 	}
 
 	// Save refresh token in the database
-	err = utils.SaveRefreshToken(userDataOnLogin.UserUUID, refreshToken)
+	err = utils.SaveRefreshToken(userUUID, refreshToken, sessionUUID)
 	if err != nil {
 		logger.LogError(err, "Failed to save refresh token", map[string]interface{}{
-			"user_id": userDataOnLogin.UserID,
+			"user_id": userID,
 		})
-		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+		return nil, err
 	}
 
-	responseData := map[string]interface{}{
+	return map[string]interface{}{
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
-	}
-
-	return utils.SuccessResponse(c, "User logged in successfully", responseData)
+		"session_uuid":  sessionUUID.String(),
+	}, nil
 }
 
 func (handler *authHandler) Logout(c *fiber.Ctx) error {
@@ -93,24 +306,32 @@ func (handler *authHandler) Logout(c *fiber.Ctx) error {
 	}
 	log.Printf("UserUUID retrieved: %s\n", userUUID)
 
-	// Delete WebSocket connection if exists
-	conn, exists := utils.GetConnection(userUUID)
-	if exists {
-		log.Println("WebSocket connection exists, closing connection...")
-		conn.Close()
-		utils.RemoveConnection(userUUID)
-		log.Printf("WebSocket connection for user %s closed and removed\n", userUUID)
+	sessionUUID, ok := c.Locals("sessionUUID").(string)
+	if !ok {
+		log.Println("SessionUUID not found in context")
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
 	}
 
-	err := handler.authService.DeleteRefreshTokenOnLogout(c.Context(), userUUID)
+	username, _ := c.Locals("user_name").(string)
+
+	// Close this session's WebSocket connections on every instance
+	utils.DisconnectSession(sessionUUID)
+	log.Printf("WebSocket connections for session %s closed\n", sessionUUID)
+
+	// Only the current device is logged out, other sessions stay active
+	err := handler.sessionService.RevokeSession(userUUID, sessionUUID, username)
 	if err != nil {
-		log.Printf("Failed to delete refresh token for user %s: %v\n", userUUID, err)
+		log.Printf("Failed to revoke session %s for user %s: %v\n", sessionUUID, userUUID, err)
 		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
 	}
-	log.Printf("Refresh token for user %s deleted\n", userUUID)
+	log.Printf("Session %s for user %s revoked\n", sessionUUID, userUUID)
 
-	utils.InvalidateToken(c.Get("Authorization"))
-	log.Println("Access token invalidated")
+	err = utils.InvalidateSession(uuid.MustParse(sessionUUID), uuid.MustParse(userUUID))
+	if err != nil {
+		log.Printf("Failed to invalidate access tokens for session %s: %v\n", sessionUUID, err)
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+	log.Println("Access tokens of the session invalidated")
 
 	err = handler.authService.UpdateUserStatus(userUUID, "offline", time.Now())
 	if err != nil {
@@ -172,29 +393,50 @@ func (handler *authHandler) IssueNewAccessToken(c *fiber.Ctx) error {
 
 	userID := claims["sub"].(string)
 	userUUID := claims["user_uuid"].(string)
+	username := claims["user_name"].(string)
+	roleCode := claims["role_code"].(string)
+
+	sessionUUID, ok := claims["sid"].(string)
+	if !ok || sessionUUID == "" {
+		return utils.UnauthorizedResponse(c, "Your session has expired or revoked, please login again", nil)
+	}
 
-	tokenErr := handler.authService.CheckStoredRefreshToken(userUUID, refreshToken)
-	if tokenErr != nil {
-		logger.LogError(tokenErr, "Failed to get stored refresh token", map[string]interface{}{
+	// Generate the successor refresh token in the same family
+	nextRefreshToken, err := utils.GenerateRefreshToken(userID, userUUID, username, roleCode, sessionUUID)
+	if err != nil {
+		logger.LogError(err, "Failed to generate refresh token", map[string]interface{}{
 			"user_id": userID,
-			"token":   refreshToken,
 		})
 		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
 	}
 
-	username := claims["user_name"].(string)
-	roleCode := claims["role_code"].(string)
-
-	err = handler.authService.UpdateRefreshToken(userUUID, refreshToken)
+	err = handler.authService.RotateRefreshToken(userUUID, refreshToken, nextRefreshToken)
 	if err != nil {
-		logger.LogError(err, "Failed to update refresh token", map[string]interface{}{
+		if err == services.ErrRefreshTokenReused {
+			handler.revokeReusedSession(userUUID, sessionUUID)
+		}
+		if customErr, ok := err.(*errors.CustomError); ok {
+			logger.LogWarn("Refresh token rejected", map[string]interface{}{
+				"user_uuid": userUUID,
+				"reason":    customErr.Message,
+			})
+			return utils.UnauthorizedResponse(c, "Your session has expired or revoked, please login again", nil)
+		}
+		logger.LogError(err, "Failed to rotate refresh token", map[string]interface{}{
 			"user_uuid": userUUID,
 		})
-		return utils.UnauthorizedResponse(c, "Your session has expired or revoked, please login again", nil)
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	if err := handler.sessionService.TouchSession(sessionUUID); err != nil {
+		logger.LogWarn("Failed to update session activity", map[string]interface{}{
+			"session_uuid": sessionUUID,
+			"error":        err.Error(),
+		})
 	}
 
 	// Generate new access token
-	accessToken, err := utils.GenerateToken(userID, userUUID, username, roleCode)
+	accessToken, err := utils.GenerateToken(userID, userUUID, username, roleCode, sessionUUID)
 	if err != nil {
 		logger.LogError(err, "Failed to generate access token", map[string]interface{}{
 			"user_id": userID,
@@ -204,15 +446,46 @@ func (handler *authHandler) IssueNewAccessToken(c *fiber.Ctx) error {
 
 	return utils.SuccessResponse(c, "Access token refreshed", map[string]interface{}{
 		"reissued_access_token": accessToken,
+		"refresh_token":         nextRefreshToken,
 	})
 }
 
+// Whoever holds the other copy of the refresh token may hold the session's
+// access token too, so the whole session goes, not only the token family
+func (handler *authHandler) revokeReusedSession(userUUID, sessionUUID string) {
+	if err := handler.sessionService.RevokeSession(userUUID, sessionUUID, "refresh-token-reuse"); err != nil {
+		if customErr, ok := err.(*errors.CustomError); !ok || customErr.StatusCode != 404 {
+			logger.LogError(err, "Failed to revoke session after refresh token reuse", map[string]interface{}{
+				"user_uuid":    userUUID,
+				"session_uuid": sessionUUID,
+			})
+		}
+	}
+
+	parsedSessionUUID, err := uuid.Parse(sessionUUID)
+	if err != nil {
+		return
+	}
+	if err := utils.InvalidateSession(parsedSessionUUID, uuid.MustParse(userUUID)); err != nil {
+		logger.LogError(err, "Failed to invalidate session tokens", map[string]interface{}{
+			"user_uuid":    userUUID,
+			"session_uuid": sessionUUID,
+		})
+	}
+	utils.DisconnectSession(sessionUUID)
+}
+
 func (handler *authHandler) AddDeviceToken(c *fiber.Ctx) error {
 	userUUID, ok := c.Locals("userUUID").(string)
 	if !ok {
 		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
 	}
 
+	sessionUUID, ok := c.Locals("sessionUUID").(string)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
 	tokenRequest := new(dto.DeviceTokenRequest)
 	if err := c.BodyParser(tokenRequest); err != nil {
 		return utils.BadRequestResponse(c, "Invalid request data", nil)
@@ -221,7 +494,7 @@ func (handler *authHandler) AddDeviceToken(c *fiber.Ctx) error {
 	deviceToken := tokenRequest.Token
 
 	// Save Device Token
-	err := handler.authService.AddDeviceToken(userUUID, deviceToken)
+	err := handler.authService.AddDeviceToken(userUUID, sessionUUID, deviceToken)
 	if err != nil {
 		logger.LogError(err, "Failed to save FCM token", map[string]interface{}{
 			"user_uuid":    userUUID,
@@ -232,3 +505,139 @@ func (handler *authHandler) AddDeviceToken(c *fiber.Ctx) error {
 
 	return utils.SuccessResponse(c, "Device token added successfully", nil)
 }
+
+func (handler *authHandler) ChangePassword(c *fiber.Ctx) error {
+	userUUID, ok := c.Locals("userUUID").(string)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	username, _ := c.Locals("user_name").(string)
+
+	passwordRequest := new(dto.ChangePasswordRequest)
+	if err := c.BodyParser(passwordRequest); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, passwordRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	err := handler.authService.ChangePassword(userUUID, passwordRequest.OldPassword, passwordRequest.NewPassword, username)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok && customErr.StatusCode != 0 {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to change password", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Password changed successfully", nil)
+}
+
+func (handler *authHandler) ForgotPassword(c *fiber.Ctx) error {
+	forgotRequest := new(dto.ForgotPasswordRequest)
+	if err := c.BodyParser(forgotRequest); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, forgotRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	sendAllowed, retryAfter, err := handler.loginAttemptService.CountPasswordResetRequest(forgotRequest.Email, c.IP())
+	if err != nil {
+		logger.LogError(err, "Failed to check password reset throttle", map[string]interface{}{
+			"email": forgotRequest.Email,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+	if retryAfter > 0 {
+		retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds))
+		return utils.ErrorResponse(c, fiber.StatusTooManyRequests, "Too many password reset requests, please try again later", map[string]interface{}{
+			"retry_after_seconds": retryAfterSeconds,
+		})
+	}
+
+	// Unknown emails, emails past their limit and failed sends all get the same
+	// response so accounts can't be enumerated
+	if !sendAllowed {
+		logger.LogWarn("Password reset requests throttled for email", map[string]interface{}{
+			"email": forgotRequest.Email,
+		})
+		return utils.SuccessResponse(c, "If the email is registered, a reset code has been sent", nil)
+	}
+
+	// Registered emails take longer to answer than unknown ones, the code is
+	// created and mailed in the background so the response time doesn't tell
+	go handler.sendPasswordResetCode(forgotRequest.Email)
+
+	return utils.SuccessResponse(c, "If the email is registered, a reset code has been sent", nil)
+}
+
+func (handler *authHandler) sendPasswordResetCode(email string) {
+	code, err := handler.authService.RequestPasswordReset(email)
+	if err != nil {
+		logger.LogError(err, "Failed to create password reset code", map[string]interface{}{
+			"email": email,
+		})
+		return
+	}
+	if code == "" {
+		return
+	}
+
+	body := fmt.Sprintf("Your password reset code is %s.\n\nThe code can only be used once and expires soon. If you did not request a password reset, you can ignore this email.", code)
+	if err := handler.mailer.SendMail(email, "Password reset code", body); err != nil {
+		logger.LogError(err, "Failed to send password reset email", map[string]interface{}{
+			"email": email,
+		})
+	}
+}
+
+func (handler *authHandler) ResetPassword(c *fiber.Ctx) error {
+	resetRequest := new(dto.ResetPasswordRequest)
+	if err := c.BodyParser(resetRequest); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, resetRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	userUUID, err := handler.authService.ResetPassword(resetRequest.Email, resetRequest.Code, resetRequest.NewPassword)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to reset password", map[string]interface{}{
+			"email": resetRequest.Email,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	// The new password logs the user out of every device
+	sessionUUIDs, err := handler.sessionService.RevokeAllSessions(userUUID, "password-reset")
+	if err != nil {
+		logger.LogError(err, "Failed to revoke sessions after password reset", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	for _, sessionUUID := range sessionUUIDs {
+		if err := utils.InvalidateSession(sessionUUID, uuid.MustParse(userUUID)); err != nil {
+			logger.LogError(err, "Failed to invalidate session tokens", map[string]interface{}{
+				"user_uuid":    userUUID,
+				"session_uuid": sessionUUID.String(),
+			})
+			return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+		}
+		utils.DisconnectSession(sessionUUID.String())
+	}
+
+	return utils.SuccessResponse(c, "Password has been reset, please login again", nil)
+}
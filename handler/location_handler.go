@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"shuttle/errors"
+	"shuttle/logger"
+	"shuttle/services"
+	"shuttle/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type LocationHandlerInterface interface {
+	GetShuttlePath(c *fiber.Ctx) error
+	GetDriverPath(c *fiber.Ctx) error
+	GetSchoolFleet(c *fiber.Ctx) error
+}
+
+type locationHandler struct {
+	locationService services.LocationService
+}
+
+func NewLocationHttpHandler(locationService services.LocationService) LocationHandlerInterface {
+	return &locationHandler{
+		locationService: locationService,
+	}
+}
+
+func (handler *locationHandler) GetShuttlePath(c *fiber.Ctx) error {
+	shuttleUUID := c.Params("id")
+
+	from, to, err := parseLocationRange(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	}
+
+	path, err := handler.locationService.GetShuttlePath(shuttleUUID, from, to)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to fetch shuttle path", map[string]interface{}{
+			"shuttle_uuid": shuttleUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Shuttle path fetched successfully", path)
+}
+
+func (handler *locationHandler) GetDriverPath(c *fiber.Ctx) error {
+	driverUUID := c.Params("id")
+
+	from, to, err := parseLocationRange(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	}
+
+	path, err := handler.locationService.GetDriverPath(driverUUID, from, to)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to fetch driver path", map[string]interface{}{
+			"driver_uuid": driverUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Driver path fetched successfully", path)
+}
+
+// The dispatcher map of the school admin's school
+func (handler *locationHandler) GetSchoolFleet(c *fiber.Ctx) error {
+	schoolUUID, ok := c.Locals("schoolUUID").(string)
+	if !ok || schoolUUID == "" {
+		return utils.UnauthorizedResponse(c, "Invalid token", nil)
+	}
+
+	fleet, err := handler.locationService.GetSchoolFleet(schoolUUID)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to fetch school fleet", map[string]interface{}{
+			"school_uuid": schoolUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "School fleet fetched successfully", fleet)
+}
+
+// Reads the from and to query parameters, either RFC3339 timestamps or plain
+// dates. A plain to date includes the whole day. Without parameters the range
+// is today so far.
+func parseLocationRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	to := now
+
+	if value := c.Query("from"); value != "" {
+		parsed, _, err := parseLocationTime(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid from, use a date (YYYY-MM-DD) or an RFC3339 timestamp", 400)
+		}
+		from = parsed
+	}
+
+	if value := c.Query("to"); value != "" {
+		parsed, isDate, err := parseLocationTime(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid to, use a date (YYYY-MM-DD) or an RFC3339 timestamp", 400)
+		}
+		if isDate {
+			parsed = parsed.AddDate(0, 0, 1)
+		}
+		to = parsed
+	}
+
+	return from, to, nil
+}
+
+func parseLocationTime(value string) (time.Time, bool, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, false, nil
+	}
+
+	parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return parsed, true, nil
+}
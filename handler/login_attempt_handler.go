@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"shuttle/errors"
+	"shuttle/logger"
+	"shuttle/models/entity"
+	"shuttle/services"
+	"shuttle/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type LoginAttemptHandlerInterface interface {
+	UnlockUser(c *fiber.Ctx) error
+	GetLoginHistory(c *fiber.Ctx) error
+}
+
+type loginAttemptHandler struct {
+	loginAttemptService services.LoginAttemptService
+}
+
+func NewLoginAttemptHttpHandler(loginAttemptService services.LoginAttemptService) LoginAttemptHandlerInterface {
+	return &loginAttemptHandler{
+		loginAttemptService: loginAttemptService,
+	}
+}
+
+func (handler *loginAttemptHandler) UnlockUser(c *fiber.Ctx) error {
+	userUUID := c.Params("id")
+
+	if err := handler.loginAttemptService.UnlockUser(userUUID); err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to unlock user", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	logger.LogInfo("User login unlocked", map[string]interface{}{
+		"user_uuid":   userUUID,
+		"unlocked_by": c.Locals("user_name"),
+	})
+
+	return utils.SuccessResponse(c, "User unlocked successfully", nil)
+}
+
+func (handler *loginAttemptHandler) GetLoginHistory(c *fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		return utils.BadRequestResponse(c, "Invalid page number", nil)
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limit < 1 {
+		return utils.BadRequestResponse(c, "Invalid limit number", nil)
+	}
+
+	filter := entity.LoginHistoryFilter{
+		UserUUID:  c.Query("user_uuid"),
+		Email:     c.Query("email"),
+		IPAddress: c.Query("ip_address"),
+	}
+
+	if success := c.Query("success"); success != "" {
+		parsedSuccess, err := strconv.ParseBool(success)
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid success filter, use 'true' or 'false'", nil)
+		}
+		filter.Success = &parsedSuccess
+	}
+
+	attempts, totalItems, err := handler.loginAttemptService.GetLoginHistory(page, limit, filter)
+	if err != nil {
+		logger.LogError(err, "Failed to fetch login history", nil)
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	totalPages := (totalItems + limit - 1) / limit
+
+	if page > totalPages {
+		if totalItems > 0 {
+			return utils.BadRequestResponse(c, "Page number out of range", nil)
+		} else {
+			page = 1
+		}
+	}
+
+	start := (page-1)*limit + 1
+	if totalItems == 0 || start > totalItems {
+		start = 0
+	}
+
+	end := start + len(attempts) - 1
+	if end > totalItems {
+		end = totalItems
+	}
+
+	if len(attempts) == 0 {
+		start = 0
+		end = 0
+	}
+
+	response := fiber.Map{
+		"data": attempts,
+		"meta": fiber.Map{
+			"current_page":   page,
+			"total_pages":    totalPages,
+			"per_page_items": limit,
+			"total_items":    totalItems,
+			"showing":        fmt.Sprintf("Showing %d-%d of %d", start, end, totalItems),
+		},
+	}
+
+	return utils.SuccessResponse(c, "Login history fetched successfully", response)
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"strings"
+
+	"shuttle/errors"
+	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/services"
+	"shuttle/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PermissionHandlerInterface interface {
+	GetAllRoles(c *fiber.Ctx) error
+	GetAllPermissions(c *fiber.Ctx) error
+	AddRole(c *fiber.Ctx) error
+	UpdateRole(c *fiber.Ctx) error
+}
+
+type permissionHandler struct {
+	permissionService services.PermissionService
+}
+
+func NewPermissionHttpHandler(permissionService services.PermissionService) PermissionHandlerInterface {
+	return &permissionHandler{
+		permissionService: permissionService,
+	}
+}
+
+func (handler *permissionHandler) GetAllRoles(c *fiber.Ctx) error {
+	roles, err := handler.permissionService.GetAllRoles()
+	if err != nil {
+		logger.LogError(err, "Failed to fetch roles", nil)
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Roles fetched successfully", roles)
+}
+
+func (handler *permissionHandler) GetAllPermissions(c *fiber.Ctx) error {
+	permissions, err := handler.permissionService.GetAllPermissions()
+	if err != nil {
+		logger.LogError(err, "Failed to fetch permissions", nil)
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Permissions fetched successfully", permissions)
+}
+
+func (handler *permissionHandler) AddRole(c *fiber.Ctx) error {
+	username, _ := c.Locals("user_name").(string)
+
+	roleReqDTO := new(dto.RoleRequestDTO)
+	if err := c.BodyParser(roleReqDTO); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, roleReqDTO); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	if err := handler.permissionService.AddRole(*roleReqDTO, username); err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to add role", map[string]interface{}{
+			"role_code": roleReqDTO.Code,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Role added successfully", nil)
+}
+
+func (handler *permissionHandler) UpdateRole(c *fiber.Ctx) error {
+	username, _ := c.Locals("user_name").(string)
+	roleCode := c.Params("id")
+
+	roleReqDTO := new(dto.RoleRequestDTO)
+	if err := c.BodyParser(roleReqDTO); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, roleReqDTO); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	if err := handler.permissionService.UpdateRole(roleCode, *roleReqDTO, username); err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to update role", map[string]interface{}{
+			"role_code": roleCode,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Role updated successfully", nil)
+}
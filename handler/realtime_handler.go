@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"shuttle/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RealtimeHandlerInterface interface {
+	GetRealtimeMetrics(c *fiber.Ctx) error
+}
+
+type realtimeHandler struct{}
+
+func NewRealtimeHttpHandler() RealtimeHandlerInterface {
+	return &realtimeHandler{}
+}
+
+// Only covers the instance serving the request, every node keeps its own connections
+func (handler *realtimeHandler) GetRealtimeMetrics(c *fiber.Ctx) error {
+	return utils.SuccessResponse(c, "Realtime metrics fetched successfully", utils.WebSocketMetrics())
+}
@@ -1,153 +1,209 @@
 package handler
 
-// import (
-// 	"shuttle/errors"
-// 	"shuttle/logger"
-// 	"shuttle/models/dto"
-// 	// "shuttle/models/entity"
-// 	"shuttle/services"
-// 	"shuttle/utils"
-// 	"strings"
-
-// 	"github.com/gofiber/fiber/v2"
-// 	"github.com/google/uuid"
-// )
-
-// type RegisterHandlerInterface interface {
-// 	AddUserRegister(c *fiber.Ctx) error
-// 	ApproveUserRegister(c *fiber.Ctx) error
-// }
-
-// type registerHandler struct {
-// 	registerService services.RegisterService
-// 	schoolService services.SchoolService
-// 	vehicleService services.VehicleService
-// }
-
-// func NewRegisterHttpHandler(registerService services.RegisterService, schoolService services.SchoolService, vehicleService services.VehicleService) RegisterHandlerInterface {
-// 	return &registerHandler{
-// 		registerService: registerService,
-// 		schoolService: schoolService,
-// 		vehicleService: vehicleService,
-// 	}
-// }
-
-// func validateUserRoleDetailsForRegister(_ *fiber.Ctx, user *dto.UserRequestsDTO, handler registerHandler) error {
-// 	switch user.Role {
-// 	case dto.SuperAdmin:
-// 		user.RoleCode = "SA"
-
-// 	case dto.SchoolAdmin:
-// 		details, err := parseDetails[dto.SchoolAdminDetailsRequestsDTO](user.Details)
-// 		if err != nil {
-// 			logger.LogError(err, "Invalid details format for SchoolAdmin", map[string]interface{}{
-// 				"details": string(user.Details),
-// 			})
-// 			return errors.New("invalid details format for SchoolAdmin", 400)
-// 		}
-
-// 		if details.SchoolUUID == "" {
-// 			// Jika SchoolUUID kosong, periksa apakah data sekolah baru tersedia
-// 			if details.School.Name == "" || details.School.Address == "" {
-// 				return errors.New("school is required for SchoolAdmin", 400)
-// 			}
-// 			// Jika data tersedia, lanjutkan proses tanpa error
-// 		} else {
-// 			// Jika SchoolUUID diisi, pastikan sekolah tersebut ada
-// 			_, errSchool := handler.schoolService.GetSpecSchool(details.SchoolUUID)
-// 			if errSchool != nil {
-// 				return errors.New("school is not found", 404)
-// 			}
-// 		}
-
-// 		user.RoleCode = "AS"
-
-// 	case dto.Parent:
-// 		if user.Details == nil {
-// 			return errors.New("parent details are required", 400)
-// 		}
-// 		user.RoleCode = "P"
-
-// 	case dto.Driver:
-// 		details, err := parseDetails[dto.DriverDetailsRequestsDTO](user.Details)
-// 		if err != nil {
-// 			logger.LogError(err, "Invalid details format for Driver", map[string]interface{}{
-// 				"details": string(user.Details),
-// 			})
-// 			return errors.New("invalid details format for Driver", 400)
-// 		}
-
-// 		if details.VehicleUUID != "" {
-// 			_, errVehicle := handler.vehicleService.GetSpecVehicle(details.VehicleUUID)
-// 			if errVehicle != nil {
-// 				return errors.New("vehicle is not found", 404)
-// 			}
-// 		}
-
-// 		if details.SchoolUUID != "" {
-// 			_, errSchool := handler.schoolService.GetSpecSchool(details.SchoolUUID)
-// 			if errSchool != nil {
-// 				return errors.New("school is not found", 404)
-// 			}
-// 		}
-
-// 		user.RoleCode = "D"
-
-// 	default:
-// 		return errors.New("invalid role specified", 400)
-// 	}
-
-// 	return nil
-// }
-
-// func (handler *registerHandler) AddUserRegister(c *fiber.Ctx) error {
-// 	// Parsing request body ke DTO
-// 	userReqDTO := new(dto.UserRequestsDTO)
-// 	if err := c.BodyParser(userReqDTO); err != nil {
-// 		return utils.BadRequestResponse(c, "Invalid request data", nil)
-// 	}
-
-// 	// Validasi struktur data request
-// 	if err := utils.ValidateStruct(c, userReqDTO); err != nil {
-// 		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
-// 	}
-
-// 	// Validasi role dan detail terkait
-// 	if err := validateUserRoleDetailsForRegister(c, userReqDTO, *handler); err != nil {
-// 		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
-// 	}
-
-// 	// Panggil service untuk menambahkan user
-// 	if _, err := handler.registerService.AddUserRegister(*userReqDTO, ""); err != nil {
-// 		if customErr, ok := err.(*errors.CustomError); ok {
-// 			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
-// 		}
-// 		logger.LogError(err, "Failed to create user", nil)
-// 		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
-// 	}
-
-// 	// Berikan respons sukses
-// 	return utils.SuccessResponse(c, "User created successfully", nil)
-// }
-
-// func (handler *registerHandler) ApproveUserRegister(c *fiber.Ctx) error {
-// 	userUUIDParam := c.Params("id")
-// 	userUUID, err := uuid.Parse(userUUIDParam)
-// 	if err != nil {
-// 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "UUID tidak valid"})
-// 	}
-
-// 	username, ok := c.Locals("user_name").(string)
-// 	if !ok || username == "" {
-// 		// Handle missing or invalid username
-// 		return utils.UnauthorizedResponse(c, "Unauthorized access: user_name not found", nil)
-// 	}
-// 	approverRole := c.Locals("role_code").(string)
-
-// 	err = handler.registerService.ApproveUserRegister(userUUID, username, approverRole)
-// 	if err != nil {
-// 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error()})
-// 	}
-
-// 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "User berhasil diapprove"})
-// }
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"shuttle/errors"
+	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/services"
+	"shuttle/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RegisterHandlerInterface interface {
+	AddUserRegister(c *fiber.Ctx) error
+	GetRegistrations(c *fiber.Ctx) error
+	ApproveUserRegister(c *fiber.Ctx) error
+	RejectUserRegister(c *fiber.Ctx) error
+}
+
+type registerHandler struct {
+	registerService services.RegisterService
+	mailer          utils.Mailer
+}
+
+func NewRegisterHttpHandler(registerService services.RegisterService, mailer utils.Mailer) RegisterHandlerInterface {
+	return &registerHandler{
+		registerService: registerService,
+		mailer:          mailer,
+	}
+}
+
+func (handler *registerHandler) AddUserRegister(c *fiber.Ctx) error {
+	registerRequest := new(dto.RegisterRequestDTO)
+	if err := c.BodyParser(registerRequest); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, registerRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	userUUID, err := handler.registerService.AddUserRegister(*registerRequest)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to register user", map[string]interface{}{
+			"email": registerRequest.Email,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nWe received your registration. You will get another email once it has been reviewed, until then you can't sign in.", registerRequest.FirstName)
+	handler.notifyApplicant(registerRequest.Email, "Registration received", body)
+
+	return utils.SuccessResponse(c, "Registration submitted, please wait for approval", fiber.Map{
+		"user_uuid":       userUUID.String(),
+		"register_status": dto.RegisterStatusPending,
+	})
+}
+
+func (handler *registerHandler) GetRegistrations(c *fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		return utils.BadRequestResponse(c, "Invalid page number", nil)
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limit < 1 {
+		return utils.BadRequestResponse(c, "Invalid limit number", nil)
+	}
+
+	status := strings.ToUpper(c.Query("status", dto.RegisterStatusPending))
+	if status != dto.RegisterStatusPending && status != dto.RegisterStatusApproved && status != dto.RegisterStatusRejected {
+		return utils.BadRequestResponse(c, "Invalid status, use 'pending', 'approved' or 'rejected'", nil)
+	}
+
+	registrations, totalItems, err := handler.registerService.GetRegistrations(page, limit, status, registrationReviewScope(c))
+	if err != nil {
+		logger.LogError(err, "Failed to fetch registrations", nil)
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	totalPages := (totalItems + limit - 1) / limit
+
+	if page > totalPages {
+		if totalItems > 0 {
+			return utils.BadRequestResponse(c, "Page number out of range", nil)
+		} else {
+			page = 1
+		}
+	}
+
+	start := (page-1)*limit + 1
+	if totalItems == 0 || start > totalItems {
+		start = 0
+	}
+
+	end := start + len(registrations) - 1
+	if end > totalItems {
+		end = totalItems
+	}
+
+	if len(registrations) == 0 {
+		start = 0
+		end = 0
+	}
+
+	response := fiber.Map{
+		"data": registrations,
+		"meta": fiber.Map{
+			"current_page":   page,
+			"total_pages":    totalPages,
+			"per_page_items": limit,
+			"total_items":    totalItems,
+			"showing":        fmt.Sprintf("Showing %d-%d of %d", start, end, totalItems),
+		},
+	}
+
+	return utils.SuccessResponse(c, "Registrations fetched successfully", response)
+}
+
+func (handler *registerHandler) ApproveUserRegister(c *fiber.Ctx) error {
+	return handler.reviewUserRegister(c, true)
+}
+
+func (handler *registerHandler) RejectUserRegister(c *fiber.Ctx) error {
+	return handler.reviewUserRegister(c, false)
+}
+
+func (handler *registerHandler) reviewUserRegister(c *fiber.Ctx, approve bool) error {
+	userUUID := c.Params("id")
+
+	username, ok := c.Locals("user_name").(string)
+	if !ok || username == "" {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	reviewRequest := new(dto.RegistrationReviewRequestDTO)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(reviewRequest); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request data", nil)
+		}
+	}
+
+	if err := utils.ValidateStruct(c, reviewRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	var registration dto.RegistrationResponseDTO
+	var err error
+	if approve {
+		registration, err = handler.registerService.ApproveUserRegister(userUUID, registrationReviewScope(c), username, reviewRequest.Reason)
+	} else {
+		registration, err = handler.registerService.RejectUserRegister(userUUID, registrationReviewScope(c), username, reviewRequest.Reason)
+	}
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to review registration", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	logger.LogInfo("Registration reviewed", map[string]interface{}{
+		"user_uuid":       userUUID,
+		"register_status": registration.RegisterStatus,
+		"reviewed_by":     username,
+	})
+
+	if approve {
+		body := fmt.Sprintf("Hi %s,\n\nYour registration has been approved, you can now sign in with your email and password.", registration.FirstName)
+		if reviewRequest.Reason != "" {
+			body += "\n\nNote from the reviewer: " + reviewRequest.Reason
+		}
+		handler.notifyApplicant(registration.Email, "Registration approved", body)
+
+		return utils.SuccessResponse(c, "Registration approved successfully", registration)
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nUnfortunately your registration has been rejected.\n\nReason: %s", registration.FirstName, reviewRequest.Reason)
+	handler.notifyApplicant(registration.Email, "Registration rejected", body)
+
+	return utils.SuccessResponse(c, "Registration rejected successfully", registration)
+}
+
+// The applicant isn't signed in yet and has no device token, so they are
+// notified by email. A failed email doesn't undo the registration or review.
+func (handler *registerHandler) notifyApplicant(email, subject, body string) {
+	if err := handler.mailer.SendMail(email, subject, body); err != nil {
+		logger.LogError(err, "Failed to send registration email", map[string]interface{}{
+			"email":   email,
+			"subject": subject,
+		})
+	}
+}
+
+// School admins review the parents of their own school, super admins review
+// drivers and school admins
+func registrationReviewScope(c *fiber.Ctx) string {
+	schoolUUID, _ := c.Locals("schoolUUID").(string)
+	return schoolUUID
+}
@@ -3,6 +3,8 @@ package handler
 import (
 	"fmt"
 	"log"
+	"shuttle/errors"
+	"shuttle/logger"
 	"shuttle/models/dto"
 	"shuttle/services"
 	"shuttle/utils"
@@ -24,6 +26,9 @@ type RouteHandlerInterface interface {
 	DeleteRoute(c *fiber.Ctx) error
 
 	GetDriverDistance(c *fiber.Ctx) error
+	ProposeRouteOrder(c *fiber.Ctx) error
+	ApplyRouteOrder(c *fiber.Ctx) error
+	PlanSchoolRoutes(c *fiber.Ctx) error
 }
 
 type routeHandler struct {
@@ -37,24 +42,111 @@ func NewRouteHttpHandler(routeService services.RouteServiceInterface) RouteHandl
 }
 
 func (h *routeHandler) GetDriverDistance(c *fiber.Ctx) error {
-	// Dummy data (seharusnya dari database)
-	driverStart := [2]float64{-7.773161987268529, 110.3747415099855}
-	students := [][2]float64{
-		{-7.7115806244533305, 110.41349437928434}, // Siswa 3
-		{-7.763653089789303, 110.42236650540428}, // Siswa 1
-		{-7.703233845448127, 110.43105534860973}, // Siswa 2
-	}
-	school := [2]float64{-7.715987795086408, 110.40701270626889}
-
-	// Hitung total jarak tempuh driver
-	totalDistance := h.routeService.GetTotalDistance(driverStart, students, school)
-
-	return c.JSON(fiber.Map{
-		"message":       "Total jarak tempuh berhasil dihitung",
-		"total_distance": totalDistance,
-	})
+	driverUUID, ok := c.Locals("userUUID").(string)
+	if !ok || driverUUID == "" {
+		return utils.UnauthorizedResponse(c, "Invalid token", nil)
+	}
+
+	distance, err := h.routeService.GetDriverDistance(driverUUID)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to calculate driver distance", map[string]interface{}{
+			"driver_uuid": driverUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Driver distance calculated successfully", distance)
+}
+
+
+func (h *routeHandler) ProposeRouteOrder(c *fiber.Ctx) error {
+	routeNameUUID := c.Params("id")
+	schoolUUID, ok := c.Locals("schoolUUID").(string)
+	if !ok {
+		return utils.BadRequestResponse(c, "Invalid token or schoolUUID", nil)
+	}
+
+	// The body is optional, without it the tour starts at the driver's depot
+	var request dto.RouteOptimizationRequestDTO
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body", nil)
+		}
+	}
+
+	proposal, err := h.routeService.ProposeRouteOrder(routeNameUUID, schoolUUID, request.StartPoint)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to propose route order", map[string]interface{}{
+			"route_name_uuid": routeNameUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Route order proposed successfully", proposal)
+}
+
+func (h *routeHandler) ApplyRouteOrder(c *fiber.Ctx) error {
+	routeNameUUID := c.Params("id")
+	schoolUUID, ok := c.Locals("schoolUUID").(string)
+	if !ok {
+		return utils.BadRequestResponse(c, "Invalid token or schoolUUID", nil)
+	}
+	username, _ := c.Locals("user_name").(string)
+
+	var request dto.ApplyRouteOrderRequestDTO
+	if err := c.BodyParser(&request); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", nil)
+	}
+	if err := utils.ValidateStruct(c, request); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	if err := h.routeService.ApplyRouteOrder(routeNameUUID, schoolUUID, request.StudentUUIDs, username); err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to apply route order", map[string]interface{}{
+			"route_name_uuid": routeNameUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Route order applied successfully", nil)
 }
 
+func (h *routeHandler) PlanSchoolRoutes(c *fiber.Ctx) error {
+	schoolUUID, ok := c.Locals("schoolUUID").(string)
+	if !ok {
+		return utils.BadRequestResponse(c, "Invalid token or schoolUUID", nil)
+	}
+
+	// The body is optional, without it the ride limit is ROUTE_PLAN_MAX_RIDE
+	var request dto.RoutePlanRequestDTO
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body", nil)
+		}
+	}
+
+	plan, err := h.routeService.PlanSchoolRoutes(schoolUUID, request.MaxRideMinutes)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to plan school routes", map[string]interface{}{
+			"school_uuid": schoolUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Route plan drafted successfully", plan)
+}
 
 func (handler *routeHandler) GetAllRoutesByAS(c *fiber.Ctx) error {
 	// Ambil schoolUUID dari token
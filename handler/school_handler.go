@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"shuttle/errors"
 	"shuttle/logger"
 	"shuttle/models/dto"
 	"shuttle/services"
@@ -19,6 +20,8 @@ type SchoolHandlerInterface interface {
 	AddSchool(c *fiber.Ctx) error
 	UpdateSchool(c *fiber.Ctx) error
 	DeleteSchool(c *fiber.Ctx) error
+	GetSchoolGeofence(c *fiber.Ctx) error
+	UpdateSchoolGeofence(c *fiber.Ctx) error
 }
 
 type schoolHandler struct {
@@ -185,6 +188,55 @@ func (handler *schoolHandler) DeleteSchool(c *fiber.Ctx) error {
 	return utils.SuccessResponse(c, "School deleted successfully", nil)
 }
 
+func (handler *schoolHandler) GetSchoolGeofence(c *fiber.Ctx) error {
+	schoolUUID, ok := c.Locals("schoolUUID").(string)
+	if !ok || schoolUUID == "" {
+		return utils.UnauthorizedResponse(c, "Invalid token", nil)
+	}
+
+	geofence, err := handler.schoolService.GetSchoolGeofence(schoolUUID)
+	if err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to fetch school geofence", map[string]interface{}{
+			"school_uuid": schoolUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "School geofence fetched successfully", geofence)
+}
+
+func (handler *schoolHandler) UpdateSchoolGeofence(c *fiber.Ctx) error {
+	schoolUUID, ok := c.Locals("schoolUUID").(string)
+	if !ok || schoolUUID == "" {
+		return utils.UnauthorizedResponse(c, "Invalid token", nil)
+	}
+	username, _ := c.Locals("user_name").(string)
+
+	geofence := new(dto.SchoolGeofenceRequestDTO)
+	if err := c.BodyParser(geofence); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, geofence); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	if err := handler.schoolService.UpdateSchoolGeofence(schoolUUID, *geofence, username); err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to update school geofence", map[string]interface{}{
+			"school_uuid": schoolUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "School geofence updated successfully", nil)
+}
+
 func isValidSortFieldForSchools(field string) bool {
 	allowedFields := map[string]bool{
 		"school_name": true,
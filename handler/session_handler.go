@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"shuttle/errors"
+	"shuttle/logger"
+	"shuttle/services"
+	"shuttle/utils"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type SessionHandlerInterface interface {
+	GetMySessions(c *fiber.Ctx) error
+	RevokeMySession(c *fiber.Ctx) error
+	GetUserSessions(c *fiber.Ctx) error
+	ForceLogoutUser(c *fiber.Ctx) error
+}
+
+type sessionHandler struct {
+	sessionService services.SessionService
+}
+
+func NewSessionHttpHandler(sessionService services.SessionService) SessionHandlerInterface {
+	return &sessionHandler{
+		sessionService: sessionService,
+	}
+}
+
+func (handler *sessionHandler) GetMySessions(c *fiber.Ctx) error {
+	userUUID, ok := c.Locals("userUUID").(string)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	sessionUUID, _ := c.Locals("sessionUUID").(string)
+
+	sessions, err := handler.sessionService.GetActiveSessions(userUUID, sessionUUID)
+	if err != nil {
+		logger.LogError(err, "Failed to fetch sessions", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Sessions fetched successfully", sessions)
+}
+
+func (handler *sessionHandler) RevokeMySession(c *fiber.Ctx) error {
+	userUUID, ok := c.Locals("userUUID").(string)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	username, _ := c.Locals("user_name").(string)
+	sessionUUID := c.Params("id")
+
+	if err := handler.sessionService.RevokeSession(userUUID, sessionUUID, username); err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to revoke session", map[string]interface{}{
+			"user_uuid":    userUUID,
+			"session_uuid": sessionUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	if err := utils.InvalidateSession(uuid.MustParse(sessionUUID), uuid.MustParse(userUUID)); err != nil {
+		logger.LogError(err, "Failed to invalidate session tokens", map[string]interface{}{
+			"user_uuid":    userUUID,
+			"session_uuid": sessionUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+	utils.DisconnectSession(sessionUUID)
+
+	return utils.SuccessResponse(c, "Session revoked successfully", nil)
+}
+
+func (handler *sessionHandler) GetUserSessions(c *fiber.Ctx) error {
+	userUUID := c.Params("id")
+	if _, err := uuid.Parse(userUUID); err != nil {
+		return utils.BadRequestResponse(c, "Invalid user UUID", nil)
+	}
+
+	sessions, err := handler.sessionService.GetActiveSessions(userUUID, "")
+	if err != nil {
+		logger.LogError(err, "Failed to fetch sessions", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Sessions fetched successfully", sessions)
+}
+
+// Log a user out of every device
+func (handler *sessionHandler) ForceLogoutUser(c *fiber.Ctx) error {
+	username, _ := c.Locals("user_name").(string)
+	userUUID := c.Params("id")
+
+	parsedUserUUID, err := uuid.Parse(userUUID)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid user UUID", nil)
+	}
+
+	sessionUUIDs, err := handler.sessionService.RevokeAllSessions(userUUID, username)
+	if err != nil {
+		logger.LogError(err, "Failed to revoke sessions", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	for _, sessionUUID := range sessionUUIDs {
+		if err := utils.InvalidateSession(sessionUUID, parsedUserUUID); err != nil {
+			logger.LogError(err, "Failed to invalidate session tokens", map[string]interface{}{
+				"user_uuid":    userUUID,
+				"session_uuid": sessionUUID.String(),
+			})
+			return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+		}
+		utils.DisconnectSession(sessionUUID.String())
+	}
+
+	logger.LogInfo("User force logged out", map[string]interface{}{
+		"user_uuid":        userUUID,
+		"revoked_by":       username,
+		"revoked_sessions": len(sessionUUIDs),
+	})
+
+	return utils.SuccessResponse(c, "User logged out from all devices", map[string]interface{}{
+		"revoked_sessions": len(sessionUUIDs),
+	})
+}
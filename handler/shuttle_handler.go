@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"shuttle/logger"
 	"shuttle/models/dto"
+	"shuttle/models/entity"
 	"shuttle/services"
 	"shuttle/utils"
 	"strconv"
@@ -20,13 +21,15 @@ import (
 )
 
 type ShuttleHandler struct {
-	ShuttleService services.ShuttleServiceInterface
-	DB             *sqlx.DB 
+	ShuttleService      services.ShuttleServiceInterface
+	AccessPolicyService services.AccessPolicyService
+	DB                  *sqlx.DB 
 }
 
-func NewShuttleHandler(shuttleService services.ShuttleServiceInterface) *ShuttleHandler {
+func NewShuttleHandler(shuttleService services.ShuttleServiceInterface, accessPolicyService services.AccessPolicyService) *ShuttleHandler {
 	return &ShuttleHandler{
-		ShuttleService: shuttleService,
+		ShuttleService:      shuttleService,
+		AccessPolicyService: accessPolicyService,
 	}
 }
 
@@ -80,6 +83,20 @@ func (h *ShuttleHandler) GetShuttleTrackByParent(c *fiber.Ctx) error {
 		return utils.NotFoundResponse(c, "Shuttle data not found", nil)
 	}
 
+	// Where each bus was last seen, so the track screen isn't empty until the
+	// next ping, and when it should reach the child's next stop
+	for i := range shuttles {
+		if position, ok := utils.LastKnownPosition(shuttles[i].ShuttleUUID); ok {
+			shuttles[i].LastPosition = &position
+		}
+		if shuttles[i].ShuttleStatus == "home" || shuttles[i].ShuttleStatus == "at_school" {
+			continue
+		}
+		if eta, ok := utils.ShuttleETA(shuttles[i].ShuttleUUID); ok {
+			shuttles[i].ETA = &eta
+		}
+	}
+
 	// Kirim response
 	log.Println("Successfully fetched shuttle data:", shuttles)
 	return c.Status(http.StatusOK).JSON(shuttles)
@@ -247,6 +264,22 @@ func (h *ShuttleHandler) AddShuttle(c *fiber.Ctx) error {
 	}
 	log.Println("AddShuttle: Shuttle request validated")
 
+	// The student comes from the body, so the ownership middleware can't see it
+	found, allowed, err := h.AccessPolicyService.CheckAccess(entity.PolicyDriverStudent, shuttleReq.StudentUUID, userUUID, "")
+	if err != nil {
+		logger.LogError(err, "Failed to check student ownership", map[string]interface{}{
+			"student_uuid": shuttleReq.StudentUUID,
+			"driver_uuid":  userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+	if !found {
+		return utils.NotFoundResponse(c, "Student not found", nil)
+	}
+	if !allowed {
+		return utils.ForbiddenResponse(c, "You don't have access to this resource", nil)
+	}
+
 	// Log: Attempt to add shuttle
 	if err := h.ShuttleService.AddShuttle(*shuttleReq, driverUUID.String(), username); err != nil {
 		log.Println("AddShuttle: Failed to add shuttle")
@@ -302,5 +335,19 @@ func (h *ShuttleHandler) EditShuttle(c *fiber.Ctx) error {
 		})
 	}
 
+	// And to everyone following the shuttle or the school's fleet live
+	statusChanged := dto.RealtimeStatusChangedPayload{
+		ShuttleUUID: id,
+		StudentUUID: shuttle[0].StudentUUID,
+		DriverUUID:  shuttle[0].DriverUUID,
+		Status:      shuttleStatus,
+		ChangedAt:   time.Now().Format(time.RFC3339),
+	}
+	utils.PublishRealtimeMessage(id, dto.RealtimeTypeStatusChanged, statusChanged)
+	utils.ForgetETAPlan(shuttle[0].DriverUUID)
+	if shuttle[0].SchoolUUID != "" {
+		utils.PublishSchoolMessage(shuttle[0].SchoolUUID, dto.RealtimeTypeStatusChanged, "", statusChanged)
+	}
+
 	return utils.SuccessResponse(c, "Shuttle status updated successfully", nil)
 }
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"shuttle/errors"
+	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/services"
+	"shuttle/utils"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TwoFactorHandlerInterface interface {
+	GetMyTwoFactor(c *fiber.Ctx) error
+	EnrolMyTwoFactor(c *fiber.Ctx) error
+	ConfirmMyTwoFactor(c *fiber.Ctx) error
+	RegenerateMyRecoveryCodes(c *fiber.Ctx) error
+	DisableMyTwoFactor(c *fiber.Ctx) error
+	ResetUserTwoFactor(c *fiber.Ctx) error
+}
+
+type twoFactorHandler struct {
+	twoFactorService services.TwoFactorService
+}
+
+func NewTwoFactorHttpHandler(twoFactorService services.TwoFactorService) TwoFactorHandlerInterface {
+	return &twoFactorHandler{
+		twoFactorService: twoFactorService,
+	}
+}
+
+func (handler *twoFactorHandler) GetMyTwoFactor(c *fiber.Ctx) error {
+	userUUID, ok := c.Locals("userUUID").(string)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	roleCode, _ := c.Locals("role_code").(string)
+
+	status, err := handler.twoFactorService.GetTwoFactorStatus(userUUID, roleCode)
+	if err != nil {
+		logger.LogError(err, "Failed to fetch two-factor status", map[string]interface{}{
+			"user_uuid": userUUID,
+		})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+
+	return utils.SuccessResponse(c, "Two-factor status fetched successfully", status)
+}
+
+func (handler *twoFactorHandler) EnrolMyTwoFactor(c *fiber.Ctx) error {
+	userUUID, ok := c.Locals("userUUID").(string)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	username, _ := c.Locals("user_name").(string)
+
+	enrolment, err := handler.twoFactorService.BeginEnrolment(userUUID, username)
+	if err != nil {
+		return handler.errorResponse(c, err, "Failed to start two-factor enrolment", userUUID)
+	}
+
+	return utils.SuccessResponse(c, "Scan the QR code with your authenticator app, then confirm with a code", enrolment)
+}
+
+func (handler *twoFactorHandler) ConfirmMyTwoFactor(c *fiber.Ctx) error {
+	userUUID, ok := c.Locals("userUUID").(string)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	codeRequest := new(dto.TwoFactorCodeRequest)
+	if err := c.BodyParser(codeRequest); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, codeRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	recoveryCodes, err := handler.twoFactorService.ConfirmEnrolment(userUUID, codeRequest.Code)
+	if err != nil {
+		return handler.errorResponse(c, err, "Failed to confirm two-factor enrolment", userUUID)
+	}
+
+	return utils.SuccessResponse(c, "Two-factor authentication enabled, store the recovery codes somewhere safe", fiber.Map{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+func (handler *twoFactorHandler) RegenerateMyRecoveryCodes(c *fiber.Ctx) error {
+	userUUID, ok := c.Locals("userUUID").(string)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	codeRequest := new(dto.TwoFactorCodeRequest)
+	if err := c.BodyParser(codeRequest); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, codeRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	recoveryCodes, err := handler.twoFactorService.RegenerateRecoveryCodes(userUUID, codeRequest.Code)
+	if err != nil {
+		return handler.errorResponse(c, err, "Failed to regenerate recovery codes", userUUID)
+	}
+
+	return utils.SuccessResponse(c, "Recovery codes regenerated, the previous codes no longer work", fiber.Map{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+func (handler *twoFactorHandler) DisableMyTwoFactor(c *fiber.Ctx) error {
+	userUUID, ok := c.Locals("userUUID").(string)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	roleCode, _ := c.Locals("role_code").(string)
+
+	disableRequest := new(dto.TwoFactorDisableRequest)
+	if err := c.BodyParser(disableRequest); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request data", nil)
+	}
+
+	if err := utils.ValidateStruct(c, disableRequest); err != nil {
+		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
+	}
+
+	if err := handler.twoFactorService.DisableTwoFactor(userUUID, roleCode, disableRequest.Password, disableRequest.Code); err != nil {
+		return handler.errorResponse(c, err, "Failed to disable two-factor authentication", userUUID)
+	}
+
+	return utils.SuccessResponse(c, "Two-factor authentication disabled", nil)
+}
+
+func (handler *twoFactorHandler) ResetUserTwoFactor(c *fiber.Ctx) error {
+	userUUID := c.Params("id")
+
+	if err := handler.twoFactorService.ResetTwoFactor(userUUID); err != nil {
+		return handler.errorResponse(c, err, "Failed to reset two-factor authentication", userUUID)
+	}
+
+	logger.LogInfo("User two-factor authentication reset", map[string]interface{}{
+		"user_uuid": userUUID,
+		"reset_by":  c.Locals("user_name"),
+	})
+
+	return utils.SuccessResponse(c, "Two-factor authentication reset successfully", nil)
+}
+
+func (handler *twoFactorHandler) errorResponse(c *fiber.Ctx, err error, message, userUUID string) error {
+	if customErr, ok := err.(*errors.CustomError); ok {
+		return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+	}
+	logger.LogError(err, message, map[string]interface{}{
+		"user_uuid": userUUID,
+	})
+	return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+}
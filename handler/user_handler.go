@@ -45,13 +45,15 @@ type userHandler struct {
 	userService   services.UserService
 	schoolService services.SchoolService
 	vehicleService services.VehicleService
+	permissionService services.PermissionService
 }
 
-func NewUserHttpHandler(userService services.UserService, schoolService services.SchoolService, vehicleService services.VehicleService) UserHandlerInterface {
+func NewUserHttpHandler(userService services.UserService, schoolService services.SchoolService, vehicleService services.VehicleService, permissionService services.PermissionService) UserHandlerInterface {
 	return &userHandler{
 		userService:   userService,
 		schoolService: schoolService,
 		vehicleService: vehicleService,
+		permissionService: permissionService,
 	}
 }
 
@@ -190,7 +192,7 @@ func (handler *userHandler) GetAllSchoolAdmin(c *fiber.Ctx) error {
 }
 
 func (handler *userHandler) GetAllPermittedDriver(c *fiber.Ctx) error {
-    role := c.Locals("role_code").(string)
+    scope := driverAccessScope(c)
 
     page, err := strconv.Atoi(c.Query("page", "1"))
     if err != nil || page < 1 {
@@ -213,8 +215,8 @@ func (handler *userHandler) GetAllPermittedDriver(c *fiber.Ctx) error {
         return utils.BadRequestResponse(c, "Invalid sort field", nil)
     }
 
-    switch role {
-    case "SA":
+    switch scope {
+    case "all":
         users, totalItems, err := handler.userService.GetAllDriverFromAllSchools(page, limit, sortField, sortDirection)
         if err != nil {
             logger.LogError(err, "Failed to fetch all drivers", nil)
@@ -258,7 +260,7 @@ func (handler *userHandler) GetAllPermittedDriver(c *fiber.Ctx) error {
 
         return utils.SuccessResponse(c, "Users fetched successfully", response)
 
-    case "AS":
+    case "school":
         schoolUUID, ok := c.Locals("schoolUUID").(string)
         if !ok {
             return utils.BadRequestResponse(c, "Token is invalid", nil)
@@ -319,12 +321,8 @@ func (handler *userHandler) GetSpecPermittedDriver(c *fiber.Ctx) error {
 	id := c.Params("id")
 	log.Printf("Retrieved id from params: %s", id)
 
-	role, ok := c.Locals("role_code").(string)
-	if !ok {
-		log.Println("Failed to retrieve role_code from context")
-		return utils.BadRequestResponse(c, "Invalid role", nil)
-	}
-	log.Printf("Retrieved role_code from context: %s", role)
+	scope := driverAccessScope(c)
+	log.Printf("Resolved driver access scope: %s", scope)
 
 	var user dto.UserResponseDTO
 	var err error
@@ -337,12 +335,12 @@ func (handler *userHandler) GetSpecPermittedDriver(c *fiber.Ctx) error {
 		return utils.NotFoundResponse(c, "User not found", nil)
 	}
 
-	switch role {
-	case "SA":
-		log.Println("Role is SA, fetching driver from all schools")
+	switch scope {
+	case "all":
+		log.Println("Fetching driver from all schools")
 		user, err = handler.userService.GetSpecDriverFromAllSchools(id)
-	case "AS":
-		log.Println("Role is AS, verifying schoolUUID from context")
+	case "school":
+		log.Println("Verifying schoolUUID from context")
 		schoolUUID, ok := c.Locals("schoolUUID").(string)
 		if !ok {
 			log.Println("Failed to retrieve schoolUUID from context")
@@ -367,6 +365,15 @@ func (handler *userHandler) GetSpecPermittedDriver(c *fiber.Ctx) error {
 	return utils.SuccessResponse(c, "User fetched successfully", user)
 }
 
+// Driver routes under the school group carry the caller's school and only
+// see its drivers, the same handlers elsewhere see drivers of every school
+func driverAccessScope(c *fiber.Ctx) string {
+	if _, ok := c.Locals("schoolUUID").(string); ok {
+		return "school"
+	}
+	return "all"
+}
+
 func (handler *userHandler) GetSpecSuperAdmin(c *fiber.Ctx) error {
 	id := c.Params("id")
 	user, err := handler.userService.GetSpecSuperAdmin(id)
@@ -401,9 +408,17 @@ func (handler *userHandler) AddUser(c *fiber.Ctx) error {
 		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
 	}
 
+	requestedRoleCode := userReqDTO.RoleCode
 	if err := validateUserRoleDetails(c, userReqDTO, *handler); err != nil {
 		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
 	}
+	if err := handler.applyCustomRoleCode(c, userReqDTO, requestedRoleCode); err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to check custom role", map[string]interface{}{"role_code": requestedRoleCode})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
 
 	if _, err := handler.userService.AddUser(*userReqDTO, username); err != nil {
 		if customErr, ok := err.(*errors.CustomError); ok {
@@ -502,9 +517,17 @@ func (handler *userHandler) UpdateUser(c *fiber.Ctx) error {
 		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
 	}
 
+	requestedRoleCode := userReqDTO.RoleCode
 	if err := validateUserRoleDetails(c, userReqDTO, *handler); err != nil {
 		return utils.BadRequestResponse(c, strings.ToUpper(err.Error()[0:1])+err.Error()[1:], nil)
 	}
+	if err := handler.applyCustomRoleCode(c, userReqDTO, requestedRoleCode); err != nil {
+		if customErr, ok := err.(*errors.CustomError); ok {
+			return utils.ErrorResponse(c, customErr.StatusCode, strings.ToUpper(string(customErr.Message[0]))+customErr.Message[1:], nil)
+		}
+		logger.LogError(err, "Failed to check custom role", map[string]interface{}{"role_code": requestedRoleCode})
+		return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
 
 	if err := handler.userService.UpdateUser(id, *userReqDTO, username, nil); err != nil {
 		if customErr, ok := err.(*errors.CustomError); ok {
@@ -722,7 +745,7 @@ func (handler *userHandler) DeleteSchoolDriver(c *fiber.Ctx) error {
 func validateUserRoleDetails(_ *fiber.Ctx, user *dto.UserRequestsDTO, handler userHandler) error {
 	switch user.Role {
 	case dto.SuperAdmin:
-		user.RoleCode = "SA"
+		setDefaultRoleCode(user, "SA")
 
 	case dto.SchoolAdmin:
 		details, err := parseDetails[dto.SchoolAdminDetailsRequestsDTO](user.Details)
@@ -742,13 +765,13 @@ func validateUserRoleDetails(_ *fiber.Ctx, user *dto.UserRequestsDTO, handler us
 			return errors.New("school is not found", 404)
 		}
 
-		user.RoleCode = "AS"
+		setDefaultRoleCode(user, "AS")
 
 	case dto.Parent:
 		if user.Details == nil {
 			return errors.New("parent details are required", 400)
 		}
-		user.RoleCode = "P"
+		setDefaultRoleCode(user, "P")
 
 	case dto.Driver:
 		details, err := parseDetails[dto.DriverDetailsRequestsDTO](user.Details)
@@ -759,6 +782,10 @@ func validateUserRoleDetails(_ *fiber.Ctx, user *dto.UserRequestsDTO, handler us
 			return errors.New("invalid details format for Driver", 400)
 		}
 
+		if details.DepotPoint != nil && !validDepotPoint(details.DepotPoint) {
+			return errors.New("depot point needs a valid latitude and longitude", 400)
+		}
+
 		if details.VehicleUUID != "" {
 			_, errVehicle := handler.vehicleService.GetSpecVehicle(details.VehicleUUID)
 			if errVehicle != nil {
@@ -779,7 +806,7 @@ func validateUserRoleDetails(_ *fiber.Ctx, user *dto.UserRequestsDTO, handler us
 			}
 		}
 
-		user.RoleCode = "D"
+		setDefaultRoleCode(user, "D")
 
 	default:
 		return errors.New("invalid role specified", 400)
@@ -788,6 +815,34 @@ func validateUserRoleDetails(_ *fiber.Ctx, user *dto.UserRequestsDTO, handler us
 	return nil
 }
 
+func validDepotPoint(point map[string]float64) bool {
+	latitude, hasLatitude := point["latitude"]
+	longitude, hasLongitude := point["longitude"]
+	return hasLatitude && hasLongitude && latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
+
+// user_role picks the details a user has, user_role_code picks the permissions.
+// Every user starts with the built-in role code, see applyCustomRoleCode.
+func setDefaultRoleCode(user *dto.UserRequestsDTO, roleCode string) {
+	user.RoleCode = roleCode
+}
+
+// A custom role code (see the roles table) replaces the built-in one only when
+// the caller may grant it. user.RoleCode still holds the built-in code here.
+func (handler *userHandler) applyCustomRoleCode(c *fiber.Ctx, user *dto.UserRequestsDTO, requestedRoleCode string) error {
+	if requestedRoleCode == "" || requestedRoleCode == user.RoleCode {
+		return nil
+	}
+
+	roleCode, _ := c.Locals("role_code").(string)
+	if err := handler.permissionService.CheckRoleGrant(roleCode, requestedRoleCode, user.RoleCode); err != nil {
+		return err
+	}
+
+	user.RoleCode = requestedRoleCode
+	return nil
+}
+
 func parseDetails[T any](details json.RawMessage) (T, error) {
 	var parsedDetails T
 
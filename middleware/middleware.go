@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"shuttle/logger"
+	"shuttle/models/entity"
 	"shuttle/utils"
 	"shuttle/services"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -38,58 +40,133 @@ func AuthenticationMiddleware() fiber.Handler {
 			token = token[len(bearerPrefix):]
 		}
 
-		_, exists := utils.InvalidTokens[token]
-		if exists {
-			return utils.UnauthorizedResponse(c, "Invalid token or you have been logged out", nil)
-		}
+		return authenticate(c, token)
+	}
+}
 
-		claims, err := utils.ValidateToken(token)
-		if err != nil {
-			logger.LogWarn("Invalid token", map[string]interface{}{"error": err.Error()})
-			return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+// Browsers can't set headers on a websocket handshake, so the token comes
+// either as the "bearer" subprotocol followed by the token, which keeps it
+// out of access logs, or in the access_token query parameter.
+func WebSocketAuthenticationMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := subprotocolToken(c.Get(fiber.HeaderSecWebSocketProtocol))
+		if token == "" {
+			token = c.Query("access_token")
 		}
-
-		userID, ok := claims["sub"].(string)
-		if !ok || userID == "" {
-			logger.LogWarn("User ID is missing or invalid", map[string]interface{}{"claims": claims})
-			return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+		if token == "" {
+			return utils.UnauthorizedResponse(c, "Missing token", nil)
 		}
 
-		userUUID, ok := claims["user_uuid"].(string)
-		if !ok || userUUID == "" {
-			logger.LogWarn("User UUID is missing or invalid", map[string]interface{}{"claims": claims})
-			return utils.UnauthorizedResponse(c, "Token is invalid", nil)
-		}
+		return authenticate(c, token)
+	}
+}
 
-		role_code, ok := claims["role_code"].(string)
-		if !ok || role_code == "" {
-			logger.LogWarn("Role code is missing or invalid", map[string]interface{}{"claims": claims})
-			return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+// EventSource can't set headers either, the token comes in the Authorization
+// header when the client is able to send it, otherwise in access_token
+func EventStreamAuthenticationMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.Query("access_token")
 		}
-
-		user_name, ok := claims["user_name"].(string)
-		if !ok || user_name == "" {
-			logger.LogWarn("User name is missing or invalid", map[string]interface{}{"claims": claims})
-			return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+		if token == "" {
+			return utils.UnauthorizedResponse(c, "Missing token", nil)
 		}
 
-		c.Locals("userID", userID)
-		c.Locals("userUUID", userUUID)
-		c.Locals("role_code", role_code)
-		c.Locals("user_name", user_name)
+		return authenticate(c, token)
+	}
+}
 
-		return c.Next()
+// Validate the token and expose its claims to the next handlers
+func authenticate(c *fiber.Ctx, token string) error {
+	claims, err := utils.ValidateToken(token)
+	if err != nil {
+		logger.LogWarn("Invalid token", map[string]interface{}{"error": err.Error()})
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	revoked, err := utils.IsTokenRevoked(claims)
+	if err != nil {
+		logger.LogWarn("Failed to check token revocation", map[string]interface{}{"error": err.Error()})
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+	if revoked {
+		return utils.UnauthorizedResponse(c, "Invalid token or you have been logged out", nil)
+	}
+
+	userID, ok := claims["sub"].(string)
+	if !ok || userID == "" {
+		logger.LogWarn("User ID is missing or invalid", map[string]interface{}{"claims": claims})
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
 	}
+
+	userUUID, ok := claims["user_uuid"].(string)
+	if !ok || userUUID == "" {
+		logger.LogWarn("User UUID is missing or invalid", map[string]interface{}{"claims": claims})
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	role_code, ok := claims["role_code"].(string)
+	if !ok || role_code == "" {
+		logger.LogWarn("Role code is missing or invalid", map[string]interface{}{"claims": claims})
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	user_name, ok := claims["user_name"].(string)
+	if !ok || user_name == "" {
+		logger.LogWarn("User name is missing or invalid", map[string]interface{}{"claims": claims})
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	sessionUUID, ok := claims["sid"].(string)
+	if !ok || sessionUUID == "" {
+		logger.LogWarn("Session UUID is missing or invalid", map[string]interface{}{"claims": claims})
+		return utils.UnauthorizedResponse(c, "Token is invalid", nil)
+	}
+
+	c.Locals("userID", userID)
+	c.Locals("userUUID", userUUID)
+	c.Locals("sessionUUID", sessionUUID)
+	c.Locals("role_code", role_code)
+	c.Locals("user_name", user_name)
+
+	return c.Next()
 }
 
-func AuthorizationMiddleware(allowedRoles []string) fiber.Handler {
+// Subprotocols can't carry base64 padding, so it is added back here
+func subprotocolToken(header string) string {
+	protocols := strings.Split(header, ",")
+	if len(protocols) < 2 || strings.TrimSpace(protocols[0]) != "bearer" {
+		return ""
+	}
+
+	token := strings.TrimSpace(protocols[1])
+	if separator := strings.LastIndexByte(token, '.'); separator >= 0 {
+		if padding := (len(token) - separator - 1) % 4; padding > 0 {
+			token += strings.Repeat("=", 4-padding)
+		}
+	}
+
+	return token
+}
+
+func PermissionMiddleware(service services.PermissionService, permission string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		role_code, ok := c.Locals("role_code").(string)
 		if !ok || role_code == "" {
 			return utils.UnauthorizedResponse(c, "Role code is missing or invalid", nil)
 		}
 
-		if !contains(allowedRoles, role_code) {
+		allowed, err := service.HasPermission(role_code, permission)
+		if err != nil {
+			logger.LogError(err, "Failed to check permission", map[string]interface{}{
+				"role_code":  role_code,
+				"permission": permission,
+			})
+			return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+		}
+
+		if !allowed {
 			return utils.ForbiddenResponse(c, "You don't have permission to access this resource", nil)
 		}
 
@@ -97,11 +174,28 @@ func AuthorizationMiddleware(allowedRoles []string) fiber.Handler {
 	}
 }
 
-func contains(slice []string, item string) bool {
-	for _, a := range slice {
-		if a == item {
-			return true
+// Only let the request through when the caller owns the resource in the :id
+// param. Resources that don't exist are passed on so the handler answers 404.
+func OwnershipMiddleware(service services.AccessPolicyService, policy entity.AccessPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userUUID, _ := c.Locals("userUUID").(string)
+		schoolUUID, _ := c.Locals("schoolUUID").(string)
+		resourceUUID := c.Params("id")
+
+		found, allowed, err := service.CheckAccess(policy, resourceUUID, userUUID, schoolUUID)
+		if err != nil {
+			logger.LogError(err, "Failed to check resource ownership", map[string]interface{}{
+				"policy":        policy,
+				"resource_uuid": resourceUUID,
+				"user_uuid":     userUUID,
+			})
+			return utils.InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+		}
+
+		if found && !allowed {
+			return utils.ForbiddenResponse(c, "You don't have access to this resource", nil)
 		}
+
+		return c.Next()
 	}
-	return false
 }
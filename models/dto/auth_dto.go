@@ -1,8 +1,10 @@
 package dto
 
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required"`
+	Email       string `json:"email" validate:"required,email"`
+	Password    string `json:"password" validate:"required"`
+	DeviceLabel string `json:"device_label"`
+	FCMToken    string `json:"fcm_token"`
 }
 
 type UserDataOnLoginDTO struct {
@@ -13,6 +15,27 @@ type UserDataOnLoginDTO struct {
 	Password  string `json:"user_password"`
 }
 
+const (
+	RegisterStatusPending  = "PENDING"
+	RegisterStatusApproved = "APPROVED"
+	RegisterStatusRejected = "REJECTED"
+)
+
 type DeviceTokenRequest struct {
 	Token string `json:"token" validate:"required"`
 }
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Email       string `json:"email" validate:"required,email"`
+	Code        string `json:"code" validate:"required,len=6,numeric"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
@@ -0,0 +1,48 @@
+package dto
+
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+type FleetResponseDTO struct {
+	SchoolUUID   string            `json:"school_uuid"`
+	StatusCounts map[string]int    `json:"status_counts"`
+	Vehicles     []FleetVehicleDTO `json:"vehicles"`
+	GeneratedAt  string            `json:"generated_at"`
+}
+
+type FleetVehicleDTO struct {
+	DriverUUID       string            `json:"driver_uuid"`
+	DriverName       string            `json:"driver_name"`
+	DriverStatus     string            `json:"driver_status"`
+	DriverLastActive string            `json:"driver_last_active"`
+	VehicleUUID      string            `json:"vehicle_uuid"`
+	VehicleName      string            `json:"vehicle_name"`
+	VehicleNumber    string            `json:"vehicle_number"`
+	Active           bool              `json:"active"`
+	StatusCounts     map[string]int    `json:"status_counts"`
+	LastPosition     *FleetPositionDTO `json:"last_position"`
+}
+
+type FleetPositionDTO struct {
+	ShuttleUUID string   `json:"shuttle_uuid"`
+	Latitude    float64  `json:"latitude"`
+	Longitude   float64  `json:"longitude"`
+	Speed       *float64 `json:"speed"`
+	Heading     *float64 `json:"heading"`
+	RecordedAt  string   `json:"recorded_at"`
+	AgeSeconds  int64    `json:"age_seconds"`
+	Stale       bool     `json:"stale"`
+}
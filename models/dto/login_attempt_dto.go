@@ -0,0 +1,12 @@
+package dto
+
+type LoginHistoryResponseDTO struct {
+	ID            int64  `json:"id"`
+	UserUUID      string `json:"user_uuid"`
+	Email         string `json:"email"`
+	IPAddress     string `json:"ip_address"`
+	UserAgent     string `json:"user_agent"`
+	Success       bool   `json:"success"`
+	FailureReason string `json:"failure_reason"`
+	CreatedAt     string `json:"created_at"`
+}
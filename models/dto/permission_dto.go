@@ -0,0 +1,23 @@
+package dto
+
+type RoleRequestDTO struct {
+	Code              string   `json:"role_code" validate:"required,max=5"`
+	Name              string   `json:"role_name" validate:"required,max=100"`
+	Description       string   `json:"role_description"`
+	TwoFactorRequired bool     `json:"two_factor_required"`
+	Permissions       []string `json:"permissions" validate:"required,min=1,dive,required"`
+}
+
+type RoleResponseDTO struct {
+	Code              string   `json:"role_code"`
+	Name              string   `json:"role_name"`
+	Description       string   `json:"role_description"`
+	TwoFactorRequired bool     `json:"two_factor_required"`
+	Permissions       []string `json:"permissions"`
+	CreatedAt         string   `json:"created_at"`
+}
+
+type PermissionResponseDTO struct {
+	Code        string `json:"permission_code"`
+	Description string `json:"permission_description"`
+}
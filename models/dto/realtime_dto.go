@@ -0,0 +1,122 @@
+package dto
+
+import "encoding/json"
+
+// Version of the realtime protocol spoken over /ws. Messages without a type
+// are the bare {longitude, latitude} pings sent before it was introduced.
+const RealtimeProtocolVersion = 1
+
+const (
+	RealtimeTypeSubscribe        = "subscribe"
+	RealtimeTypeUnsubscribe      = "unsubscribe"
+	RealtimeTypeLocation         = "location"
+	RealtimeTypeStatusChanged    = "status_changed"
+	RealtimeTypeETAUpdate        = "eta_update"
+	RealtimeTypeStatusSuggestion = "status_suggestion"
+	RealtimeTypeAnnouncement     = "announcement"
+	RealtimeTypeAck              = "ack"
+	RealtimeTypeError            = "error"
+	RealtimeTypePing             = "ping"
+	RealtimeTypePong             = "pong"
+)
+
+// Every message in both directions. Replies (ack, error, pong) carry the id
+// of the message they answer, server pushes get an id of their own.
+type RealtimeEnvelope struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	ID      string          `json:"id"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Fleet follows every vehicle of the school, only for school admins
+type RealtimeSubscriptionPayload struct {
+	ShuttleUUIDs []string `json:"shuttle_uuids"`
+	Fleet        bool     `json:"fleet,omitempty"`
+}
+
+type RealtimeLocationPayload struct {
+	ShuttleUUID string   `json:"shuttle_uuid"`
+	DriverUUID  string   `json:"driver_uuid,omitempty"`
+	Latitude    float64  `json:"latitude"`
+	Longitude   float64  `json:"longitude"`
+	Speed       *float64 `json:"speed,omitempty"`
+	Heading     *float64 `json:"heading,omitempty"`
+	Accuracy    *float64 `json:"accuracy,omitempty"`
+	Mocked      bool     `json:"mocked,omitempty"`
+	RecordedAt  string   `json:"recorded_at,omitempty"`
+	// Only set on the last known position sent to clients that just subscribed
+	AgeSeconds *int64 `json:"age_seconds,omitempty"`
+	Snapshot   bool   `json:"snapshot,omitempty"`
+}
+
+type RealtimeStatusChangedPayload struct {
+	ShuttleUUID string `json:"shuttle_uuid"`
+	StudentUUID string `json:"student_uuid"`
+	DriverUUID  string `json:"driver_uuid,omitempty"`
+	Status      string `json:"status"`
+	ChangedAt   string `json:"changed_at"`
+	// Set when a geofence changed the status rather than the driver
+	Automatic bool `json:"automatic,omitempty"`
+}
+
+// Sent to the driver when the bus drove into a geofence of a school that
+// wants transitions confirmed. Fence is pickup, school or dropoff, the status
+// is confirmed through the usual shuttle update.
+type RealtimeStatusSuggestionPayload struct {
+	ShuttleUUID string `json:"shuttle_uuid"`
+	StudentUUID string `json:"student_uuid"`
+	StudentName string `json:"student_name"`
+	Status      string `json:"status"`
+	Fence       string `json:"fence"`
+	SuggestedAt string `json:"suggested_at"`
+}
+
+// Stop is where the student is expected next: pickup, school or dropoff
+type RealtimeETAUpdatePayload struct {
+	ShuttleUUID string  `json:"shuttle_uuid"`
+	StudentUUID string  `json:"student_uuid,omitempty"`
+	Stop        string  `json:"stop,omitempty"`
+	StopsAway   int     `json:"stops_away"`
+	ETASeconds  int64   `json:"eta_seconds"`
+	DistanceKm  float64 `json:"distance_km"`
+	ArrivalAt   string  `json:"arrival_at"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+type RealtimeAnnouncementPayload struct {
+	ShuttleUUID string `json:"shuttle_uuid"`
+	SenderUUID  string `json:"sender_uuid,omitempty"`
+	Message     string `json:"message"`
+	SentAt      string `json:"sent_at,omitempty"`
+}
+
+type RealtimeAckPayload struct {
+	Type       string   `json:"type"`
+	Subscribed []string `json:"subscribed,omitempty"`
+	Denied     []string `json:"denied,omitempty"`
+	// The school whose fleet the connection follows
+	Fleet string `json:"fleet,omitempty"`
+}
+
+type RealtimeErrorPayload struct {
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type RealtimeMetricsDTO struct {
+	NodeID            string `json:"node_id"`
+	Connections       int    `json:"connections"`
+	ShuttleGroups     int    `json:"shuttle_groups"`
+	SchoolGroups      int    `json:"school_groups"`
+	QueueCapacity     int    `json:"queue_capacity"`
+	QueuedFrames      int    `json:"queued_frames"`
+	MaxQueueDepth     int    `json:"max_queue_depth"`
+	FramesSent        int64  `json:"frames_sent"`
+	FramesCoalesced   int64  `json:"frames_coalesced"`
+	FramesDropped     int64  `json:"frames_dropped"`
+	SlowConsumerKicks int64  `json:"slow_consumer_kicks"`
+	WriteErrors       int64  `json:"write_errors"`
+	PingsRejected     int64  `json:"pings_rejected"`
+}
@@ -0,0 +1,36 @@
+package dto
+
+type RegisterRequestDTO struct {
+	Username      string `json:"username" validate:"required,username,min=5,max=30"`
+	Email         string `json:"email" validate:"required,email"`
+	Password      string `json:"password" validate:"required,min=8"`
+	Role          Role   `json:"role" validate:"required,role"`
+	FirstName     string `json:"first_name" validate:"required,max=255"`
+	LastName      string `json:"last_name" validate:"required,max=255"`
+	Gender        Gender `json:"gender" validate:"required,gender"`
+	Phone         string `json:"phone" validate:"required,phone"`
+	Address       string `json:"address" validate:"required,max=255"`
+	SchoolUUID    string `json:"school_uuid" validate:"required,uuid"`
+	LicenseNumber string `json:"license_number"`
+}
+
+type RegistrationReviewRequestDTO struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+type RegistrationResponseDTO struct {
+	UUID           string `json:"user_uuid"`
+	Username       string `json:"user_username"`
+	Email          string `json:"user_email"`
+	Role           Role   `json:"user_role"`
+	FirstName      string `json:"user_first_name"`
+	LastName       string `json:"user_last_name"`
+	Phone          string `json:"user_phone"`
+	SchoolUUID     string `json:"school_uuid"`
+	SchoolName     string `json:"school_name"`
+	RegisterStatus string `json:"register_status"`
+	ReviewedBy     string `json:"reviewed_by"`
+	ReviewedAt     string `json:"reviewed_at"`
+	ReviewReason   string `json:"review_reason"`
+	CreatedAt      string `json:"created_at"`
+}
@@ -107,4 +107,85 @@ type RouteAssignmentDTO struct {
 
 type UpdateStudentOrderDTO struct {
 	NewOrder            int    `json:"new_order"`
-}
\ No newline at end of file
+}
+
+type DriverDistanceResponseDTO struct {
+	// Where the driver was last seen, null when no location was received today
+	Start           *RoutePointDTO         `json:"start"`
+	Morning         RouteDirectionDTO      `json:"morning"`
+	Afternoon       RouteDirectionDTO      `json:"afternoon"`
+	SkippedStudents []RoutePointDTO        `json:"skipped_students"`
+}
+
+type RouteDirectionDTO struct {
+	Legs          []RouteLegDTO `json:"legs"`
+	TotalDistance float64       `json:"total_distance"`
+}
+
+type RouteLegDTO struct {
+	From     RoutePointDTO `json:"from"`
+	To       RoutePointDTO `json:"to"`
+	Distance float64       `json:"distance"`
+}
+
+type RoutePointDTO struct {
+	Type      string  `json:"type"`
+	UUID      string  `json:"uuid"`
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Start point replaces the driver's depot for this proposal only
+type RouteOptimizationRequestDTO struct {
+	StartPoint map[string]float64 `json:"start_point"`
+}
+
+type RouteOptimizationDTO struct {
+	RouteNameUUID    string          `json:"route_name_uuid"`
+	Start            *RoutePointDTO  `json:"start"`
+	School           RoutePointDTO   `json:"school"`
+	CurrentOrder     []RoutePointDTO `json:"current_order"`
+	ProposedOrder    []RoutePointDTO `json:"proposed_order"`
+	CurrentDistance  float64         `json:"current_distance"`
+	ProposedDistance float64         `json:"proposed_distance"`
+	SavedDistance    float64         `json:"saved_distance"`
+	// Students without a pickup point, they keep their place after the others
+	SkippedStudents []RoutePointDTO `json:"skipped_students"`
+}
+
+type ApplyRouteOrderRequestDTO struct {
+	StudentUUIDs []string `json:"student_uuids" validate:"required,min=1"`
+}
+
+// Max ride minutes caps how long the first student picked up is on board,
+// ROUTE_PLAN_MAX_RIDE when left out
+type RoutePlanRequestDTO struct {
+	MaxRideMinutes int `json:"max_ride_minutes"`
+}
+
+type RoutePlanDTO struct {
+	School         RoutePointDTO     `json:"school"`
+	MaxRideMinutes int               `json:"max_ride_minutes"`
+	Routes         []PlannedRouteDTO `json:"routes"`
+	// Students no route could take, with the reason: no_pickup_point,
+	// ride_too_long or no_seats_left
+	UnassignedStudents []UnassignedStudentDTO `json:"unassigned_students"`
+}
+
+// Route is the draft to review, it is created as is through /route/add
+type PlannedRouteDTO struct {
+	Route              RoutesRequestDTO `json:"route"`
+	DriverName         string           `json:"driver_name"`
+	VehicleName        string           `json:"vehicle_name"`
+	Capacity           int              `json:"capacity"`
+	Start              *RoutePointDTO   `json:"start"`
+	Stops              []RoutePointDTO  `json:"stops"`
+	Distance           float64          `json:"distance"`
+	LongestRideMinutes float64          `json:"longest_ride_minutes"`
+}
+
+type UnassignedStudentDTO struct {
+	Student RoutePointDTO `json:"student"`
+	Reason  string        `json:"reason"`
+}
@@ -24,3 +24,19 @@ type SchoolResponseDTO struct {
 	UpdatedAt      string `json:"updated_at,omitempty"`
 	UpdatedBy      string `json:"updated_by,omitempty"`
 }
+
+// Radii are in meters, transition_mode is auto or confirm
+type SchoolGeofenceRequestDTO struct {
+	PickupRadius   float64 `json:"pickup_radius" validate:"required"`
+	SchoolRadius   float64 `json:"school_radius" validate:"required"`
+	TransitionMode string  `json:"transition_mode" validate:"required"`
+}
+
+type SchoolGeofenceResponseDTO struct {
+	SchoolUUID     string  `json:"school_uuid"`
+	PickupRadius   float64 `json:"pickup_radius"`
+	SchoolRadius   float64 `json:"school_radius"`
+	TransitionMode string  `json:"transition_mode"`
+	UpdatedAt      string  `json:"updated_at,omitempty"`
+	UpdatedBy      string  `json:"updated_by,omitempty"`
+}
@@ -0,0 +1,12 @@
+package dto
+
+type SessionResponseDTO struct {
+	SessionUUID string `json:"session_uuid"`
+	DeviceLabel string `json:"device_label"`
+	UserAgent   string `json:"user_agent"`
+	IPAddress   string `json:"ip_address"`
+	PushEnabled bool   `json:"push_enabled"`
+	IsCurrent   bool   `json:"is_current"`
+	CreatedAt   string `json:"created_at"`
+	LastSeenAt  string `json:"last_seen_at"`
+}
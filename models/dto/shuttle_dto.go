@@ -18,6 +18,8 @@ type ShuttleResponse struct {
 	ShuttleStatus   string `db:"shuttle_status" json:"shuttle_status"`
 	CreatedAt       string `db:"created_at" json:"created_at"`
 	CurrentDate     string `db:"current_date" json:"current_date"`
+	LastPosition    *RealtimeLocationPayload `db:"-" json:"last_position"`
+	ETA             *RealtimeETAUpdatePayload `db:"-" json:"eta"`
 }
 
 type ShuttleAllResponse struct {
@@ -34,10 +34,13 @@ type SchoolAdminDetailsRequestsDTO struct {
 	SchoolUUID string `json:"school_uuid" validate:"required"`
 }
 
+// DepotPoint is where the driver sets off, in the format of the pickup points.
+// An update without it keeps the stored one.
 type DriverDetailsRequestsDTO struct {
-	SchoolUUID    string `json:"school_uuid"`
-	VehicleUUID   string `json:"vehicle_uuid"`
-	LicenseNumber string `json:"license_number" validate:"required"`
+	SchoolUUID    string             `json:"school_uuid"`
+	VehicleUUID   string             `json:"vehicle_uuid"`
+	LicenseNumber string             `json:"license_number" validate:"required"`
+	DepotPoint    map[string]float64 `json:"depot_point,omitempty"`
 }
 
 type UserResponseDTO struct {
@@ -0,0 +1,19 @@
+package entity
+
+// Ownership rules checked for a single resource, named after the route group
+// and the resource they guard
+type AccessPolicy string
+
+const (
+	PolicyParentStudent AccessPolicy = "parent:student"
+	PolicyParentShuttle AccessPolicy = "parent:shuttle"
+	PolicyDriverStudent AccessPolicy = "driver:student"
+	PolicyDriverShuttle AccessPolicy = "driver:shuttle"
+	PolicySchoolStudent AccessPolicy = "school:student"
+	PolicySchoolDriver  AccessPolicy = "school:driver"
+	PolicySchoolVehicle AccessPolicy = "school:vehicle"
+	PolicySchoolRoute   AccessPolicy = "school:route"
+	PolicySchoolShuttle AccessPolicy = "school:shuttle"
+	PolicyShuttleMember AccessPolicy = "shuttle:member"
+	PolicyShuttleDriver AccessPolicy = "shuttle:driver"
+)
@@ -12,22 +12,43 @@ type UserDataOnLogin struct {
 	Username string `db:"user_username"`
 	RoleCode string `db:"user_role_code"`
 	Password string `db:"user_password"`
+	RegisterStatus string `db:"user_register_status"`
 }
 
 type RefreshToken struct {
-	ID           int64     `db:"id"`
-	UserUUID     uuid.UUID `db:"user_uuid"`
-	RefreshToken string    `db:"refresh_token"`
-	IssuedAt     time.Time `db:"issued_at"`
-	ExpiredAt    time.Time `db:"expired_at"`
-	Revoked      bool      `db:"is_revoked"`
+	ID           int64      `db:"id"`
+	UserUUID     uuid.UUID  `db:"user_uuid"`
+	FamilyUUID   uuid.UUID  `db:"family_uuid"`
+	RefreshToken string     `db:"refresh_token"`
+	IssuedAt     time.Time  `db:"issued_at"`
+	ExpiredAt    time.Time  `db:"expired_at"`
+	Revoked      bool       `db:"is_revoked"`
 	LastUsedAt   *time.Time `db:"last_used_at"`
+	ReplacedBy   *int64     `db:"replaced_by"`
 }
 
 type FCMToken struct {
 	ID          int64     `db:"id"`
 	UserUUID    uuid.UUID `db:"user_uuid"`
+	SessionUUID uuid.UUID `db:"session_uuid"`
 	DeviceToken string    `db:"device_token"`
 	CreatedAt   time.Time `db:"created_at"`
 	UpdateAt    time.Time `db:"updated_at"`
 }
+
+type RevokedToken struct {
+	JTI       string    `db:"jti"`
+	UserUUID  uuid.UUID `db:"user_uuid"`
+	RevokedAt time.Time `db:"revoked_at"`
+	ExpiredAt time.Time `db:"expired_at"`
+}
+
+type PasswordResetCode struct {
+	ID        int64      `db:"id"`
+	UserUUID  uuid.UUID  `db:"user_uuid"`
+	CodeHash  string     `db:"code_hash"`
+	Attempts  int        `db:"attempts"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiredAt time.Time  `db:"expired_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
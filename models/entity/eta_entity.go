@@ -0,0 +1,31 @@
+package entity
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// A student of the driver's route on today's trip, with where they are picked
+// up or dropped off and their school
+type TripStop struct {
+	ShuttleUUID      uuid.UUID       `db:"shuttle_uuid"`
+	StudentUUID      uuid.UUID       `db:"student_uuid"`
+	StudentFirstName string          `db:"student_first_name"`
+	ParentUUID       uuid.UUID       `db:"parent_uuid"`
+	StudentOrder     sql.NullInt64   `db:"student_order"`
+	Status           string          `db:"status"`
+	PickupLatitude   sql.NullFloat64 `db:"pickup_latitude"`
+	PickupLongitude  sql.NullFloat64 `db:"pickup_longitude"`
+	SchoolUUID       uuid.UUID       `db:"school_uuid"`
+	SchoolLatitude   sql.NullFloat64 `db:"school_latitude"`
+	SchoolLongitude  sql.NullFloat64 `db:"school_longitude"`
+}
+
+// Average speed in km/h between two stops
+type SegmentSpeed struct {
+	FromPoint    string  `db:"from_point"`
+	ToPoint      string  `db:"to_point"`
+	AverageSpeed float64 `db:"average_speed"`
+	SampleCount  int     `db:"sample_count"`
+}
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ShuttleLocation struct {
+	ID          int64           `db:"id"`
+	ShuttleUUID uuid.UUID       `db:"shuttle_uuid"`
+	DriverUUID  uuid.UUID       `db:"driver_uuid"`
+	Latitude    float64         `db:"latitude"`
+	Longitude   float64         `db:"longitude"`
+	Speed       sql.NullFloat64 `db:"speed"`
+	Heading     sql.NullFloat64 `db:"heading"`
+	RecordedAt  time.Time       `db:"recorded_at"`
+	CreatedAt   time.Time       `db:"created_at"`
+}
+
+// An active trip whose driver hasn't sent a location since LastSeenAt
+type SilentTrip struct {
+	ShuttleUUID uuid.UUID `db:"shuttle_uuid"`
+	DriverUUID  uuid.UUID `db:"driver_uuid"`
+	StudentUUID uuid.UUID `db:"student_uuid"`
+	ParentUUID  uuid.UUID `db:"parent_uuid"`
+	SchoolUUID  uuid.UUID `db:"school_uuid"`
+	DriverName  string    `db:"driver_name"`
+	LastSeenAt  time.Time `db:"last_seen_at"`
+}
+
+// A driver of the school with the vehicle they drive
+type FleetDriver struct {
+	DriverUUID    uuid.UUID      `db:"driver_uuid"`
+	Username      string         `db:"user_username"`
+	FirstName     sql.NullString `db:"user_first_name"`
+	LastName      sql.NullString `db:"user_last_name"`
+	Status        sql.NullString `db:"user_status"`
+	LastActive    sql.NullTime   `db:"user_last_active"`
+	VehicleUUID   sql.NullString `db:"vehicle_uuid"`
+	VehicleName   sql.NullString `db:"vehicle_name"`
+	VehicleNumber sql.NullString `db:"vehicle_number"`
+}
+
+type ShuttleStatusCount struct {
+	DriverUUID uuid.UUID `db:"driver_uuid"`
+	Status     string    `db:"status"`
+	Count      int       `db:"count"`
+}
@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LoginAttempt struct {
+	ID            int64          `db:"id"`
+	UserUUID      *uuid.UUID     `db:"user_uuid"`
+	Email         string         `db:"email"`
+	IPAddress     sql.NullString `db:"ip_address"`
+	UserAgent     sql.NullString `db:"user_agent"`
+	Success       bool           `db:"success"`
+	FailureReason sql.NullString `db:"failure_reason"`
+	CreatedAt     time.Time      `db:"created_at"`
+}
+
+type LoginThrottle struct {
+	Key          string       `db:"throttle_key"`
+	FailedCount  int          `db:"failed_count"`
+	LastFailedAt time.Time    `db:"last_failed_at"`
+	LockedUntil  sql.NullTime `db:"locked_until"`
+}
+
+type LoginHistoryFilter struct {
+	UserUUID  string
+	Email     string
+	IPAddress string
+	Success   *bool
+}
@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"database/sql"
+)
+
+type AccessRole struct {
+	Code              string         `db:"role_code"`
+	Name              string         `db:"role_name"`
+	Description       sql.NullString `db:"role_description"`
+	TwoFactorRequired bool           `db:"role_two_factor_required"`
+	CreatedAt         sql.NullTime   `db:"created_at"`
+	CreatedBy         sql.NullString `db:"created_by"`
+	UpdatedAt         sql.NullTime   `db:"updated_at"`
+	UpdatedBy         sql.NullString `db:"updated_by"`
+}
+
+type Permission struct {
+	Code        string `db:"permission_code"`
+	Description string `db:"permission_description"`
+}
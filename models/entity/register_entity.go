@@ -0,0 +1,31 @@
+package entity
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+type Registration struct {
+	UUID           uuid.UUID      `db:"user_uuid"`
+	Username       string         `db:"user_username"`
+	Email          string         `db:"user_email"`
+	Role           Role           `db:"user_role"`
+	RoleCode       string         `db:"user_role_code"`
+	RegisterStatus string         `db:"user_register_status"`
+	SchoolUUID     *uuid.UUID     `db:"register_school_uuid"`
+	SchoolName     sql.NullString `db:"school_name"`
+	FirstName      sql.NullString `db:"user_first_name"`
+	LastName       sql.NullString `db:"user_last_name"`
+	Phone          sql.NullString `db:"user_phone"`
+	ReviewedBy     sql.NullString `db:"register_reviewed_by"`
+	ReviewedAt     sql.NullTime   `db:"register_reviewed_at"`
+	ReviewReason   sql.NullString `db:"register_review_reason"`
+	CreatedAt      sql.NullTime   `db:"created_at"`
+}
+
+type RegistrationFilter struct {
+	Status     string
+	RoleCodes  []string
+	SchoolUUID string
+}
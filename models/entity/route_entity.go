@@ -43,4 +43,40 @@ type Routes struct {
 	UpdatedBy           	sql.NullString `db:"updated_by"`
 	DeletedAt           	sql.NullTime   `db:"deleted_at"`
 	DeletedBy           	sql.NullString `db:"deleted_by"`
-}
\ No newline at end of file
+}
+
+// A student the driver picks up with the coordinates of the pickup point and
+// the school, either may be missing when it was never set
+type RouteStop struct {
+	StudentUUID      uuid.UUID       `db:"student_uuid"`
+	StudentFirstName string          `db:"student_first_name"`
+	StudentLastName  string          `db:"student_last_name"`
+	StudentOrder     sql.NullInt64   `db:"student_order"`
+	PickupLatitude   sql.NullFloat64 `db:"pickup_latitude"`
+	PickupLongitude  sql.NullFloat64 `db:"pickup_longitude"`
+	SchoolUUID       uuid.UUID       `db:"school_uuid"`
+	SchoolName       string          `db:"school_name"`
+	SchoolLatitude   sql.NullFloat64 `db:"school_latitude"`
+	SchoolLongitude  sql.NullFloat64 `db:"school_longitude"`
+	DriverUUID       sql.NullString  `db:"driver_uuid"`
+	DepotLatitude    sql.NullFloat64 `db:"depot_latitude"`
+	DepotLongitude   sql.NullFloat64 `db:"depot_longitude"`
+}
+
+// A driver of the school with a vehicle and no route yet
+type AvailableDriver struct {
+	DriverUUID      uuid.UUID       `db:"driver_uuid"`
+	DriverFirstName string          `db:"driver_first_name"`
+	DriverLastName  string          `db:"driver_last_name"`
+	VehicleUUID     uuid.UUID       `db:"vehicle_uuid"`
+	VehicleName     string          `db:"vehicle_name"`
+	DepotLatitude   sql.NullFloat64 `db:"depot_latitude"`
+	DepotLongitude  sql.NullFloat64 `db:"depot_longitude"`
+}
+
+type SchoolLocation struct {
+	SchoolUUID      uuid.UUID       `db:"school_uuid"`
+	SchoolName      string          `db:"school_name"`
+	SchoolLatitude  sql.NullFloat64 `db:"school_latitude"`
+	SchoolLongitude sql.NullFloat64 `db:"school_longitude"`
+}
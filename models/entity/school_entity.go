@@ -22,3 +22,21 @@ type School struct {
 	DeletedAt   sql.NullTime   `db:"deleted_at"`
 	DeletedBy   sql.NullString `db:"deleted_by"`
 }
+
+const (
+	GeofenceModeAuto    = "auto"
+	GeofenceModeConfirm = "confirm"
+
+	// Meters, for schools that never changed their settings
+	DefaultPickupRadius = 100
+	DefaultSchoolRadius = 150
+)
+
+type SchoolGeofence struct {
+	SchoolUUID     uuid.UUID      `db:"school_uuid"`
+	PickupRadius   float64        `db:"pickup_radius"`
+	SchoolRadius   float64        `db:"school_radius"`
+	TransitionMode string         `db:"transition_mode"`
+	UpdatedAt      sql.NullTime   `db:"updated_at"`
+	UpdatedBy      sql.NullString `db:"updated_by"`
+}
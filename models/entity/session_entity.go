@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+type UserSession struct {
+	ID          int64          `db:"session_id"`
+	UUID        uuid.UUID      `db:"session_uuid"`
+	UserUUID    uuid.UUID      `db:"user_uuid"`
+	DeviceLabel sql.NullString `db:"device_label"`
+	UserAgent   sql.NullString `db:"user_agent"`
+	IPAddress   sql.NullString `db:"ip_address"`
+	HasFCMToken bool           `db:"has_fcm_token"`
+	CreatedAt   sql.NullTime   `db:"created_at"`
+	LastSeenAt  sql.NullTime   `db:"last_seen_at"`
+	RevokedAt   sql.NullTime   `db:"revoked_at"`
+	RevokedBy   sql.NullString `db:"revoked_by"`
+}
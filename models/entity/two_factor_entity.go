@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserTwoFactor struct {
+	UserUUID     uuid.UUID    `db:"user_uuid"`
+	Secret       string       `db:"secret"`
+	EnabledAt    sql.NullTime `db:"enabled_at"`
+	LastUsedStep int64        `db:"last_used_step"`
+	CreatedAt    time.Time    `db:"created_at"`
+	UpdatedAt    sql.NullTime `db:"updated_at"`
+}
+
+type RecoveryCode struct {
+	ID        int64      `db:"id"`
+	UserUUID  uuid.UUID  `db:"user_uuid"`
+	CodeHash  string     `db:"code_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
@@ -32,6 +32,10 @@ type User struct {
 	LastActive  sql.NullTime    `db:"user_last_active"`
 	DetailsJSON json.RawMessage `db:"user_details"`
 	RegisterStatus string		`db:"user_register_status"`
+	RegisterSchoolUUID   *uuid.UUID     `db:"register_school_uuid"`
+	RegisterReviewedBy   sql.NullString `db:"register_reviewed_by"`
+	RegisterReviewedAt   sql.NullTime   `db:"register_reviewed_at"`
+	RegisterReviewReason sql.NullString `db:"register_review_reason"`
 	CreatedAt   sql.NullTime    `db:"created_at"`
 	CreatedBy   sql.NullString  `db:"created_by"`
 	UpdatedAt   sql.NullTime    `db:"updated_at"`
@@ -72,14 +76,15 @@ type ParentDetails struct {
 }
 
 type DriverDetails struct {
-	UserUUID      uuid.UUID  `db:"user_uuid"`
-	SchoolUUID    *uuid.UUID `db:"school_uuid"`
-	VehicleUUID   *uuid.UUID `db:"vehicle_uuid"`
-	Picture       string     `db:"user_picture"`
-	FirstName     string     `db:"user_first_name"`
-	LastName      string     `db:"user_last_name"`
-	Gender        Gender     `db:"user_gender"`
-	Phone         string     `db:"user_phone"`
-	Address       string     `db:"user_address"`
-	LicenseNumber string     `db:"user_license_number"`
+	UserUUID      uuid.UUID      `db:"user_uuid"`
+	SchoolUUID    *uuid.UUID     `db:"school_uuid"`
+	VehicleUUID   *uuid.UUID     `db:"vehicle_uuid"`
+	Picture       string         `db:"user_picture"`
+	FirstName     string         `db:"user_first_name"`
+	LastName      string         `db:"user_last_name"`
+	Gender        Gender         `db:"user_gender"`
+	Phone         string         `db:"user_phone"`
+	Address       string         `db:"user_address"`
+	LicenseNumber string         `db:"user_license_number"`
+	DepotPoint    sql.NullString `db:"user_depot_point"`
 }
@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"fmt"
+
+	"shuttle/models/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type AccessPolicyRepositoryInterface interface {
+	CheckOwnership(policy entity.AccessPolicy, resourceUUID, ownerUUID string) (bool, error)
+}
+
+type accessPolicyRepository struct {
+	DB *sqlx.DB
+}
+
+func NewAccessPolicyRepository(DB *sqlx.DB) AccessPolicyRepositoryInterface {
+	return &accessPolicyRepository{
+		DB: DB,
+	}
+}
+
+// Each query returns one row when the resource exists, telling whether it
+// belongs to the owner in $2, and no row when it doesn't exist
+var ownershipQueries = map[entity.AccessPolicy]string{
+	entity.PolicyParentStudent: `
+		SELECT parent_uuid = $2 FROM students
+		WHERE student_uuid = $1 AND deleted_at IS NULL`,
+	entity.PolicyParentShuttle: `
+		SELECT s.parent_uuid = $2 FROM shuttle st
+		JOIN students s ON s.student_uuid = st.student_uuid
+		WHERE st.shuttle_uuid = $1 AND st.deleted_at IS NULL`,
+	entity.PolicyDriverStudent: `
+		SELECT EXISTS(
+			SELECT 1 FROM route_assignment ra
+			WHERE ra.student_uuid = s.student_uuid AND ra.driver_uuid = $2 AND ra.deleted_at IS NULL
+		) FROM students s
+		WHERE s.student_uuid = $1 AND s.deleted_at IS NULL`,
+	entity.PolicyDriverShuttle: `
+		SELECT EXISTS(
+			SELECT 1 FROM route_assignment ra
+			WHERE ra.student_uuid = st.student_uuid AND ra.driver_uuid = $2 AND ra.deleted_at IS NULL
+		) FROM shuttle st
+		WHERE st.shuttle_uuid = $1 AND st.deleted_at IS NULL`,
+	entity.PolicySchoolStudent: `
+		SELECT school_uuid = $2 FROM students
+		WHERE student_uuid = $1 AND deleted_at IS NULL`,
+	entity.PolicySchoolDriver: `
+		SELECT COALESCE(dd.school_uuid = $2, FALSE) FROM driver_details dd
+		JOIN users u ON u.user_uuid = dd.user_uuid
+		WHERE dd.user_uuid = $1 AND u.deleted_at IS NULL`,
+	entity.PolicySchoolVehicle: `
+		SELECT COALESCE(school_uuid = $2, FALSE) FROM vehicles
+		WHERE vehicle_uuid = $1 AND deleted_at IS NULL`,
+	entity.PolicySchoolRoute: `
+		SELECT school_uuid = $2 FROM routes
+		WHERE route_name_uuid = $1 AND deleted_at IS NULL`,
+	entity.PolicySchoolShuttle: `
+		SELECT s.school_uuid = $2 FROM shuttle st
+		JOIN students s ON s.student_uuid = st.student_uuid
+		WHERE st.shuttle_uuid = $1 AND st.deleted_at IS NULL`,
+	entity.PolicyShuttleMember: `
+		SELECT st.driver_uuid = $2 OR s.parent_uuid = $2 OR EXISTS(
+			SELECT 1 FROM school_admin_details sad
+			WHERE sad.user_uuid = $2 AND sad.school_uuid = s.school_uuid
+		) FROM shuttle st
+		JOIN students s ON s.student_uuid = st.student_uuid
+		WHERE st.shuttle_uuid = $1 AND st.deleted_at IS NULL`,
+	entity.PolicyShuttleDriver: `
+		SELECT driver_uuid = $2 FROM shuttle
+		WHERE shuttle_uuid = $1 AND deleted_at IS NULL`,
+}
+
+// Returns sql.ErrNoRows when the resource doesn't exist
+func (r *accessPolicyRepository) CheckOwnership(policy entity.AccessPolicy, resourceUUID, ownerUUID string) (bool, error) {
+	query, ok := ownershipQueries[policy]
+	if !ok {
+		return false, fmt.Errorf("unknown access policy %q", policy)
+	}
+
+	var owned bool
+	if err := r.DB.Get(&owned, query, resourceUUID, ownerUUID); err != nil {
+		return false, err
+	}
+
+	return owned, nil
+}
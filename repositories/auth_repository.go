@@ -1,20 +1,31 @@
 package repositories
 
 import (
-	"context"
 	"shuttle/models/entity"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type AuthRepositoryInterface interface {
 	Login(email string) (entity.UserDataOnLogin, error)
 	CheckRefreshTokenData(userUUID, token string) (entity.RefreshToken, error)
-	DeleteRefreshToken(ctx context.Context, userUUID string) error
 	UpdateUserStatus(userUUID, status string, lastActive time.Time) error
-	UpdateRefreshToken(userUUID, refreshToken string) (time.Time, error)
+	MarkDriverIdle(userUUID string, lastActive time.Time) error
+	RefreshDriverPresence(userUUIDs []string, seenAt time.Time) error
+	MarkStaleDriversOffline(seenBefore time.Time) error
+	RotateRefreshToken(usedTokenID int64, nextToken entity.RefreshToken) (bool, error)
+	RevokeRefreshTokenFamily(familyUUID uuid.UUID) error
 	SaveDeviceToken(tokendata entity.FCMToken) error
+
+	FetchPasswordByUUID(userUUID uuid.UUID) (string, error)
+	UpdatePassword(userUUID uuid.UUID, hashedPassword, updatedBy string) error
+	SavePasswordResetCode(resetCode entity.PasswordResetCode) error
+	FetchActivePasswordResetCode(userUUID uuid.UUID) (entity.PasswordResetCode, error)
+	IncrementPasswordResetAttempts(id int64) error
+	ResetPassword(resetCodeID int64, userUUID uuid.UUID, hashedPassword string) (bool, error)
 }
 
 type authRepository struct {
@@ -31,14 +42,14 @@ func (r *authRepository) Login(email string) (entity.UserDataOnLogin, error) {
 	var user entity.UserDataOnLogin
 	query := `
 		SELECT
-		user_id, user_uuid, user_username, user_role_code, user_password
+		user_id, user_uuid, user_username, user_role_code, user_password, user_register_status
 		FROM users 
 		WHERE user_email = $1 AND deleted_at IS NULL
 	`
 
 	row := r.DB.QueryRow(query, email)
 
-	if err := row.Scan(&user.ID, &user.UUID, &user.Username, &user.RoleCode, &user.Password); err != nil {
+	if err := row.Scan(&user.ID, &user.UUID, &user.Username, &user.RoleCode, &user.Password, &user.RegisterStatus); err != nil {
 		return entity.UserDataOnLogin{}, err
 	}
 
@@ -47,7 +58,7 @@ func (r *authRepository) Login(email string) (entity.UserDataOnLogin, error) {
 
 func (r *authRepository) CheckRefreshTokenData(userUUID, token string) (entity.RefreshToken, error) {
 	query := `
-		SELECT refresh_token, expired_at, is_revoked, last_used_at
+		SELECT id, user_uuid, family_uuid, refresh_token, issued_at, expired_at, is_revoked, last_used_at, replaced_by
 		FROM refresh_tokens 
 		WHERE user_uuid = $1 AND refresh_token = $2
 	`
@@ -63,12 +74,10 @@ func (r *authRepository) CheckRefreshTokenData(userUUID, token string) (entity.R
 
 func SaveRefreshToken(db sqlx.DB, refreshToken entity.RefreshToken) error {
 	query := `
-		INSERT INTO refresh_tokens (id, user_uuid, refresh_token, expired_at)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (user_uuid)
-		DO UPDATE SET refresh_token = $3, issued_at = CURRENT_TIMESTAMP, expired_at = $4, is_revoked = false 
+		INSERT INTO refresh_tokens (id, user_uuid, family_uuid, refresh_token, expired_at)
+		VALUES ($1, $2, $3, $4, $5)
 	`
-	_, err := db.Exec(query, refreshToken.ID, refreshToken.UserUUID, refreshToken.RefreshToken, refreshToken.ExpiredAt)
+	_, err := db.Exec(query, refreshToken.ID, refreshToken.UserUUID, refreshToken.FamilyUUID, refreshToken.RefreshToken, refreshToken.ExpiredAt)
 	if err != nil {
 		return err
 	}
@@ -76,13 +85,14 @@ func SaveRefreshToken(db sqlx.DB, refreshToken entity.RefreshToken) error {
 	return nil
 }
 
-func (r *authRepository) DeleteRefreshToken(ctx context.Context, userUUID string) error {
+func (r *authRepository) UpdateUserStatus(userUUID, status string, lastActive time.Time) error {
 	query := `
-		DELETE FROM refresh_tokens
-		WHERE user_uuid = $1
+		UPDATE users
+		SET user_status = $1, user_last_active = $2
+		WHERE user_uuid = $3
 	`
 
-	_, err := r.DB.ExecContext(ctx, query, userUUID)
+	_, err := r.DB.Exec(query, status, lastActive, userUUID)
 	if err != nil {
 		return err
 	}
@@ -90,14 +100,97 @@ func (r *authRepository) DeleteRefreshToken(ctx context.Context, userUUID string
 	return nil
 }
 
-func (r *authRepository) UpdateUserStatus(userUUID, status string, lastActive time.Time) error {
+// Another node may have seen the driver since, their newer activity wins
+func (r *authRepository) MarkDriverIdle(userUUID string, lastActive time.Time) error {
 	query := `
 		UPDATE users
-		SET user_status = $1, user_last_active = $2
-		WHERE user_uuid = $3
+		SET user_status = 'idle'
+		WHERE user_uuid = $1 AND user_status = 'online' AND user_last_active <= $2
 	`
 
-	_, err := r.DB.Exec(query, status, lastActive, userUUID)
+	_, err := r.DB.Exec(query, userUUID, lastActive)
+	return err
+}
+
+func (r *authRepository) RefreshDriverPresence(userUUIDs []string, seenAt time.Time) error {
+	query := `
+		INSERT INTO driver_presence (user_uuid, seen_at)
+		SELECT UNNEST($1::uuid[]), $2
+		ON CONFLICT (user_uuid) DO UPDATE SET seen_at = EXCLUDED.seen_at
+	`
+
+	_, err := r.DB.Exec(query, pq.Array(userUUIDs), seenAt)
+	return err
+}
+
+// user_last_active is left as it was, it is the last time the driver was active
+func (r *authRepository) MarkStaleDriversOffline(seenBefore time.Time) error {
+	query := `
+		WITH stale AS (
+			DELETE FROM driver_presence
+			WHERE seen_at < $1
+			RETURNING user_uuid
+		)
+		UPDATE users u
+		SET user_status = 'offline'
+		FROM stale
+		WHERE u.user_uuid = stale.user_uuid AND u.user_status IN ('online', 'idle')
+	`
+
+	_, err := r.DB.Exec(query, seenBefore)
+	return err
+}
+
+// Mark a refresh token as used and store its successor in the same family.
+// Returns false when the token was already used or revoked, which means it is being replayed.
+func (r *authRepository) RotateRefreshToken(usedTokenID int64, nextToken entity.RefreshToken) (bool, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	queryInsert := `
+		INSERT INTO refresh_tokens (id, user_uuid, family_uuid, refresh_token, expired_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = tx.Exec(queryInsert, nextToken.ID, nextToken.UserUUID, nextToken.FamilyUUID, nextToken.RefreshToken, nextToken.ExpiredAt)
+	if err != nil {
+		return false, err
+	}
+
+	queryUpdate := `
+		UPDATE refresh_tokens
+		SET last_used_at = NOW(), replaced_by = $1
+		WHERE id = $2 AND last_used_at IS NULL AND is_revoked = false
+	`
+	result, err := tx.Exec(queryUpdate, nextToken.ID, usedTokenID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *authRepository) RevokeRefreshTokenFamily(familyUUID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET is_revoked = true
+		WHERE family_uuid = $1
+	`
+	_, err := r.DB.Exec(query, familyUUID)
 	if err != nil {
 		return err
 	}
@@ -105,44 +198,143 @@ func (r *authRepository) UpdateUserStatus(userUUID, status string, lastActive ti
 	return nil
 }
 
-func (r *authRepository) UpdateRefreshToken(userUUID, refreshToken string) (time.Time, error) {
-	var lastUsedAt time.Time
-	
-	querySelect := `
-		SELECT last_used_at 
-		FROM refresh_tokens 
-		WHERE user_uuid = $1 AND refresh_token = $2
+func (r *authRepository) SaveDeviceToken(tokendata entity.FCMToken) error {
+	query := `
+		INSERT INTO fcm_tokens (id, user_uuid, session_uuid, device_token, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (session_uuid)
+		DO UPDATE SET device_token = $4, updated_at = NOW()
 	`
-	err := r.DB.QueryRow(querySelect, userUUID, refreshToken).Scan(&lastUsedAt)
+	_, err := r.DB.Exec(query, tokendata.ID, tokendata.UserUUID, tokendata.SessionUUID, tokendata.DeviceToken)
 	if err != nil {
-		return time.Time{}, err
+		return err
 	}
 
-	// Query untuk update last_used_at ke NOW()
-	queryUpdate := `
-		UPDATE refresh_tokens
-		SET last_used_at = NOW()
-		WHERE user_uuid = $1 AND refresh_token = $2
+	return nil
+}
+
+func (r *authRepository) FetchPasswordByUUID(userUUID uuid.UUID) (string, error) {
+	var password string
+	query := `SELECT user_password FROM users WHERE user_uuid = $1 AND deleted_at IS NULL`
+	if err := r.DB.Get(&password, query, userUUID); err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
+
+func (r *authRepository) UpdatePassword(userUUID uuid.UUID, hashedPassword, updatedBy string) error {
+	query := `
+		UPDATE users
+		SET user_password = $1, updated_at = NOW(), updated_by = $2
+		WHERE user_uuid = $3 AND deleted_at IS NULL
 	`
-	_, err = r.DB.Exec(queryUpdate, userUUID, refreshToken)
+	_, err := r.DB.Exec(query, hashedPassword, updatedBy, userUUID)
 	if err != nil {
-		return time.Time{}, err
+		return err
 	}
 
-	return lastUsedAt, nil
+	return nil
 }
 
-func (r *authRepository) SaveDeviceToken(tokendata entity.FCMToken) error {
+// Issuing a new code invalidates every code issued before it
+func (r *authRepository) SavePasswordResetCode(resetCode entity.PasswordResetCode) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queryExpire := `
+		UPDATE password_reset_codes
+		SET expired_at = NOW()
+		WHERE user_uuid = $1 AND used_at IS NULL AND expired_at > NOW()
+	`
+	if _, err = tx.Exec(queryExpire, resetCode.UserUUID); err != nil {
+		return err
+	}
+
+	queryInsert := `
+		INSERT INTO password_reset_codes (id, user_uuid, code_hash, created_at, expired_at)
+		VALUES ($1, $2, $3, NOW(), $4)
+	`
+	if _, err = tx.Exec(queryInsert, resetCode.ID, resetCode.UserUUID, resetCode.CodeHash, resetCode.ExpiredAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *authRepository) FetchActivePasswordResetCode(userUUID uuid.UUID) (entity.PasswordResetCode, error) {
+	var resetCode entity.PasswordResetCode
 	query := `
-		INSERT INTO fcm_tokens (id, user_uuid, device_token, created_at)
-		VALUES ($1, $2, $3, NOW())
-		ON CONFLICT (user_uuid)
-		DO UPDATE SET device_token = $2, updated_at = NOW()
+		SELECT id, user_uuid, code_hash, attempts, created_at, expired_at, used_at
+		FROM password_reset_codes
+		WHERE user_uuid = $1 AND used_at IS NULL AND expired_at > NOW()
+		ORDER BY created_at DESC
+		LIMIT 1
 	`
-	_, err := r.DB.Exec(query, tokendata.ID, tokendata.UserUUID, tokendata.DeviceToken)
+	if err := r.DB.Get(&resetCode, query, userUUID); err != nil {
+		return entity.PasswordResetCode{}, err
+	}
+
+	return resetCode, nil
+}
+
+func (r *authRepository) IncrementPasswordResetAttempts(id int64) error {
+	query := `UPDATE password_reset_codes SET attempts = attempts + 1 WHERE id = $1`
+	_, err := r.DB.Exec(query, id)
 	if err != nil {
 		return err
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// Consume the reset code, store the new password and revoke every refresh token.
+// Returns false when the code was consumed by a concurrent request.
+func (r *authRepository) ResetPassword(resetCodeID int64, userUUID uuid.UUID, hashedPassword string) (bool, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	queryConsume := `
+		UPDATE password_reset_codes
+		SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL AND expired_at > NOW()
+	`
+	result, err := tx.Exec(queryConsume, resetCodeID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	queryPassword := `
+		UPDATE users
+		SET user_password = $1, updated_at = NOW(), updated_by = user_username
+		WHERE user_uuid = $2 AND deleted_at IS NULL
+	`
+	if _, err = tx.Exec(queryPassword, hashedPassword, userUUID); err != nil {
+		return false, err
+	}
+
+	queryRevoke := `UPDATE refresh_tokens SET is_revoked = true WHERE user_uuid = $1`
+	if _, err = tx.Exec(queryRevoke, userUUID); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"time"
+
+	"shuttle/models/entity"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type ETARepositoryInterface interface {
+	FetchDriverTripStops(driverUUID uuid.UUID) ([]entity.TripStop, error)
+	FetchSegmentSpeeds(fromPoints []string) ([]entity.SegmentSpeed, error)
+	SaveSegmentSpeed(fromPoint, toPoint string, speed float64) error
+}
+
+type etaRepository struct {
+	DB *sqlx.DB
+}
+
+func NewETARepository(DB *sqlx.DB) ETARepositoryInterface {
+	return &etaRepository{
+		DB: DB,
+	}
+}
+
+// Today's shuttles of the driver's route in student_order, points are stored
+// as {"latitude": ..., "longitude": ...} JSON
+func (r *etaRepository) FetchDriverTripStops(driverUUID uuid.UUID) ([]entity.TripStop, error) {
+	var stops []entity.TripStop
+	query := `
+		SELECT
+			st.shuttle_uuid,
+			ra.student_uuid,
+			s.student_first_name,
+			s.parent_uuid,
+			ra.student_order,
+			st.status::text AS status,
+			(s.student_pickup_point->>'latitude')::float8 AS pickup_latitude,
+			(s.student_pickup_point->>'longitude')::float8 AS pickup_longitude,
+			ra.school_uuid,
+			(sc.school_point->>'latitude')::float8 AS school_latitude,
+			(sc.school_point->>'longitude')::float8 AS school_longitude
+		FROM route_assignment ra
+		JOIN students s ON s.student_uuid = ra.student_uuid
+		JOIN schools sc ON sc.school_uuid = ra.school_uuid
+		JOIN shuttle st ON st.student_uuid = ra.student_uuid
+			AND st.driver_uuid = ra.driver_uuid
+			AND st.deleted_at IS NULL AND st.created_at >= CURRENT_DATE
+		WHERE ra.driver_uuid = $1 AND ra.deleted_at IS NULL
+		ORDER BY ra.student_order ASC NULLS LAST, ra.created_at ASC
+	`
+	if err := r.DB.Select(&stops, query, driverUUID); err != nil {
+		return nil, err
+	}
+
+	return stops, nil
+}
+
+func (r *etaRepository) FetchSegmentSpeeds(fromPoints []string) ([]entity.SegmentSpeed, error) {
+	var speeds []entity.SegmentSpeed
+	query := `
+		SELECT from_point, to_point, average_speed, sample_count
+		FROM route_segment_speeds
+		WHERE from_point = ANY($1)
+	`
+	if err := r.DB.Select(&speeds, query, pq.Array(fromPoints)); err != nil {
+		return nil, err
+	}
+
+	return speeds, nil
+}
+
+// Moving average over roughly the last 20 trips, so a new road works or a
+// new timetable shows up in the ETAs within a few weeks
+func (r *etaRepository) SaveSegmentSpeed(fromPoint, toPoint string, speed float64) error {
+	query := `
+		INSERT INTO route_segment_speeds (id, from_point, to_point, average_speed, sample_count, updated_at)
+		VALUES ($1, $2, $3, $4, 1, NOW())
+		ON CONFLICT (from_point, to_point) DO UPDATE SET
+			average_speed = (route_segment_speeds.average_speed * LEAST(route_segment_speeds.sample_count, 19) + EXCLUDED.average_speed)
+				/ (LEAST(route_segment_speeds.sample_count, 19) + 1),
+			sample_count = route_segment_speeds.sample_count + 1,
+			updated_at = NOW()
+	`
+	id := time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6)
+	_, err := r.DB.Exec(query, id, fromPoint, toPoint, speed)
+	return err
+}
@@ -0,0 +1,269 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"shuttle/models/entity"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type LocationRepositoryInterface interface {
+	SaveLocation(location entity.ShuttleLocation) error
+	FetchShuttleLocations(shuttleUUID uuid.UUID, from, to time.Time) ([]entity.ShuttleLocation, error)
+	FetchDriverLocations(driverUUID uuid.UUID, from, to time.Time) ([]entity.ShuttleLocation, error)
+	FetchLastDriverLocation(driverUUID uuid.UUID, since time.Time) (entity.ShuttleLocation, error)
+	FetchLastShuttleLocation(shuttleUUID uuid.UUID, since time.Time) (entity.ShuttleLocation, error)
+	ClaimSilentTrips(silentSince time.Time) ([]entity.SilentTrip, error)
+	FetchSchoolAdminUUIDs(schoolUUID uuid.UUID) ([]uuid.UUID, error)
+	FetchDriverSchoolUUID(driverUUID uuid.UUID) (string, error)
+	FetchFollowedShuttleUUIDs(userUUID uuid.UUID) ([]string, error)
+	FetchSchoolFleet(schoolUUID uuid.UUID) ([]entity.FleetDriver, error)
+	FetchSchoolLastLocations(schoolUUID uuid.UUID, since time.Time) ([]entity.ShuttleLocation, error)
+	CountSchoolShuttleStatuses(schoolUUID uuid.UUID) ([]entity.ShuttleStatusCount, error)
+	DeleteLocationsBefore(before time.Time, limit int) (int64, error)
+}
+
+type locationRepository struct {
+	DB *sqlx.DB
+}
+
+func NewLocationRepository(DB *sqlx.DB) LocationRepositoryInterface {
+	return &locationRepository{
+		DB: DB,
+	}
+}
+
+func (r *locationRepository) SaveLocation(location entity.ShuttleLocation) error {
+	query := `
+		INSERT INTO shuttle_locations (id, shuttle_uuid, driver_uuid, latitude, longitude, speed, heading, recorded_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+	`
+	_, err := r.DB.Exec(query, location.ID, location.ShuttleUUID, location.DriverUUID, location.Latitude, location.Longitude, location.Speed, location.Heading, location.RecordedAt)
+	return err
+}
+
+func (r *locationRepository) FetchShuttleLocations(shuttleUUID uuid.UUID, from, to time.Time) ([]entity.ShuttleLocation, error) {
+	var locations []entity.ShuttleLocation
+	query := `
+		SELECT id, shuttle_uuid, driver_uuid, latitude, longitude, speed, heading, recorded_at, created_at
+		FROM shuttle_locations
+		WHERE shuttle_uuid = $1 AND recorded_at >= $2 AND recorded_at < $3
+		ORDER BY recorded_at ASC, id ASC
+	`
+	if err := r.DB.Select(&locations, query, shuttleUUID, from, to); err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+func (r *locationRepository) FetchDriverLocations(driverUUID uuid.UUID, from, to time.Time) ([]entity.ShuttleLocation, error) {
+	var locations []entity.ShuttleLocation
+	query := `
+		SELECT id, shuttle_uuid, driver_uuid, latitude, longitude, speed, heading, recorded_at, created_at
+		FROM shuttle_locations
+		WHERE driver_uuid = $1 AND recorded_at >= $2 AND recorded_at < $3
+		ORDER BY recorded_at ASC, id ASC
+	`
+	if err := r.DB.Select(&locations, query, driverUUID, from, to); err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+// Returns sql.ErrNoRows when nothing was recorded since the given time
+func (r *locationRepository) FetchLastShuttleLocation(shuttleUUID uuid.UUID, since time.Time) (entity.ShuttleLocation, error) {
+	var location entity.ShuttleLocation
+	query := `
+		SELECT id, shuttle_uuid, driver_uuid, latitude, longitude, speed, heading, recorded_at, created_at
+		FROM shuttle_locations
+		WHERE shuttle_uuid = $1 AND recorded_at >= $2
+		ORDER BY recorded_at DESC, id DESC
+		LIMIT 1
+	`
+	if err := r.DB.Get(&location, query, shuttleUUID, since); err != nil {
+		return entity.ShuttleLocation{}, err
+	}
+
+	return location, nil
+}
+
+// Returns sql.ErrNoRows when nothing was recorded since the given time
+func (r *locationRepository) FetchLastDriverLocation(driverUUID uuid.UUID, since time.Time) (entity.ShuttleLocation, error) {
+	var location entity.ShuttleLocation
+	query := `
+		SELECT id, shuttle_uuid, driver_uuid, latitude, longitude, speed, heading, recorded_at, created_at
+		FROM shuttle_locations
+		WHERE driver_uuid = $1 AND recorded_at >= $2
+		ORDER BY recorded_at DESC, id DESC
+		LIMIT 1
+	`
+	if err := r.DB.Get(&location, query, driverUUID, since); err != nil {
+		return entity.ShuttleLocation{}, err
+	}
+
+	return location, nil
+}
+
+// Marks and returns today's trips still under way whose driver hasn't sent
+// a location since silentSince. A trip is claimed once per silence, so when
+// several instances run the check only one of them alerts.
+func (r *locationRepository) ClaimSilentTrips(silentSince time.Time) ([]entity.SilentTrip, error) {
+	var trips []entity.SilentTrip
+	query := `
+		WITH active_trips AS (
+			SELECT st.shuttle_id, s.parent_uuid, s.school_uuid, u.user_username AS driver_name,
+				COALESCE(
+					(SELECT MAX(sl.recorded_at) FROM shuttle_locations sl
+					WHERE sl.driver_uuid = st.driver_uuid AND sl.recorded_at >= CURRENT_DATE),
+					st.updated_at, st.created_at
+				) AS last_seen_at
+			FROM shuttle st
+			JOIN students s ON s.student_uuid = st.student_uuid
+			JOIN users u ON u.user_uuid = st.driver_uuid
+			WHERE st.deleted_at IS NULL
+				AND st.status NOT IN ('home', 'at_school')
+				AND st.created_at >= CURRENT_DATE
+		)
+		UPDATE shuttle st
+		SET silent_alerted_at = NOW()
+		FROM active_trips trip
+		WHERE st.shuttle_id = trip.shuttle_id
+			AND trip.last_seen_at < $1
+			AND (st.silent_alerted_at IS NULL OR st.silent_alerted_at < trip.last_seen_at)
+		RETURNING st.shuttle_uuid, st.driver_uuid, st.student_uuid, trip.parent_uuid, trip.school_uuid, trip.driver_name, trip.last_seen_at
+	`
+	if err := r.DB.Select(&trips, query, silentSince); err != nil {
+		return nil, err
+	}
+
+	return trips, nil
+}
+
+func (r *locationRepository) FetchSchoolAdminUUIDs(schoolUUID uuid.UUID) ([]uuid.UUID, error) {
+	var adminUUIDs []uuid.UUID
+	query := `
+		SELECT sad.user_uuid FROM school_admin_details sad
+		JOIN users u ON u.user_uuid = sad.user_uuid
+		WHERE sad.school_uuid = $1 AND u.deleted_at IS NULL
+	`
+	if err := r.DB.Select(&adminUUIDs, query, schoolUUID); err != nil {
+		return nil, err
+	}
+
+	return adminUUIDs, nil
+}
+
+// Empty when the driver isn't assigned to a school
+func (r *locationRepository) FetchDriverSchoolUUID(driverUUID uuid.UUID) (string, error) {
+	var schoolUUID sql.NullString
+	query := `
+		SELECT COALESCE(dd.school_uuid, v.school_uuid)::text
+		FROM driver_details dd
+		LEFT JOIN vehicles v ON v.vehicle_uuid = dd.vehicle_uuid AND v.deleted_at IS NULL
+		WHERE dd.user_uuid = $1
+	`
+	if err := r.DB.Get(&schoolUUID, query, driverUUID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return schoolUUID.String, nil
+}
+
+func (r *locationRepository) FetchSchoolFleet(schoolUUID uuid.UUID) ([]entity.FleetDriver, error) {
+	var drivers []entity.FleetDriver
+	query := `
+		SELECT u.user_uuid AS driver_uuid, u.user_username, dd.user_first_name, dd.user_last_name,
+			u.user_status, u.user_last_active, v.vehicle_uuid::text AS vehicle_uuid, v.vehicle_name, v.vehicle_number
+		FROM driver_details dd
+		JOIN users u ON u.user_uuid = dd.user_uuid
+		LEFT JOIN vehicles v ON v.vehicle_uuid = dd.vehicle_uuid AND v.deleted_at IS NULL
+		WHERE dd.school_uuid = $1 AND u.deleted_at IS NULL
+		ORDER BY dd.user_first_name, dd.user_last_name
+	`
+	if err := r.DB.Select(&drivers, query, schoolUUID); err != nil {
+		return nil, err
+	}
+
+	return drivers, nil
+}
+
+// The latest location of every driver of the school
+func (r *locationRepository) FetchSchoolLastLocations(schoolUUID uuid.UUID, since time.Time) ([]entity.ShuttleLocation, error) {
+	var locations []entity.ShuttleLocation
+	query := `
+		SELECT DISTINCT ON (sl.driver_uuid)
+			sl.id, sl.shuttle_uuid, sl.driver_uuid, sl.latitude, sl.longitude, sl.speed, sl.heading, sl.recorded_at, sl.created_at
+		FROM shuttle_locations sl
+		JOIN driver_details dd ON dd.user_uuid = sl.driver_uuid
+		WHERE dd.school_uuid = $1 AND sl.recorded_at >= $2
+		ORDER BY sl.driver_uuid, sl.recorded_at DESC, sl.id DESC
+	`
+	if err := r.DB.Select(&locations, query, schoolUUID, since); err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+// Today's shuttles of the school by driver and status
+func (r *locationRepository) CountSchoolShuttleStatuses(schoolUUID uuid.UUID) ([]entity.ShuttleStatusCount, error) {
+	var counts []entity.ShuttleStatusCount
+	query := `
+		SELECT st.driver_uuid, st.status::text AS status, COUNT(*) AS count
+		FROM shuttle st
+		JOIN students s ON s.student_uuid = st.student_uuid
+		WHERE s.school_uuid = $1 AND st.deleted_at IS NULL AND st.created_at >= CURRENT_DATE
+		GROUP BY st.driver_uuid, st.status
+	`
+	if err := r.DB.Select(&counts, query, schoolUUID); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// Today's shuttles the user drives or whose student is their child
+func (r *locationRepository) FetchFollowedShuttleUUIDs(userUUID uuid.UUID) ([]string, error) {
+	var shuttleUUIDs []string
+	query := `
+		SELECT st.shuttle_uuid::text
+		FROM shuttle st
+		JOIN students s ON s.student_uuid = st.student_uuid
+		WHERE (s.parent_uuid = $1 OR st.driver_uuid = $1)
+			AND st.deleted_at IS NULL AND st.created_at >= CURRENT_DATE
+		ORDER BY st.created_at
+	`
+	if err := r.DB.Select(&shuttleUUIDs, query, userUUID); err != nil {
+		return nil, err
+	}
+
+	return shuttleUUIDs, nil
+}
+
+// Deletes at most limit pings recorded before the given time. Rows another
+// node is deleting at the same time are skipped.
+func (r *locationRepository) DeleteLocationsBefore(before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM shuttle_locations
+		WHERE id IN (
+			SELECT id FROM shuttle_locations
+			WHERE recorded_at < $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+	result, err := r.DB.Exec(query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
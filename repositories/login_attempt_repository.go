@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"shuttle/models/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type LoginAttemptRepositoryInterface interface {
+	SaveLoginAttempt(attempt entity.LoginAttempt) error
+	FetchLoginThrottles(keys []string) ([]entity.LoginThrottle, error)
+	IncrementFailedLogin(key string, window time.Duration) (int, error)
+	LockLoginThrottle(key string, lockedUntil time.Time) error
+	DeleteLoginThrottle(key string) error
+	FetchLoginHistory(filter entity.LoginHistoryFilter, offset, limit int) ([]entity.LoginAttempt, error)
+	CountLoginHistory(filter entity.LoginHistoryFilter) (int, error)
+}
+
+type loginAttemptRepository struct {
+	DB *sqlx.DB
+}
+
+func NewLoginAttemptRepository(DB *sqlx.DB) LoginAttemptRepositoryInterface {
+	return &loginAttemptRepository{
+		DB: DB,
+	}
+}
+
+func (r *loginAttemptRepository) SaveLoginAttempt(attempt entity.LoginAttempt) error {
+	query := `
+		INSERT INTO login_attempts (id, user_uuid, email, ip_address, user_agent, success, failure_reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+	`
+	_, err := r.DB.Exec(query, attempt.ID, attempt.UserUUID, attempt.Email, attempt.IPAddress, attempt.UserAgent, attempt.Success, attempt.FailureReason)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *loginAttemptRepository) FetchLoginThrottles(keys []string) ([]entity.LoginThrottle, error) {
+	var throttles []entity.LoginThrottle
+	query, args, err := sqlx.In(`
+		SELECT throttle_key, failed_count, last_failed_at, locked_until
+		FROM login_throttles
+		WHERE throttle_key IN (?)
+	`, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.DB.Select(&throttles, r.DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return throttles, nil
+}
+
+// Count a failure atomically, the counter restarts once the previous failure
+// is older than the window. Returns the updated failure count.
+func (r *loginAttemptRepository) IncrementFailedLogin(key string, window time.Duration) (int, error) {
+	var failedCount int
+	query := `
+		INSERT INTO login_throttles (throttle_key, failed_count, last_failed_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			failed_count = CASE
+				WHEN login_throttles.last_failed_at < NOW() - make_interval(secs => $2) THEN 1
+				ELSE login_throttles.failed_count + 1
+			END,
+			last_failed_at = NOW()
+		RETURNING failed_count
+	`
+	if err := r.DB.Get(&failedCount, query, key, window.Seconds()); err != nil {
+		return 0, err
+	}
+
+	return failedCount, nil
+}
+
+func (r *loginAttemptRepository) LockLoginThrottle(key string, lockedUntil time.Time) error {
+	query := `UPDATE login_throttles SET locked_until = $1 WHERE throttle_key = $2`
+	_, err := r.DB.Exec(query, lockedUntil, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *loginAttemptRepository) DeleteLoginThrottle(key string) error {
+	query := `DELETE FROM login_throttles WHERE throttle_key = $1`
+	_, err := r.DB.Exec(query, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *loginAttemptRepository) FetchLoginHistory(filter entity.LoginHistoryFilter, offset, limit int) ([]entity.LoginAttempt, error) {
+	var attempts []entity.LoginAttempt
+
+	whereClause, args := buildLoginHistoryFilter(filter)
+	args = append(args, limit, offset)
+
+	query := fmt.Sprintf(`
+		SELECT id, user_uuid, email, ip_address, user_agent, success, failure_reason, created_at
+		FROM login_attempts
+		%s
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, whereClause, len(args)-1, len(args))
+
+	if err := r.DB.Select(&attempts, query, args...); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func (r *loginAttemptRepository) CountLoginHistory(filter entity.LoginHistoryFilter) (int, error) {
+	var total int
+
+	whereClause, args := buildLoginHistoryFilter(filter)
+	query := `SELECT COUNT(id) FROM login_attempts ` + whereClause
+
+	if err := r.DB.Get(&total, query, args...); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func buildLoginHistoryFilter(filter entity.LoginHistoryFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserUUID != "" {
+		args = append(args, filter.UserUUID)
+		conditions = append(conditions, fmt.Sprintf("user_uuid = $%d", len(args)))
+	}
+	if filter.Email != "" {
+		args = append(args, strings.ToLower(filter.Email))
+		conditions = append(conditions, fmt.Sprintf("email = $%d", len(args)))
+	}
+	if filter.IPAddress != "" {
+		args = append(args, filter.IPAddress)
+		conditions = append(conditions, fmt.Sprintf("ip_address = $%d", len(args)))
+	}
+	if filter.Success != nil {
+		args = append(args, *filter.Success)
+		conditions = append(conditions, fmt.Sprintf("success = $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
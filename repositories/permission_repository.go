@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"shuttle/models/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type PermissionRepositoryInterface interface {
+	FetchPermissionCodesByRole(roleCode string) ([]string, error)
+	FetchAllRoles() ([]entity.AccessRole, error)
+	FetchAllPermissions() ([]entity.Permission, error)
+	CountPermissions(permissionCodes []string) (int, error)
+	CheckRoleExists(roleCode string) (bool, error)
+	SaveRole(role entity.AccessRole, permissionCodes []string) error
+	UpdateRole(role entity.AccessRole, permissionCodes []string) error
+}
+
+type permissionRepository struct {
+	DB *sqlx.DB
+}
+
+func NewPermissionRepository(DB *sqlx.DB) PermissionRepositoryInterface {
+	return &permissionRepository{
+		DB: DB,
+	}
+}
+
+func (r *permissionRepository) FetchPermissionCodesByRole(roleCode string) ([]string, error) {
+	var permissionCodes []string
+	query := `SELECT permission_code FROM role_permissions WHERE role_code = $1`
+	if err := r.DB.Select(&permissionCodes, query, roleCode); err != nil {
+		return nil, err
+	}
+
+	return permissionCodes, nil
+}
+
+func (r *permissionRepository) FetchAllRoles() ([]entity.AccessRole, error) {
+	var roles []entity.AccessRole
+	query := `
+		SELECT role_code, role_name, role_description, role_two_factor_required, created_at, created_by, updated_at, updated_by
+		FROM roles
+		ORDER BY role_code ASC
+	`
+	if err := r.DB.Select(&roles, query); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *permissionRepository) FetchAllPermissions() ([]entity.Permission, error) {
+	var permissions []entity.Permission
+	query := `SELECT permission_code, permission_description FROM permissions ORDER BY permission_code ASC`
+	if err := r.DB.Select(&permissions, query); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (r *permissionRepository) CountPermissions(permissionCodes []string) (int, error) {
+	var count int
+	query, args, err := sqlx.In(`SELECT COUNT(permission_code) FROM permissions WHERE permission_code IN (?)`, permissionCodes)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := r.DB.Get(&count, r.DB.Rebind(query), args...); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *permissionRepository) CheckRoleExists(roleCode string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM roles WHERE role_code = $1)`
+	if err := r.DB.Get(&exists, query, roleCode); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *permissionRepository) SaveRole(role entity.AccessRole, permissionCodes []string) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO roles (role_code, role_name, role_description, role_two_factor_required, created_at, created_by)
+		VALUES ($1, $2, $3, $4, NOW(), $5)
+	`
+	if _, err = tx.Exec(query, role.Code, role.Name, role.Description, role.TwoFactorRequired, role.CreatedBy); err != nil {
+		return err
+	}
+
+	if err = insertRolePermissions(tx, role.Code, permissionCodes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Replace the role's name, description, 2FA requirement and whole permission set
+func (r *permissionRepository) UpdateRole(role entity.AccessRole, permissionCodes []string) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE roles
+		SET role_name = $1, role_description = $2, role_two_factor_required = $3, updated_at = NOW(), updated_by = $4
+		WHERE role_code = $5
+	`
+	if _, err = tx.Exec(query, role.Name, role.Description, role.TwoFactorRequired, role.UpdatedBy, role.Code); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM role_permissions WHERE role_code = $1`, role.Code); err != nil {
+		return err
+	}
+
+	if err = insertRolePermissions(tx, role.Code, permissionCodes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertRolePermissions(tx *sqlx.Tx, roleCode string, permissionCodes []string) error {
+	query := `INSERT INTO role_permissions (role_code, permission_code) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	for _, permissionCode := range permissionCodes {
+		if _, err := tx.Exec(query, roleCode, permissionCode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
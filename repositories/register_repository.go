@@ -1,231 +1,240 @@
 package repositories
 
-// import (
-// 	"encoding/json"
-// 	"fmt"
-// 	"shuttle/models/entity"
-
-// 	"github.com/google/uuid"
-// 	"github.com/jmoiron/sqlx"
-// )
-
-// type RegisterRepositoryInterface interface {
-// 	BeginTransaction() (*sqlx.Tx, error)
-// 	CheckEmailExistForRegister(uuid string, email string) (bool, error)
-// 	CheckUsernameExistForRegister(uuid string, username string) (bool, error)
-// 	GetUserByUUID(userUUID uuid.UUID) (entity.User, error)
-
-// 	SaveUserRegister(tx *sqlx.Tx, userEntity entity.User) (uuid.UUID, error)
-// 	SaveSchoolAdminRegisterDetails(tx *sqlx.Tx, details entity.SchoolAdminDetails, userUUID uuid.UUID, params interface{}) error
-// 	SaveParentRegisterDetails(tx *sqlx.Tx, details entity.ParentDetails, userUUID uuid.UUID, params interface{}) error
-// 	SaveDriverRegisterDetails(tx *sqlx.Tx, details entity.DriverDetails, userUUID uuid.UUID, params interface{}) error
-// 	ApproveUserRegister(username string, userUUID uuid.UUID) error
-// 	SaveSchoolForRegister(school entity.School) (uuid.UUID, error)
-// }
-
-// type registerRepository struct {
-// 	DB *sqlx.DB
-// }
-
-// func NewRegisterRepository(DB *sqlx.DB) RegisterRepositoryInterface {
-// 	return &registerRepository{
-// 		DB: DB,
-// 	}
-// }
-
-// func (r *registerRepository) BeginTransaction() (*sqlx.Tx, error) {
-// 	tx, err := r.DB.Beginx()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	return tx, nil
-// }
-
-// func (r *registerRepository) CheckEmailExistForRegister(uuid string, email string) (bool, error) {
-// 	var count int
-// 	query := `SELECT COUNT(user_id) FROM users WHERE user_email = $1 AND deleted_at IS NULL`
-
-// 	if uuid != "" {
-// 		query += ` AND user_uuid != $2`
-// 		if err := r.DB.Get(&count, query, email, uuid); err != nil {
-// 			return false, err
-// 		}
-// 	} else {
-// 		if err := r.DB.Get(&count, query, email); err != nil {
-// 			return false, err
-// 		}
-// 	}
-
-// 	return count > 0, nil
-// }
-
-// func (r *registerRepository) CheckUsernameExistForRegister(uuid string, username string) (bool, error) {
-// 	var count int
-// 	query := `SELECT COUNT(user_id) FROM users WHERE user_username = $1 AND deleted_at IS NULL`
-
-// 	if uuid != "" {
-// 		query += ` AND user_uuid != $2`
-// 		if err := r.DB.Get(&count, query, username, uuid); err != nil {
-// 			return false, err
-// 		}
-// 	} else {
-// 		if err := r.DB.Get(&count, query, username); err != nil {
-// 			return false, err
-// 		}
-// 	}
-
-// 	return count > 0, nil
-// }
-
-// func (r *registerRepository) GetUserByUUID(userUUID uuid.UUID) (entity.User, error) {
-//     var user entity.User
-//     query := `
-//         SELECT user_uuid, user_username, user_email, user_role, user_role_code, user_register_status 
-//         FROM users 
-//         WHERE user_uuid = $1
-//     `
-//     err := r.DB.Get(&user, query, userUUID)
-//     if err != nil {
-//         return entity.User{}, err
-//     }
-//     return user, nil
-// }
-
-
-// func (r *registerRepository) SaveUserRegister(tx *sqlx.Tx, userEntity entity.User) (uuid.UUID, error) {
-// 	query := `
-// 		INSERT INTO users (user_id, user_uuid, user_username, user_email, user_password, user_role, user_role_code, user_register_status)
-// 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
-// 		RETURNING user_uuid`
-// 	var userUUID uuid.UUID
-// 	err := tx.QueryRow(query, userEntity.ID, userEntity.UUID, userEntity.Username, userEntity.Email, userEntity.Password, userEntity.Role, userEntity.RoleCode, userEntity.RegisterStatus).Scan(&userUUID)
-// 	if err != nil {
-// 		return uuid.Nil, err
-// 	}
-// 	return userUUID, nil
-// }
-
-// func (r *registerRepository) SaveSchoolAdminRegisterDetails(tx *sqlx.Tx, details entity.SchoolAdminDetails, userUUID uuid.UUID, params interface{}) error {
-// 	details.UserUUID = userUUID
-// 	query := `
-//         INSERT INTO school_admin_details 
-//         (user_uuid, school_uuid, user_picture, user_first_name, user_last_name, user_gender, user_phone, user_address) 
-//         VALUES (:user_uuid, :school_uuid, :user_picture, :user_first_name, :user_last_name, :user_gender, :user_phone, :user_address)
-//     `
-// 	params = details
-// 	_, err := tx.NamedExec(query, params)
-// 	return err
-// }
-
-// func (r *registerRepository) SaveParentRegisterDetails(tx *sqlx.Tx, details entity.ParentDetails, userUUID uuid.UUID, params interface{}) error {
-// 	details.UserUUID = userUUID
-// 	query := `
-//         INSERT INTO parent_details 
-//         (user_uuid, user_picture, user_first_name, user_last_name, user_gender, user_phone, user_address) 
-//         VALUES (:user_uuid, :user_picture, :user_first_name, :user_last_name, :user_gender, :user_phone, :user_address)
-//     `
-// 	params = details
-// 	_, err := tx.NamedExec(query, params)
-// 	return err
-// }
-
-// func (r *registerRepository) SaveDriverRegisterDetails(tx *sqlx.Tx, details entity.DriverDetails, userUUID uuid.UUID, params interface{}) error {
-// 	details.UserUUID = userUUID
-
-// 	if details.SchoolUUID == nil || *details.SchoolUUID == uuid.Nil {
-// 		details.SchoolUUID = nil
-// 	}
-// 	if details.VehicleUUID == nil || *details.VehicleUUID == uuid.Nil {
-// 		details.VehicleUUID = nil
-// 	}
-
-// 	query := `
-// 		INSERT INTO driver_details 
-// 		(user_uuid, school_uuid, vehicle_uuid, user_picture, user_first_name, user_last_name, user_gender, user_phone, user_address, user_license_number) 
-// 		VALUES (:user_uuid, :school_uuid, :vehicle_uuid, :user_picture, :user_first_name, :user_last_name, :user_gender, :user_phone, :user_address, :user_license_number)
-// 	`
-// 	params = details
-// 	_, err := tx.NamedExec(query, params)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	if details.VehicleUUID != nil {
-// 		return r.UpdateDriverUUIDOnVehicles(tx, userUUID, *details.VehicleUUID)
-// 	}
-// 	return nil
-// }
-
-// func (r *registerRepository) UpdateDriverUUIDOnVehicles(tx *sqlx.Tx, userUUID uuid.UUID, vehicleUUID uuid.UUID) error {
-// 	var userUUIDParam interface{}
-// 	if userUUID == uuid.Nil {
-// 		userUUIDParam = nil
-// 	} else {
-// 		userUUIDParam = userUUID
-// 	}
-
-// 	query := `
-//         UPDATE vehicles
-//         SET driver_uuid = $1
-//         WHERE vehicle_uuid = $2
-// 		`
-// 	_, err := tx.Exec(query, userUUIDParam, vehicleUUID)
-// 	return err
-// }
-
-// func (r *registerRepository) ApproveUserRegister(username string, userUUID uuid.UUID) error {
-//     query := `
-//         UPDATE users 
-//         SET user_register_status = 'APPROVED', 
-//             approved_by = $1, 
-//             approved_at = NOW() 
-//         WHERE user_uuid = $2 AND user_register_status = 'PENDING'
-//     `
-//     _, err := r.DB.Exec(query, username, userUUID)
-//     return err
-// }
-
-// func (r *registerRepository) SaveSchoolForRegister(school entity.School) (uuid.UUID, error) {
-// 	// Mengonversi Point menjadi JSON string jika valid
-// 	var point string
-// 	if school.Point.Valid {
-// 		// Jika Point ada, kita marshal ke JSON string
-// 		pointBytes, err := json.Marshal(school.Point.String)
-// 		if err != nil {
-// 			return uuid.Nil, fmt.Errorf("gagal mengonversi point ke JSON: %w", err)
-// 		}
-// 		point = string(pointBytes) // Menyimpan sebagai string JSON
-// 	} else {
-// 		point = "" // NULL jika tidak valid
-// 	}
-
-// 	// Query untuk menyimpan data ke dalam tabel schools
-// 	query := `
-// 		INSERT INTO schools (school_id, school_uuid, school_name, school_address, school_contact, school_email, school_description, school_point, created_by)
-// 		VALUES (:school_id, :school_uuid, :school_name, :school_address, :school_contact, :school_email, :school_description, :school_point, :created_by)
-// 		RETURNING school_uuid`
-
-// 	// Menyusun parameter dengan map[string]interface{}
-// 	params := map[string]interface{}{
-// 		"school_id":        school.ID,
-// 		"school_uuid":      school.UUID,
-// 		"school_name":      school.Name,
-// 		"school_address":   school.Address,
-// 		"school_contact":   school.Contact,
-// 		"school_email":     school.Email,
-// 		"school_description": school.Description,
-// 		"school_point":     point, // Menyimpan JSON string
-// 		"created_by":       school.CreatedBy,
-// 	}
-
-// 	// Menggunakan DB Get untuk eksekusi query dan mendapatkan UUID sekolah yang baru
-// 	var newSchoolUUID uuid.UUID
-// 	err := r.DB.Get(&newSchoolUUID, query, params)
-// 	if err != nil {
-// 		return uuid.Nil, fmt.Errorf("gagal menyimpan sekolah: %w", err)
-// 	}
-
-// 	// Mengembalikan UUID dari sekolah yang baru saja disimpan
-// 	return newSchoolUUID, nil
-// }
\ No newline at end of file
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"shuttle/models/entity"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type RegisterRepositoryInterface interface {
+	BeginTransaction() (*sqlx.Tx, error)
+	CheckEmailExistForRegister(email string) (bool, error)
+	CheckUsernameExistForRegister(username string) (bool, error)
+	CheckSchoolExistForRegister(schoolUUID string) (bool, error)
+
+	SaveUserRegister(tx *sqlx.Tx, userEntity entity.User) (uuid.UUID, error)
+	SaveSchoolAdminRegisterDetails(tx *sqlx.Tx, details entity.SchoolAdminDetails) error
+	SaveParentRegisterDetails(tx *sqlx.Tx, details entity.ParentDetails) error
+	SaveDriverRegisterDetails(tx *sqlx.Tx, details entity.DriverDetails) error
+
+	FetchRegistrations(filter entity.RegistrationFilter, offset, limit int) ([]entity.Registration, error)
+	CountRegistrations(filter entity.RegistrationFilter) (int, error)
+	FetchRegistration(userUUID string) (entity.Registration, error)
+	ReviewUserRegister(userUUID uuid.UUID, status, username, reason string) (bool, error)
+}
+
+type registerRepository struct {
+	DB *sqlx.DB
+}
+
+func NewRegisterRepository(DB *sqlx.DB) RegisterRepositoryInterface {
+	return &registerRepository{
+		DB: DB,
+	}
+}
+
+func (r *registerRepository) BeginTransaction() (*sqlx.Tx, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func (r *registerRepository) CheckEmailExistForRegister(email string) (bool, error) {
+	var count int
+	query := `SELECT COUNT(user_id) FROM users WHERE user_email = $1 AND deleted_at IS NULL`
+	if err := r.DB.Get(&count, query, email); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *registerRepository) CheckUsernameExistForRegister(username string) (bool, error) {
+	var count int
+	query := `SELECT COUNT(user_id) FROM users WHERE user_username = $1 AND deleted_at IS NULL`
+	if err := r.DB.Get(&count, query, username); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *registerRepository) CheckSchoolExistForRegister(schoolUUID string) (bool, error) {
+	var count int
+	query := `SELECT COUNT(school_id) FROM schools WHERE school_uuid = $1 AND deleted_at IS NULL`
+	if err := r.DB.Get(&count, query, schoolUUID); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *registerRepository) SaveUserRegister(tx *sqlx.Tx, userEntity entity.User) (uuid.UUID, error) {
+	query := `
+		INSERT INTO users (user_id, user_uuid, user_username, user_email, user_password, user_role, user_role_code, user_register_status, register_school_uuid, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING user_uuid`
+	var userUUID uuid.UUID
+	err := tx.QueryRow(query, userEntity.ID, userEntity.UUID, userEntity.Username, userEntity.Email, userEntity.Password, userEntity.Role, userEntity.RoleCode, userEntity.RegisterStatus, userEntity.RegisterSchoolUUID, userEntity.CreatedBy).Scan(&userUUID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return userUUID, nil
+}
+
+// The school is written by ReviewUserRegister once the admin is approved
+func (r *registerRepository) SaveSchoolAdminRegisterDetails(tx *sqlx.Tx, details entity.SchoolAdminDetails) error {
+	query := `
+        INSERT INTO school_admin_details 
+        (user_uuid, user_picture, user_first_name, user_last_name, user_gender, user_phone, user_address) 
+        VALUES (:user_uuid, :user_picture, :user_first_name, :user_last_name, :user_gender, :user_phone, :user_address)
+    `
+	_, err := tx.NamedExec(query, details)
+	return err
+}
+
+func (r *registerRepository) SaveParentRegisterDetails(tx *sqlx.Tx, details entity.ParentDetails) error {
+	query := `
+        INSERT INTO parent_details 
+        (user_uuid, user_picture, user_first_name, user_last_name, user_gender, user_phone, user_address) 
+        VALUES (:user_uuid, :user_picture, :user_first_name, :user_last_name, :user_gender, :user_phone, :user_address)
+    `
+	_, err := tx.NamedExec(query, details)
+	return err
+}
+
+// Vehicles are assigned by an admin after approval, an applicant never
+// picks one for themselves. The school is written by ReviewUserRegister.
+func (r *registerRepository) SaveDriverRegisterDetails(tx *sqlx.Tx, details entity.DriverDetails) error {
+	query := `
+		INSERT INTO driver_details 
+		(user_uuid, user_picture, user_first_name, user_last_name, user_gender, user_phone, user_address, user_license_number) 
+		VALUES (:user_uuid, :user_picture, :user_first_name, :user_last_name, :user_gender, :user_phone, :user_address, :user_license_number)
+	`
+	_, err := tx.NamedExec(query, details)
+	return err
+}
+
+const registrationSelect = `
+	SELECT
+		u.user_uuid, u.user_username, u.user_email, u.user_role, u.user_role_code, u.user_register_status,
+		u.register_school_uuid, s.school_name,
+		COALESCE(sad.user_first_name, pd.user_first_name, dd.user_first_name) AS user_first_name,
+		COALESCE(sad.user_last_name, pd.user_last_name, dd.user_last_name) AS user_last_name,
+		COALESCE(sad.user_phone, pd.user_phone, dd.user_phone) AS user_phone,
+		u.register_reviewed_by, u.register_reviewed_at, u.register_review_reason, u.created_at
+	FROM users u
+	LEFT JOIN schools s ON s.school_uuid = u.register_school_uuid
+	LEFT JOIN school_admin_details sad ON sad.user_uuid = u.user_uuid
+	LEFT JOIN parent_details pd ON pd.user_uuid = u.user_uuid
+	LEFT JOIN driver_details dd ON dd.user_uuid = u.user_uuid
+`
+
+func (r *registerRepository) FetchRegistrations(filter entity.RegistrationFilter, offset, limit int) ([]entity.Registration, error) {
+	var registrations []entity.Registration
+
+	whereClause, args := buildRegistrationFilter(filter)
+	args = append(args, limit, offset)
+
+	query := fmt.Sprintf(`%s %s
+		ORDER BY u.created_at ASC
+		LIMIT $%d OFFSET $%d
+	`, registrationSelect, whereClause, len(args)-1, len(args))
+
+	if err := r.DB.Select(&registrations, query, args...); err != nil {
+		return nil, err
+	}
+
+	return registrations, nil
+}
+
+func (r *registerRepository) CountRegistrations(filter entity.RegistrationFilter) (int, error) {
+	var total int
+
+	whereClause, args := buildRegistrationFilter(filter)
+	query := `SELECT COUNT(u.user_id) FROM users u ` + whereClause
+
+	if err := r.DB.Get(&total, query, args...); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func (r *registerRepository) FetchRegistration(userUUID string) (entity.Registration, error) {
+	var registration entity.Registration
+
+	query := registrationSelect + `WHERE u.user_uuid = $1 AND u.deleted_at IS NULL AND u.register_school_uuid IS NOT NULL`
+	if err := r.DB.Get(&registration, query, userUUID); err != nil {
+		return entity.Registration{}, err
+	}
+
+	return registration, nil
+}
+
+// Only a pending registration can be reviewed, so two reviewers acting at the
+// same time can't overwrite each other's decision. Drivers and school admins
+// are linked to the school only once approved, until then no school list or
+// lookup sees them.
+func (r *registerRepository) ReviewUserRegister(userUUID uuid.UUID, status, username, reason string) (bool, error) {
+	query := `
+		WITH reviewed AS (
+			UPDATE users
+			SET user_register_status = $1,
+				register_reviewed_by = $2,
+				register_reviewed_at = NOW(),
+				register_review_reason = $3,
+				updated_at = NOW(),
+				updated_by = $2
+			WHERE user_uuid = $4 AND user_register_status = 'PENDING' AND deleted_at IS NULL
+			RETURNING user_uuid, user_register_status, register_school_uuid
+		), linked AS (
+			UPDATE driver_details dd
+			SET school_uuid = reviewed.register_school_uuid
+			FROM reviewed
+			WHERE dd.user_uuid = reviewed.user_uuid AND reviewed.user_register_status = 'APPROVED'
+		), linked_admin AS (
+			UPDATE school_admin_details sad
+			SET school_uuid = reviewed.register_school_uuid
+			FROM reviewed
+			WHERE sad.user_uuid = reviewed.user_uuid AND reviewed.user_register_status = 'APPROVED'
+		)
+		SELECT COUNT(*) FROM reviewed
+	`
+	var reviewed int
+	if err := r.DB.Get(&reviewed, query, status, username, sql.NullString{String: reason, Valid: reason != ""}, userUUID); err != nil {
+		return false, err
+	}
+
+	return reviewed > 0, nil
+}
+
+func buildRegistrationFilter(filter entity.RegistrationFilter) (string, []interface{}) {
+	// Accounts created by an admin have no registration school and are never listed here
+	conditions := []string{"u.deleted_at IS NULL", "u.register_school_uuid IS NOT NULL"}
+	var args []interface{}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("u.user_register_status = $%d", len(args)))
+	}
+	if len(filter.RoleCodes) > 0 {
+		args = append(args, pq.Array(filter.RoleCodes))
+		conditions = append(conditions, fmt.Sprintf("u.user_role_code = ANY($%d)", len(args)))
+	}
+	if filter.SchoolUUID != "" {
+		args = append(args, filter.SchoolUUID)
+		conditions = append(conditions, fmt.Sprintf("u.register_school_uuid = $%d", len(args)))
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
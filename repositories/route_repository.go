@@ -16,6 +16,11 @@ import (
 type RouteRepositoryInterface interface {
 	CountRoutesBySchool(schoolUUID string) (int, error)
 	CalculateTotalDistance(driverStart [2]float64, students [][2]float64, school [2]float64) float64
+	FetchDriverRouteStops(driverUUID string) ([]entity.RouteStop, error)
+	FetchRouteStops(routeNameUUID, schoolUUID string) ([]entity.RouteStop, error)
+	ApplyRouteOrder(routeNameUUID, schoolUUID string, studentUUIDs []string, username string) error
+	FetchAvailableDrivers(schoolUUID string) ([]entity.AvailableDriver, error)
+	FetchSchoolLocation(schoolUUID string) (entity.SchoolLocation, error)
 
 	FetchAllRoutesByAS(offset, limit int, sortField, sortDirection, schoolUUID string) ([]dto.RoutesResponseDTO, error)
 	FetchAllRouteAssignments(page, limit int) ([]dto.RoutesResponseDTO, int, error)
@@ -84,7 +89,7 @@ func (r *routeRepository) CalculateTotalDistance(driverStart [2]float64, student
 	for _, student := range students {
 		start := haversine.Coord{Lat: currentLocation[0], Lon: currentLocation[1]}
 		end := haversine.Coord{Lat: student[0], Lon: student[1]}
-		distance, _ := haversine.Distance(start, end)
+		_, distance := haversine.Distance(start, end)
 
 		totalDistance += distance
 		currentLocation = student // Update lokasi saat ini ke lokasi siswa yang baru
@@ -93,21 +98,143 @@ func (r *routeRepository) CalculateTotalDistance(driverStart [2]float64, student
 	// Hitung jarak dari siswa terakhir ke sekolah
 	start := haversine.Coord{Lat: currentLocation[0], Lon: currentLocation[1]}
 	end := haversine.Coord{Lat: school[0], Lon: school[1]}
-	distance, _ := haversine.Distance(start, end)
+	_, distance := haversine.Distance(start, end)
 	totalDistance += distance
 
-	// Mengonversi meter ke kilometer
-	totalDistanceInKm := totalDistance / 1000 // hasil dalam kilometer
+	// Nilai pertama haversine.Distance adalah mil, yang kedua kilometer
+	return totalDistance
+}
+
+// The present students of the driver in pickup order, points are stored as
+// {"latitude": ..., "longitude": ...} JSON
+func (r *routeRepository) FetchDriverRouteStops(driverUUID string) ([]entity.RouteStop, error) {
+	query := `
+		SELECT
+			r.student_uuid,
+			s.student_first_name,
+			s.student_last_name,
+			r.student_order,
+			(s.student_pickup_point->>'latitude')::float8 AS pickup_latitude,
+			(s.student_pickup_point->>'longitude')::float8 AS pickup_longitude,
+			r.school_uuid,
+			sc.school_name,
+			(sc.school_point->>'latitude')::float8 AS school_latitude,
+			(sc.school_point->>'longitude')::float8 AS school_longitude
+		FROM route_assignment r
+		JOIN students s ON r.student_uuid = s.student_uuid
+		JOIN schools sc ON r.school_uuid = sc.school_uuid
+		WHERE r.driver_uuid = $1 AND r.deleted_at IS NULL AND s.student_status = 'present'
+		ORDER BY r.student_order ASC NULLS LAST, r.created_at ASC
+	`
+	var stops []entity.RouteStop
+	if err := r.DB.Select(&stops, query, driverUUID); err != nil {
+		return nil, err
+	}
+	return stops, nil
+}
+
+
+
+// Every student of the route in its current order, with the depot of the
+// route's driver
+func (r *routeRepository) FetchRouteStops(routeNameUUID, schoolUUID string) ([]entity.RouteStop, error) {
+	query := `
+		SELECT
+			ra.student_uuid,
+			s.student_first_name,
+			s.student_last_name,
+			ra.student_order,
+			(s.student_pickup_point->>'latitude')::float8 AS pickup_latitude,
+			(s.student_pickup_point->>'longitude')::float8 AS pickup_longitude,
+			ra.school_uuid,
+			sc.school_name,
+			(sc.school_point->>'latitude')::float8 AS school_latitude,
+			(sc.school_point->>'longitude')::float8 AS school_longitude,
+			ra.driver_uuid::text AS driver_uuid,
+			(d.user_depot_point->>'latitude')::float8 AS depot_latitude,
+			(d.user_depot_point->>'longitude')::float8 AS depot_longitude
+		FROM route_assignment ra
+		JOIN students s ON ra.student_uuid = s.student_uuid
+		JOIN schools sc ON ra.school_uuid = sc.school_uuid
+		LEFT JOIN driver_details d ON ra.driver_uuid = d.user_uuid
+		WHERE ra.route_name_uuid = $1 AND ra.school_uuid = $2 AND ra.deleted_at IS NULL
+		ORDER BY ra.student_order ASC NULLS LAST, ra.created_at ASC
+	`
+	var stops []entity.RouteStop
+	if err := r.DB.Select(&stops, query, routeNameUUID, schoolUUID); err != nil {
+		return nil, err
+	}
+	return stops, nil
+}
+
+// Numbers the students from 1 in the given order, in a single transaction
+func (r *routeRepository) ApplyRouteOrder(routeNameUUID, schoolUUID string, studentUUIDs []string, username string) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
 
-	// Print atau debug hasil sementara untuk memastikan
-	fmt.Printf("Total distance (in meters): %f\n", totalDistance)
-	fmt.Printf("Total distance (in kilometers): %f\n", totalDistanceInKm)
+	query := `
+		UPDATE route_assignment
+		SET student_order = $1, updated_at = NOW(), updated_by = $2
+		WHERE route_name_uuid = $3 AND school_uuid = $4 AND student_uuid = $5 AND deleted_at IS NULL
+	`
+	for i, studentUUID := range studentUUIDs {
+		if _, err := tx.Exec(query, i+1, username, routeNameUUID, schoolUUID, studentUUID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
 
-	// Mengembalikan hasil dengan dua angka desimal
-	return totalDistanceInKm
+	return tx.Commit()
 }
 
+// Drivers of the school that drive a vehicle and aren't on a route yet, the
+// same drivers AddRoute accepts
+func (r *routeRepository) FetchAvailableDrivers(schoolUUID string) ([]entity.AvailableDriver, error) {
+	query := `
+		SELECT
+			d.user_uuid AS driver_uuid,
+			COALESCE(d.user_first_name, '') AS driver_first_name,
+			COALESCE(d.user_last_name, '') AS driver_last_name,
+			v.vehicle_uuid,
+			v.vehicle_name,
+			(d.user_depot_point->>'latitude')::float8 AS depot_latitude,
+			(d.user_depot_point->>'longitude')::float8 AS depot_longitude
+		FROM driver_details d
+		JOIN users u ON d.user_uuid = u.user_uuid AND u.deleted_at IS NULL
+		JOIN vehicles v ON v.driver_uuid = d.user_uuid AND v.deleted_at IS NULL
+		WHERE d.school_uuid = $1
+			AND NOT EXISTS (
+				SELECT 1
+				FROM route_assignment ra
+				WHERE ra.driver_uuid = d.user_uuid AND ra.deleted_at IS NULL
+			)
+		ORDER BY d.user_first_name ASC
+	`
+	var drivers []entity.AvailableDriver
+	if err := r.DB.Select(&drivers, query, schoolUUID); err != nil {
+		return nil, err
+	}
+	return drivers, nil
+}
 
+func (r *routeRepository) FetchSchoolLocation(schoolUUID string) (entity.SchoolLocation, error) {
+	query := `
+		SELECT
+			school_uuid,
+			school_name,
+			(school_point->>'latitude')::float8 AS school_latitude,
+			(school_point->>'longitude')::float8 AS school_longitude
+		FROM schools
+		WHERE school_uuid = $1 AND deleted_at IS NULL
+	`
+	var school entity.SchoolLocation
+	if err := r.DB.Get(&school, query, schoolUUID); err != nil {
+		return entity.SchoolLocation{}, err
+	}
+	return school, nil
+}
 
 func (r *routeRepository) FetchAllRoutesByAS(offset, limit int, sortField, sortDirection, schoolUUID string) ([]dto.RoutesResponseDTO, error) {
 	query := fmt.Sprintf(`
@@ -542,7 +669,7 @@ func (r *routeRepository) AddStudentToRoute(assignment *entity.RouteAssignment)
 
 func (r *routeRepository) UpdateStudentOrder(routeNameUUID string, assignment *entity.RouteAssignment, studentUUID string) error {
     log.Println("Updating student order for RouteNameUUID:", assignment.RouteNameUUID)
-    log.Printf("New student order: %d, routeNameUUID: %s, studentUUID: %s\n", assignment.StudentOrder, routeNameUUID, studentUUID)
+    log.Printf("New student order: %s, routeNameUUID: %s, studentUUID: %s\n", assignment.StudentOrder, routeNameUUID, studentUUID)
 
     query := `
         UPDATE route_assignment
@@ -602,20 +729,24 @@ func (repo *routeRepository) UpdateStudentOrderByDriver(studentUUID string, newO
 		return fmt.Errorf("student_uuid not found")
 	}
 
-	// Get the current order of the student
-	var currentOrder int
-	err = tx.Get(&currentOrder, "SELECT student_order FROM route_assignment WHERE student_uuid = $1", studentUUID)
+	// Get the current order of the student and the route it belongs to
+	var assignment struct {
+		CurrentOrder  int    `db:"student_order"`
+		RouteNameUUID string `db:"route_name_uuid"`
+	}
+	err = tx.Get(&assignment, "SELECT student_order, route_name_uuid FROM route_assignment WHERE student_uuid = $1 AND deleted_at IS NULL", studentUUID)
 	if err != nil {
 		tx.Rollback()
 		log.Println("Error getting current student order:", err)
 		return err
 	}
+	currentOrder := assignment.CurrentOrder
 
-	// Shift the orders of other students
+	// Shift the orders of the other students on the same route only
 	if newOrder < currentOrder {
-		_, err = tx.Exec("UPDATE route_assignment SET student_order = student_order + 1 WHERE student_order >= $1 AND student_order < $2", newOrder, currentOrder)
+		_, err = tx.Exec("UPDATE route_assignment SET student_order = student_order + 1 WHERE route_name_uuid = $1 AND student_order >= $2 AND student_order < $3 AND deleted_at IS NULL", assignment.RouteNameUUID, newOrder, currentOrder)
 	} else {
-		_, err = tx.Exec("UPDATE route_assignment SET student_order = student_order - 1 WHERE student_order > $1 AND student_order <= $2", currentOrder, newOrder)
+		_, err = tx.Exec("UPDATE route_assignment SET student_order = student_order - 1 WHERE route_name_uuid = $1 AND student_order > $2 AND student_order <= $3 AND deleted_at IS NULL", assignment.RouteNameUUID, currentOrder, newOrder)
 	}
 	if err != nil {
 		tx.Rollback()
@@ -624,7 +755,7 @@ func (repo *routeRepository) UpdateStudentOrderByDriver(studentUUID string, newO
 	}
 
 	// Update the student's order
-	_, err = tx.Exec("UPDATE route_assignment SET student_order = $1 WHERE student_uuid = $2", newOrder, studentUUID)
+	_, err = tx.Exec("UPDATE route_assignment SET student_order = $1 WHERE student_uuid = $2 AND deleted_at IS NULL", newOrder, studentUUID)
 	if err != nil {
 		tx.Rollback()
 		log.Println("Error updating student order:", err)
@@ -17,6 +17,8 @@ type SchoolRepositoryInterface interface {
 	UpdateSchool(entity.School) error
 	DeleteSchool(entity.School) error
 	CountSchools() (int, error)
+	FetchSchoolGeofence(schoolUUID uuid.UUID) (entity.SchoolGeofence, error)
+	SaveSchoolGeofence(geofence entity.SchoolGeofence) error
 }
 
 type schoolRepository struct {
@@ -294,3 +296,43 @@ func (repositories *schoolRepository) CountSchools() (int, error) {
 
 	return total, nil
 }
+
+// Schools that never saved their settings get the defaults
+func (r *schoolRepository) FetchSchoolGeofence(schoolUUID uuid.UUID) (entity.SchoolGeofence, error) {
+	var geofence entity.SchoolGeofence
+	query := `
+		SELECT
+			s.school_uuid,
+			COALESCE(g.pickup_radius, $2) AS pickup_radius,
+			COALESCE(g.school_radius, $3) AS school_radius,
+			COALESCE(g.transition_mode, $4) AS transition_mode,
+			g.updated_at,
+			g.updated_by
+		FROM schools s
+		LEFT JOIN school_geofences g ON g.school_uuid = s.school_uuid
+		WHERE s.school_uuid = $1 AND s.deleted_at IS NULL
+	`
+	if err := r.DB.Get(&geofence, query, schoolUUID, entity.DefaultPickupRadius, entity.DefaultSchoolRadius, entity.GeofenceModeConfirm); err != nil {
+		return entity.SchoolGeofence{}, err
+	}
+
+	return geofence, nil
+}
+
+func (r *schoolRepository) SaveSchoolGeofence(geofence entity.SchoolGeofence) error {
+	query := `
+		INSERT INTO school_geofences (school_uuid, pickup_radius, school_radius, transition_mode, updated_at, updated_by)
+		VALUES (:school_uuid, :pickup_radius, :school_radius, :transition_mode, NOW(), :updated_by)
+		ON CONFLICT (school_uuid) DO UPDATE SET
+			pickup_radius = EXCLUDED.pickup_radius,
+			school_radius = EXCLUDED.school_radius,
+			transition_mode = EXCLUDED.transition_mode,
+			updated_at = EXCLUDED.updated_at,
+			updated_by = EXCLUDED.updated_by`
+	_, err := r.DB.NamedExec(query, geofence)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"shuttle/models/entity"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type SessionRepositoryInterface interface {
+	SaveSession(session entity.UserSession, fcmToken entity.FCMToken) error
+	FetchActiveSessions(userUUID uuid.UUID) ([]entity.UserSession, error)
+	FetchActiveSession(userUUID, sessionUUID uuid.UUID) (entity.UserSession, error)
+	TouchSession(sessionUUID uuid.UUID) error
+	RevokeSessions(userUUID uuid.UUID, sessionUUIDs []uuid.UUID, revokedBy string) error
+}
+
+type sessionRepository struct {
+	DB *sqlx.DB
+}
+
+func NewSessionRepository(DB *sqlx.DB) SessionRepositoryInterface {
+	return &sessionRepository{
+		DB: DB,
+	}
+}
+
+func (r *sessionRepository) SaveSession(session entity.UserSession, fcmToken entity.FCMToken) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO user_sessions (session_id, session_uuid, user_uuid, device_label, user_agent, ip_address, created_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+	`
+	_, err = tx.Exec(query, session.ID, session.UUID, session.UserUUID, session.DeviceLabel, session.UserAgent, session.IPAddress)
+	if err != nil {
+		return err
+	}
+
+	if fcmToken.DeviceToken != "" {
+		queryToken := `
+			INSERT INTO fcm_tokens (id, user_uuid, session_uuid, device_token, created_at)
+			VALUES ($1, $2, $3, $4, NOW())
+		`
+		_, err = tx.Exec(queryToken, fcmToken.ID, fcmToken.UserUUID, fcmToken.SessionUUID, fcmToken.DeviceToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *sessionRepository) FetchActiveSessions(userUUID uuid.UUID) ([]entity.UserSession, error) {
+	var sessions []entity.UserSession
+	query := `
+		SELECT s.session_id, s.session_uuid, s.user_uuid, s.device_label, s.user_agent, s.ip_address,
+			f.id IS NOT NULL AS has_fcm_token, s.created_at, s.last_seen_at, s.revoked_at, s.revoked_by
+		FROM user_sessions s
+		LEFT JOIN fcm_tokens f ON f.session_uuid = s.session_uuid
+		WHERE s.user_uuid = $1 AND s.revoked_at IS NULL
+		ORDER BY s.last_seen_at DESC NULLS LAST
+	`
+	if err := r.DB.Select(&sessions, query, userUUID); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (r *sessionRepository) FetchActiveSession(userUUID, sessionUUID uuid.UUID) (entity.UserSession, error) {
+	var session entity.UserSession
+	query := `
+		SELECT s.session_id, s.session_uuid, s.user_uuid, s.device_label, s.user_agent, s.ip_address,
+			f.id IS NOT NULL AS has_fcm_token, s.created_at, s.last_seen_at, s.revoked_at, s.revoked_by
+		FROM user_sessions s
+		LEFT JOIN fcm_tokens f ON f.session_uuid = s.session_uuid
+		WHERE s.user_uuid = $1 AND s.session_uuid = $2 AND s.revoked_at IS NULL
+	`
+	if err := r.DB.Get(&session, query, userUUID, sessionUUID); err != nil {
+		return entity.UserSession{}, err
+	}
+
+	return session, nil
+}
+
+func (r *sessionRepository) TouchSession(sessionUUID uuid.UUID) error {
+	query := `UPDATE user_sessions SET last_seen_at = NOW() WHERE session_uuid = $1`
+	_, err := r.DB.Exec(query, sessionUUID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Revoke sessions together with their refresh token families and device tokens
+func (r *sessionRepository) RevokeSessions(userUUID uuid.UUID, sessionUUIDs []uuid.UUID, revokedBy string) error {
+	if len(sessionUUIDs) == 0 {
+		return nil
+	}
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, args, err := sqlx.In(`
+		UPDATE user_sessions
+		SET revoked_at = NOW(), revoked_by = ?
+		WHERE user_uuid = ? AND session_uuid IN (?) AND revoked_at IS NULL
+	`, revokedBy, userUUID, sessionUUIDs)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	query, args, err = sqlx.In(`
+		UPDATE refresh_tokens
+		SET is_revoked = true
+		WHERE user_uuid = ? AND family_uuid IN (?)
+	`, userUUID, sessionUUIDs)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	query, args, err = sqlx.In(`
+		DELETE FROM fcm_tokens
+		WHERE user_uuid = ? AND session_uuid IN (?)
+	`, userUUID, sessionUUIDs)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
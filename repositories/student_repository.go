@@ -186,7 +186,8 @@ func (repo *StudentRepository) FetchAvailableStudent(schoolUUID string) ([]entit
 	SELECT 
 		s.student_uuid,
 		s.student_first_name,
-		s.student_last_name
+		s.student_last_name,
+		s.student_pickup_point
 	FROM students s
 	WHERE NOT EXISTS (
 		SELECT 1 
@@ -210,6 +211,7 @@ func (repo *StudentRepository) FetchAvailableStudent(schoolUUID string) ([]entit
 			&student.UUID,
 			&student.FirstName,
 			&student.LastName,
+			&student.StudentPickupPoint,
 		)
 		if err != nil {
 			log.Printf("Error scanning row: %v", err)
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"shuttle/models/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type TokenRepositoryInterface interface {
+	SaveRevokedToken(token entity.RevokedToken) error
+	IsTokenRevoked(jti string) (bool, error)
+	DeleteExpiredRevokedTokens() (int64, error)
+}
+
+type tokenRepository struct {
+	DB *sqlx.DB
+}
+
+func NewTokenRepository(DB *sqlx.DB) TokenRepositoryInterface {
+	return &tokenRepository{
+		DB: DB,
+	}
+}
+
+func (r *tokenRepository) SaveRevokedToken(token entity.RevokedToken) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_uuid, revoked_at, expired_at)
+		VALUES ($1, $2, NOW(), $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	_, err := r.DB.Exec(query, token.JTI, token.UserUUID, token.ExpiredAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *tokenRepository) IsTokenRevoked(jti string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+	if err := r.DB.Get(&exists, query, jti); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *tokenRepository) DeleteExpiredRevokedTokens() (int64, error) {
+	query := `DELETE FROM revoked_tokens WHERE expired_at < NOW()`
+	result, err := r.DB.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
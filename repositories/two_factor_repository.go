@@ -0,0 +1,191 @@
+package repositories
+
+import (
+	"shuttle/models/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type TwoFactorRepositoryInterface interface {
+	FetchTwoFactor(userUUID string) (entity.UserTwoFactor, error)
+	SaveTwoFactorSecret(userUUID, secret string) error
+	UpdateTwoFactorSecret(userUUID, secret string) error
+	EnableTwoFactor(userUUID string, step int64, codeHashes []string) error
+	UpdateLastUsedStep(userUUID string, step int64) (bool, error)
+	ReplaceRecoveryCodes(userUUID string, codeHashes []string) error
+	UseRecoveryCode(userUUID, codeHash string) (bool, error)
+	CountUnusedRecoveryCodes(userUUID string) (int, error)
+	DeleteTwoFactor(userUUID string) (bool, error)
+	CheckTwoFactorRequired(roleCode string) (bool, error)
+}
+
+type twoFactorRepository struct {
+	DB *sqlx.DB
+}
+
+func NewTwoFactorRepository(DB *sqlx.DB) TwoFactorRepositoryInterface {
+	return &twoFactorRepository{
+		DB: DB,
+	}
+}
+
+func (r *twoFactorRepository) FetchTwoFactor(userUUID string) (entity.UserTwoFactor, error) {
+	var twoFactor entity.UserTwoFactor
+	query := `
+		SELECT user_uuid, secret, enabled_at, last_used_step, created_at, updated_at
+		FROM user_two_factor
+		WHERE user_uuid = $1
+	`
+	if err := r.DB.Get(&twoFactor, query, userUUID); err != nil {
+		return entity.UserTwoFactor{}, err
+	}
+
+	return twoFactor, nil
+}
+
+// Starting a new enrolment replaces a secret that was never confirmed, an
+// enabled secret is left untouched
+func (r *twoFactorRepository) SaveTwoFactorSecret(userUUID, secret string) error {
+	query := `
+		INSERT INTO user_two_factor (user_uuid, secret, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW(), updated_at = NOW()
+		WHERE user_two_factor.enabled_at IS NULL
+	`
+	_, err := r.DB.Exec(query, userUUID, secret)
+	return err
+}
+
+func (r *twoFactorRepository) UpdateTwoFactorSecret(userUUID, secret string) error {
+	query := `UPDATE user_two_factor SET secret = $1, updated_at = NOW() WHERE user_uuid = $2`
+	_, err := r.DB.Exec(query, secret, userUUID)
+	return err
+}
+
+func (r *twoFactorRepository) EnableTwoFactor(userUUID string, step int64, codeHashes []string) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE user_two_factor
+		SET enabled_at = NOW(), last_used_step = $1, updated_at = NOW()
+		WHERE user_uuid = $2
+	`
+	if _, err = tx.Exec(query, step, userUUID); err != nil {
+		return err
+	}
+
+	if err = insertRecoveryCodes(tx, userUUID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// The step only moves forward, so a code can't be replayed within its window
+func (r *twoFactorRepository) UpdateLastUsedStep(userUUID string, step int64) (bool, error) {
+	query := `
+		UPDATE user_two_factor
+		SET last_used_step = $1, updated_at = NOW()
+		WHERE user_uuid = $2 AND last_used_step < $1
+	`
+	result, err := r.DB.Exec(query, step, userUUID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(userUUID string, codeHashes []string) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = insertRecoveryCodes(tx, userUUID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(userUUID, codeHash string) (bool, error) {
+	query := `
+		UPDATE user_recovery_codes
+		SET used_at = NOW()
+		WHERE user_uuid = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	result, err := r.DB.Exec(query, userUUID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *twoFactorRepository) CountUnusedRecoveryCodes(userUUID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(id) FROM user_recovery_codes WHERE user_uuid = $1 AND used_at IS NULL`
+	if err := r.DB.Get(&count, query, userUUID); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Recovery codes are removed along with the secret by the foreign key
+func (r *twoFactorRepository) DeleteTwoFactor(userUUID string) (bool, error) {
+	result, err := r.DB.Exec(`DELETE FROM user_two_factor WHERE user_uuid = $1`, userUUID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *twoFactorRepository) CheckTwoFactorRequired(roleCode string) (bool, error) {
+	var required bool
+	query := `SELECT EXISTS(SELECT 1 FROM roles WHERE role_code = $1 AND role_two_factor_required)`
+	if err := r.DB.Get(&required, query, roleCode); err != nil {
+		return false, err
+	}
+
+	return required, nil
+}
+
+// Every new set of recovery codes invalidates the previous one
+func insertRecoveryCodes(tx *sqlx.Tx, userUUID string, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_uuid = $1`, userUUID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO user_recovery_codes (user_uuid, code_hash, created_at) VALUES ($1, $2, NOW())`
+	for _, codeHash := range codeHashes {
+		if _, err := tx.Exec(query, userUUID, codeHash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
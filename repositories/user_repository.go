@@ -108,7 +108,7 @@ func (r *userRepository) FetchAllDriversForPermittedSchool(offset, limit int, so
         LEFT JOIN driver_details d ON u.user_uuid = d.user_uuid
         LEFT JOIN schools s ON d.school_uuid = s.school_uuid
         LEFT JOIN vehicles v ON d.vehicle_uuid = v.vehicle_uuid
-        WHERE u.user_role = 'driver' AND u.deleted_at IS NULL AND d.school_uuid = $1
+        WHERE u.user_role = 'driver' AND u.deleted_at IS NULL AND u.user_register_status = 'APPROVED' AND d.school_uuid = $1
         ORDER BY %s %s
         LIMIT $2 OFFSET $3
     `, sortField, sortDirection)
@@ -189,7 +189,7 @@ func (r *userRepository) FetchSpecDriverForPermittedSchool(userUUID, schoolUUID
 		LEFT JOIN driver_details d ON u.user_uuid = d.user_uuid
 		LEFT JOIN schools s ON d.school_uuid = s.school_uuid
 		LEFT JOIN vehicles v ON d.vehicle_uuid = v.vehicle_uuid
-		WHERE u.user_role = 'driver' AND u.deleted_at IS NULL AND u.user_uuid = $1 AND d.school_uuid = $2
+		WHERE u.user_role = 'driver' AND u.deleted_at IS NULL AND u.user_register_status = 'APPROVED' AND u.user_uuid = $1 AND d.school_uuid = $2
 	`
 	log.Println("Executing query to fetch data...")
 	err := r.DB.QueryRowx(query, userUUID, schoolUUID).Scan(
@@ -220,7 +220,7 @@ func (r *userRepository) FetchSpecDriverForPermittedSchool(userUUID, schoolUUID
 
 func (r *userRepository) CountAllPermittedDriver(schoolUUID string) (int, error) {
     // Mulai dengan query dasar
-    query := `SELECT COUNT(user_id) FROM users WHERE user_role = 'driver' AND deleted_at IS NULL`
+    query := `SELECT COUNT(user_id) FROM users WHERE user_role = 'driver' AND deleted_at IS NULL AND user_register_status = 'APPROVED'`
 
     // Jika schoolUUID tidak kosong, tambahkan filter untuk schoolUUID
     if schoolUUID != "" {
@@ -349,7 +349,7 @@ func (r *userRepository) CountSchoolAdmin() (int, error) {
 	query := `
         SELECT COUNT(*)
         FROM users
-        WHERE user_role = 'schooladmin' AND deleted_at IS NULL
+        WHERE user_role = 'schooladmin' AND deleted_at IS NULL AND user_register_status = 'APPROVED'
     `
 	var total int
 	err := r.DB.Get(&total, query)
@@ -364,7 +364,7 @@ func (r *userRepository) CountAllDriver() (int, error) {
 	query := `
 		SELECT COUNT(user_id)
 		FROM users
-		WHERE user_role = 'driver' AND deleted_at IS NULL
+		WHERE user_role = 'driver' AND deleted_at IS NULL AND user_register_status = 'APPROVED'
 	`
 	var total int
 	err := r.DB.Get(&total, query)
@@ -444,7 +444,7 @@ func (r *userRepository) FetchAllSchoolAdmins(offset int, limit int, sortField s
         FROM users u
         LEFT JOIN school_admin_details d ON u.user_uuid = d.user_uuid
         LEFT JOIN schools s ON d.school_uuid = s.school_uuid
-        WHERE u.user_role = 'schooladmin' AND u.deleted_at IS NULL
+        WHERE u.user_role = 'schooladmin' AND u.deleted_at IS NULL AND u.user_register_status = 'APPROVED'
         ORDER BY %s %s
         LIMIT $1 OFFSET $2
     `, sortField, sortDirection)
@@ -529,7 +529,7 @@ func (r *userRepository) FetchAllDrivers(offset int, limit int, sortField string
         LEFT JOIN driver_details d ON u.user_uuid = d.user_uuid
         LEFT JOIN schools s ON d.school_uuid = s.school_uuid
         LEFT JOIN vehicles v ON d.vehicle_uuid = v.vehicle_uuid
-        WHERE u.user_role = 'driver' AND u.deleted_at IS NULL
+        WHERE u.user_role = 'driver' AND u.deleted_at IS NULL AND u.user_register_status = 'APPROVED'
         ORDER BY %s %s
         LIMIT $1 OFFSET $2
     `, sortField, sortDirection)
@@ -821,8 +821,8 @@ func (r *userRepository) SaveDriverDetails(tx *sqlx.Tx, details entity.DriverDet
 
 	query := `
 		INSERT INTO driver_details 
-		(user_uuid, school_uuid, vehicle_uuid, user_picture, user_first_name, user_last_name, user_gender, user_phone, user_address, user_license_number) 
-		VALUES (:user_uuid, :school_uuid, :vehicle_uuid, :user_picture, :user_first_name, :user_last_name, :user_gender, :user_phone, :user_address, :user_license_number)
+		(user_uuid, school_uuid, vehicle_uuid, user_picture, user_first_name, user_last_name, user_gender, user_phone, user_address, user_license_number, user_depot_point) 
+		VALUES (:user_uuid, :school_uuid, :vehicle_uuid, :user_picture, :user_first_name, :user_last_name, :user_gender, :user_phone, :user_address, :user_license_number, :user_depot_point)
 	`
 	params = details
 	_, err := tx.NamedExec(query, params)
@@ -949,9 +949,10 @@ func (r *userRepository) UpdateDriverDetails(tx *sqlx.Tx, details entity.DriverD
 	query := `
         UPDATE driver_details
         SET school_uuid = $1, vehicle_uuid = $2, user_first_name = $3, user_last_name = $4,
-		user_gender = $5, user_phone = $6, user_address = $7, user_license_number = $8
-		WHERE user_uuid = $9`
-	res, err := tx.Exec(query, details.SchoolUUID, details.VehicleUUID, details.FirstName, details.LastName, details.Gender, details.Phone, details.Address, details.LicenseNumber, details.UserUUID)
+		user_gender = $5, user_phone = $6, user_address = $7, user_license_number = $8,
+		user_depot_point = COALESCE($9::json, user_depot_point)
+		WHERE user_uuid = $10`
+	res, err := tx.Exec(query, details.SchoolUUID, details.VehicleUUID, details.FirstName, details.LastName, details.Gender, details.Phone, details.Address, details.LicenseNumber, details.DepotPoint, details.UserUUID)
 	if err != nil {
 		return err
 	}
@@ -3,6 +3,7 @@ package routes
 import (
 	"shuttle/handler"
 	"shuttle/middleware"
+	"shuttle/models/entity"
 	"shuttle/repositories"
 	"shuttle/services"
 	"shuttle/utils"
@@ -21,38 +22,59 @@ func Route(r *fiber.App, db *sqlx.DB) {
 	routeRepository := repositories.NewRouteRepository(db)
 	childernRepository := repositories.NewChildernRepository(db)
 	shuttleRepository := repositories.NewShuttleRepository(db)
-	// registerRepository := repositories.NewRegisterRepository(db)
+	sessionRepository := repositories.NewSessionRepository(db)
+	loginAttemptRepository := repositories.NewLoginAttemptRepository(db)
+	permissionRepository := repositories.NewPermissionRepository(db)
+	twoFactorRepository := repositories.NewTwoFactorRepository(db)
+	accessPolicyRepository := repositories.NewAccessPolicyRepository(db)
+	registerRepository := repositories.NewRegisterRepository(db)
+	locationRepository := repositories.NewLocationRepository(db)
 	
 	userService := services.NewUserService(userRepository)
 	authService := services.NewAuthService(authRepository, userRepository)
 	schoolService := services.NewSchoolService(schoolRepository, userRepository)
 	vehicleService := services.NewVehicleService(vehicleRepository)
 	studentService := services.NewStudentService(studentRepository, &userService, userRepository)
-	routeService := services.NewRouteService(routeRepository)
+	routeService := services.NewRouteService(routeRepository, locationRepository, studentRepository)
 	childernService := services.NewChildernService(childernRepository)
 	shuttleService := services.NewShuttleService(shuttleRepository)
-	// registerService := services.NewRegisterService(registerRepository)
+	sessionService := services.NewSessionService(sessionRepository)
+	loginAttemptService := services.NewLoginAttemptService(loginAttemptRepository, userRepository)
+	permissionService := services.NewPermissionService(permissionRepository)
+	accessPolicyService := services.NewAccessPolicyService(accessPolicyRepository)
+	twoFactorService := services.NewTwoFactorService(twoFactorRepository, authRepository, utils.NewKeyringSecretCipher())
+	registerService := services.NewRegisterService(registerRepository)
+	locationService := services.NewLocationService(locationRepository)
 	
-	authHandler := handler.NewAuthHttpHandler(authService)
-	userHandler := handler.NewUserHttpHandler(userService, schoolService, vehicleService)
+	mailer := utils.NewMailer()
+
+	authHandler := handler.NewAuthHttpHandler(authService, sessionService, loginAttemptService, twoFactorService, mailer)
+	sessionHandler := handler.NewSessionHttpHandler(sessionService)
+	loginAttemptHandler := handler.NewLoginAttemptHttpHandler(loginAttemptService)
+	permissionHandler := handler.NewPermissionHttpHandler(permissionService)
+	twoFactorHandler := handler.NewTwoFactorHttpHandler(twoFactorService)
+	userHandler := handler.NewUserHttpHandler(userService, schoolService, vehicleService, permissionService)
 	schoolHandler := handler.NewSchoolHttpHandler(schoolService)
 	vehicleHandler := handler.NewVehicleHttpHandler(vehicleService)
 	studentHandler := handler.NewStudentHttpHandler(studentService)
 	routeHandler := handler.NewRouteHttpHandler(routeService)
 	childernHandler := handler.NewChildernHandler(childernService)
-	shuttleHandler := handler.NewShuttleHandler(shuttleService)
-	// registerHandler := handler.NewRegisterHttpHandler(registerService, schoolService, vehicleService)
+	shuttleHandler := handler.NewShuttleHandler(shuttleService, accessPolicyService)
+	registerHandler := handler.NewRegisterHttpHandler(registerService, mailer)
+	locationHandler := handler.NewLocationHttpHandler(locationService)
+	realtimeHandler := handler.NewRealtimeHttpHandler()
 
-	wsService := utils.NewWebSocketService(userRepository, authRepository)
+	wsService := utils.NewWebSocketService(userRepository, authRepository, accessPolicyRepository, locationRepository, permissionService)
 
-	////////////////////////////////A😂P😂A😂L😂A😂H//////////////////////////////////
-
-	// r.Post("register", registerHandler.AddUserRegister)
-	
 	////////////////////////////////////// PUBLIC //////////////////////////////////////
 
 	r.Post("login", authHandler.Login)
+	r.Post("/login/2fa", authHandler.LoginTwoFactor)
+	r.Post("/login/2fa/setup", authHandler.SetupTwoFactorOnLogin)
 	r.Post("/refresh-token", authHandler.IssueNewAccessToken)
+	r.Post("/forgot-password", authHandler.ForgotPassword)
+	r.Post("/reset-password", authHandler.ResetPassword)
+	r.Post("/register", registerHandler.AddUserRegister)
 	r.Static("/assets", "./assets")
 
 	r.Use("/ws", func(c *fiber.Ctx) error {
@@ -61,108 +83,169 @@ func Route(r *fiber.App, db *sqlx.DB) {
 		}
 		return fiber.ErrUpgradeRequired
 	})
-	r.Get("/ws/:id", websocket.New(wsService.HandleWebSocketConnection))
+	wsHandler := websocket.New(wsService.HandleWebSocketConnection, websocket.Config{
+		Subprotocols: []string{"bearer"},
+	})
+	r.Get("/ws", middleware.WebSocketAuthenticationMiddleware(), wsHandler)
+	// Older clients still put their user UUID in the path, it is ignored in favour of the token
+	r.Get("/ws/:id", middleware.WebSocketAuthenticationMiddleware(), wsHandler)
+	// Same events for clients whose network blocks websocket upgrades
+	r.Get("/events", middleware.EventStreamAuthenticationMiddleware(), wsService.HandleEventStream)
 
 	////////////////////////////////////// AUTHENTICATED //////////////////////////////////////
 
+	// Access is granted per permission, see the role_permissions table
+	can := func(permission string) fiber.Handler {
+		return middleware.PermissionMiddleware(permissionService, permission)
+	}
+	owns := func(policy entity.AccessPolicy) fiber.Handler {
+		return middleware.OwnershipMiddleware(accessPolicyService, policy)
+	}
+
 	protected := r.Group("/api")
 	protected.Use(middleware.AuthenticationMiddleware())
-	protected.Use(middleware.AuthorizationMiddleware([]string{"SA", "AS", "D", "P"}))
 
-	protected.Get("/my/profile", authHandler.GetMyProfile)
-	protected.Post("/logout", authHandler.Logout)
-	protected.Post("/device-token", authHandler.AddDeviceToken)
+	protected.Get("/my/profile", can("account:self"), authHandler.GetMyProfile)
+	protected.Post("/logout", can("account:self"), authHandler.Logout)
+	protected.Post("/device-token", can("account:self"), authHandler.AddDeviceToken)
+	protected.Put("/my/password", can("account:self"), authHandler.ChangePassword)
+	protected.Get("/my/sessions", can("account:self"), sessionHandler.GetMySessions)
+	protected.Delete("/my/sessions/:id", can("account:self"), sessionHandler.RevokeMySession)
+	protected.Get("/my/2fa", can("account:self"), twoFactorHandler.GetMyTwoFactor)
+	protected.Post("/my/2fa/enrol", can("account:self"), twoFactorHandler.EnrolMyTwoFactor)
+	protected.Post("/my/2fa/confirm", can("account:self"), twoFactorHandler.ConfirmMyTwoFactor)
+	protected.Post("/my/2fa/recovery-codes", can("account:self"), twoFactorHandler.RegenerateMyRecoveryCodes)
+	protected.Delete("/my/2fa", can("account:self"), twoFactorHandler.DisableMyTwoFactor)
 
 	////////////////////////////////////// SUPER ADMIN //////////////////////////////////////
 	
 	protectedSuperAdmin := protected.Group("/superadmin")
-	protectedSuperAdmin.Use(middleware.AuthorizationMiddleware([]string{"SA"}))
 	protectedDriver := protected.Group("/driver")
-	protectedDriver.Use(middleware.AuthorizationMiddleware([]string{"D"}))
 	
 	protectedParent := protected.Group("/parent")
-	protectedParent.Use(middleware.AuthorizationMiddleware([]string{"P"}))
 
 	// USER FOR SUPERADMIN
-	protectedSuperAdmin.Get("/user/sa/all", userHandler.GetAllSuperAdmin)
-	protectedSuperAdmin.Get("/user/as/all", userHandler.GetAllSchoolAdmin)
-	protectedSuperAdmin.Get("/user/driver/all", userHandler.GetAllPermittedDriver)
-	protectedSuperAdmin.Get("/user/sa/:id", userHandler.GetSpecSuperAdmin)
-	protectedSuperAdmin.Get("/user/as/:id", userHandler.GetSpecSchoolAdmin)
-	protectedSuperAdmin.Get("/user/driver/:id", userHandler.GetSpecPermittedDriver)
-	protectedSuperAdmin.Post("/user/add", userHandler.AddUser)
-	protectedSuperAdmin.Put("/user/update/:id", userHandler.UpdateUser)
-	protectedSuperAdmin.Delete("/user/sa/delete/:id", userHandler.DeleteSuperAdmin)
-	protectedSuperAdmin.Delete("/user/as/delete/:id", userHandler.DeleteSchoolAdmin)
-	protectedSuperAdmin.Delete("/user/driver/delete/:id", userHandler.DeleteDriver)
+	protectedSuperAdmin.Get("/user/sa/all", can("user:read"), userHandler.GetAllSuperAdmin)
+	protectedSuperAdmin.Get("/user/as/all", can("user:read"), userHandler.GetAllSchoolAdmin)
+	protectedSuperAdmin.Get("/user/driver/all", can("user:read"), userHandler.GetAllPermittedDriver)
+	protectedSuperAdmin.Get("/user/sa/:id", can("user:read"), userHandler.GetSpecSuperAdmin)
+	protectedSuperAdmin.Get("/user/as/:id", can("user:read"), userHandler.GetSpecSchoolAdmin)
+	protectedSuperAdmin.Get("/user/driver/:id", can("user:read"), userHandler.GetSpecPermittedDriver)
+	protectedSuperAdmin.Post("/user/add", can("user:write"), userHandler.AddUser)
+	protectedSuperAdmin.Put("/user/update/:id", can("user:write"), userHandler.UpdateUser)
+	protectedSuperAdmin.Delete("/user/sa/delete/:id", can("user:delete"), userHandler.DeleteSuperAdmin)
+	protectedSuperAdmin.Delete("/user/as/delete/:id", can("user:delete"), userHandler.DeleteSchoolAdmin)
+	protectedSuperAdmin.Delete("/user/driver/delete/:id", can("user:delete"), userHandler.DeleteDriver)
+	protectedSuperAdmin.Get("/user/sessions/:id", can("user:session:manage"), sessionHandler.GetUserSessions)
+	protectedSuperAdmin.Post("/user/logout/:id", can("user:session:manage"), sessionHandler.ForceLogoutUser)
+	protectedSuperAdmin.Post("/user/unlock/:id", can("user:lockout:manage"), loginAttemptHandler.UnlockUser)
+	protectedSuperAdmin.Delete("/user/2fa/:id", can("user:two_factor:manage"), twoFactorHandler.ResetUserTwoFactor)
+	protectedSuperAdmin.Get("/login-history", can("user:lockout:manage"), loginAttemptHandler.GetLoginHistory)
+
+	// REGISTRATION FOR SUPERADMIN
+	protectedSuperAdmin.Get("/registration/all", can("registration:review"), registerHandler.GetRegistrations)
+	protectedSuperAdmin.Put("/registration/approve/:id", can("registration:review"), registerHandler.ApproveUserRegister)
+	protectedSuperAdmin.Put("/registration/reject/:id", can("registration:review"), registerHandler.RejectUserRegister)
+
+	// ROLE FOR SUPERADMIN
+	protectedSuperAdmin.Get("/role/all", can("role:manage"), permissionHandler.GetAllRoles)
+	protectedSuperAdmin.Get("/permission/all", can("role:manage"), permissionHandler.GetAllPermissions)
+	protectedSuperAdmin.Post("/role/add", can("role:manage"), permissionHandler.AddRole)
+	protectedSuperAdmin.Put("/role/update/:id", can("role:manage"), permissionHandler.UpdateRole)
 
 	// SCHOOL FOR SUPERADMIN
-	protectedSuperAdmin.Get("/school/all", schoolHandler.GetAllSchools)
-	protectedSuperAdmin.Get("/school/:id", schoolHandler.GetSpecSchool)
-	protectedSuperAdmin.Post("/school/add", schoolHandler.AddSchool)
-	protectedSuperAdmin.Put("/school/update/:id", schoolHandler.UpdateSchool)
-	protectedSuperAdmin.Delete("/school/delete/:id", schoolHandler.DeleteSchool)
+	protectedSuperAdmin.Get("/school/all", can("school:read"), schoolHandler.GetAllSchools)
+	protectedSuperAdmin.Get("/school/:id", can("school:read"), schoolHandler.GetSpecSchool)
+	protectedSuperAdmin.Post("/school/add", can("school:write"), schoolHandler.AddSchool)
+	protectedSuperAdmin.Put("/school/update/:id", can("school:write"), schoolHandler.UpdateSchool)
+	protectedSuperAdmin.Delete("/school/delete/:id", can("school:delete"), schoolHandler.DeleteSchool)
 	
 	// VEHICLE FOR SUPERADMIN
-	protectedSuperAdmin.Get("/vehicle/all", vehicleHandler.GetAllVehicles)
-	protectedSuperAdmin.Get("/vehicle/free/all", vehicleHandler.GetAvailableVehicles)
-	protectedSuperAdmin.Get("/vehicle/:id", vehicleHandler.GetSpecVehicle)
-	protectedSuperAdmin.Post("/vehicle/add", vehicleHandler.AddVehicle)
-	protectedSuperAdmin.Put("/vehicle/update/:id", vehicleHandler.UpdateVehicle)
-	protectedSuperAdmin.Delete("/vehicle/delete/:id", vehicleHandler.DeleteVehicle)
+	protectedSuperAdmin.Get("/vehicle/all", can("vehicle:read"), vehicleHandler.GetAllVehicles)
+	protectedSuperAdmin.Get("/vehicle/free/all", can("vehicle:read"), vehicleHandler.GetAvailableVehicles)
+	protectedSuperAdmin.Get("/vehicle/:id", can("vehicle:read"), vehicleHandler.GetSpecVehicle)
+	protectedSuperAdmin.Post("/vehicle/add", can("vehicle:write"), vehicleHandler.AddVehicle)
+	protectedSuperAdmin.Put("/vehicle/update/:id", can("vehicle:write"), vehicleHandler.UpdateVehicle)
+	protectedSuperAdmin.Delete("/vehicle/delete/:id", can("vehicle:delete"), vehicleHandler.DeleteVehicle)
 	
-	protectedSuperAdmin.Get("/shuttle/summary", shuttleHandler.GetShuttleSummary)
-	protectedSuperAdmin.Get("/student/growth", studentHandler.GetStudentCountByMonth)
+	protectedSuperAdmin.Get("/shuttle/summary", can("report:read"), shuttleHandler.GetShuttleSummary)
+	protectedSuperAdmin.Get("/student/growth", can("report:read"), studentHandler.GetStudentCountByMonth)
+
+	// LOCATION HISTORY FOR SUPERADMIN
+	protectedSuperAdmin.Get("/shuttle/path/:id", can("location:history:read"), locationHandler.GetShuttlePath)
+	protectedSuperAdmin.Get("/user/driver/path/:id", can("location:history:read"), locationHandler.GetDriverPath)
+	protectedSuperAdmin.Get("/realtime/metrics", can("realtime:metrics:read"), realtimeHandler.GetRealtimeMetrics)
 
 	////////////////////////////////////// SCHOOL ADMIN //////////////////////////////////////
 
 	protectedSchoolAdmin := protected.Group("/school")
-	protectedSchoolAdmin.Use(middleware.AuthorizationMiddleware([]string{"AS"}))
 	protectedSchoolAdmin.Use(middleware.SchoolAdminMiddleware(userService))
 
+	// REGISTRATION FOR SCHOOL ADMIN
+	protectedSchoolAdmin.Get("/registration/all", can("school:registration:review"), registerHandler.GetRegistrations)
+	protectedSchoolAdmin.Put("/registration/approve/:id", can("school:registration:review"), registerHandler.ApproveUserRegister)
+	protectedSchoolAdmin.Put("/registration/reject/:id", can("school:registration:review"), registerHandler.RejectUserRegister)
+
 	// STUDENT FOR SCHOOL ADMIN
-	protectedSchoolAdmin.Get("/student/all", studentHandler.GetAllStudentWithParents)
-	protectedSchoolAdmin.Get("/student/free/all", studentHandler.GetAvailableStudents)
-	protectedSchoolAdmin.Get("/student/:id", studentHandler.GetSpecStudentWithParents)
-	protectedSchoolAdmin.Post("/student/add", studentHandler.AddSchoolStudentWithParents)
-	protectedSchoolAdmin.Put("/student/update/:id", studentHandler.UpdateSchoolStudentWithParents)
-	protectedSchoolAdmin.Delete("/student/delete/:id", studentHandler.DeleteSchoolStudentWithParentsIfNeccessary)
-
-	protectedSchoolAdmin.Get("/user/driver/all", userHandler.GetAllPermittedDriver)
-	protectedSchoolAdmin.Get("/user/driver/:id", userHandler.GetSpecPermittedDriver)
-	protectedSchoolAdmin.Post("/user/driver/add", userHandler.AddSchoolDriver)
-	protectedSchoolAdmin.Put("/user/driver/update/:id", userHandler.UpdateSchoolDriver)
-	protectedSchoolAdmin.Delete("/user/driver/delete/:id", userHandler.DeleteSchoolDriver)
+	protectedSchoolAdmin.Get("/student/all", can("school:student:read"), studentHandler.GetAllStudentWithParents)
+	protectedSchoolAdmin.Get("/student/free/all", can("school:student:read"), studentHandler.GetAvailableStudents)
+	protectedSchoolAdmin.Get("/student/:id", can("school:student:read"), owns(entity.PolicySchoolStudent), studentHandler.GetSpecStudentWithParents)
+	protectedSchoolAdmin.Post("/student/add", can("school:student:write"), studentHandler.AddSchoolStudentWithParents)
+	protectedSchoolAdmin.Put("/student/update/:id", can("school:student:write"), owns(entity.PolicySchoolStudent), studentHandler.UpdateSchoolStudentWithParents)
+	protectedSchoolAdmin.Delete("/student/delete/:id", can("school:student:delete"), owns(entity.PolicySchoolStudent), studentHandler.DeleteSchoolStudentWithParentsIfNeccessary)
+
+	protectedSchoolAdmin.Get("/user/driver/all", can("school:driver:read"), userHandler.GetAllPermittedDriver)
+	protectedSchoolAdmin.Get("/user/driver/:id", can("school:driver:read"), owns(entity.PolicySchoolDriver), userHandler.GetSpecPermittedDriver)
+	protectedSchoolAdmin.Post("/user/driver/add", can("school:driver:write"), userHandler.AddSchoolDriver)
+	protectedSchoolAdmin.Put("/user/driver/update/:id", can("school:driver:write"), owns(entity.PolicySchoolDriver), userHandler.UpdateSchoolDriver)
+	protectedSchoolAdmin.Delete("/user/driver/delete/:id", can("school:driver:delete"), owns(entity.PolicySchoolDriver), userHandler.DeleteSchoolDriver)
 	
-	protectedSchoolAdmin.Get("/vehicle/all", vehicleHandler.GetAllVehiclesForPermittedSchool)
-	protectedSchoolAdmin.Get("/vehicle/free/all", vehicleHandler.GetAvailableSchoolVehicles)
-	protectedSchoolAdmin.Get("/vehicle/:id", vehicleHandler.GetSpecVehicleForPermittedSchool)
-	protectedSchoolAdmin.Post("/vehicle/add", vehicleHandler.AddVehicleForPermittedSchool)
-	protectedSchoolAdmin.Put("/vehicle/update/:id", vehicleHandler.UpdateVehicle)
-	protectedSchoolAdmin.Delete("/vehicle/delete/:id", vehicleHandler.DeleteVehicle)
+	protectedSchoolAdmin.Get("/vehicle/all", can("school:vehicle:read"), vehicleHandler.GetAllVehiclesForPermittedSchool)
+	protectedSchoolAdmin.Get("/vehicle/free/all", can("school:vehicle:read"), vehicleHandler.GetAvailableSchoolVehicles)
+	protectedSchoolAdmin.Get("/vehicle/:id", can("school:vehicle:read"), owns(entity.PolicySchoolVehicle), vehicleHandler.GetSpecVehicleForPermittedSchool)
+	protectedSchoolAdmin.Post("/vehicle/add", can("school:vehicle:write"), vehicleHandler.AddVehicleForPermittedSchool)
+	protectedSchoolAdmin.Put("/vehicle/update/:id", can("school:vehicle:write"), owns(entity.PolicySchoolVehicle), vehicleHandler.UpdateVehicle)
+	protectedSchoolAdmin.Delete("/vehicle/delete/:id", can("school:vehicle:delete"), owns(entity.PolicySchoolVehicle), vehicleHandler.DeleteVehicle)
 
 	// ROUTE FOR SCHOOL ADMIN
-	protectedSchoolAdmin.Get("/route/all", routeHandler.GetAllRouteAssignments)
-	protectedSchoolAdmin.Get("/route/:id", routeHandler.GetSpecRouteByAS)
-	protectedSchoolAdmin.Post("/route/add", routeHandler.AddRoute)
-	protectedSchoolAdmin.Put("/route/update/:id", routeHandler.UpdateRoute)
-	protectedSchoolAdmin.Delete("/route/delete/:id", routeHandler.DeleteRoute)
+	protectedSchoolAdmin.Get("/route/all", can("route:read"), routeHandler.GetAllRouteAssignments)
+	protectedSchoolAdmin.Get("/route/:id", can("route:read"), owns(entity.PolicySchoolRoute), routeHandler.GetSpecRouteByAS)
+	protectedSchoolAdmin.Post("/route/add", can("route:write"), routeHandler.AddRoute)
+	protectedSchoolAdmin.Put("/route/update/:id", can("route:write"), owns(entity.PolicySchoolRoute), routeHandler.UpdateRoute)
+	protectedSchoolAdmin.Delete("/route/delete/:id", can("route:delete"), owns(entity.PolicySchoolRoute), routeHandler.DeleteRoute)
+	// Proposals are only saved once confirmed with the PUT
+	protectedSchoolAdmin.Post("/route/optimize/:id", can("route:write"), owns(entity.PolicySchoolRoute), routeHandler.ProposeRouteOrder)
+	protectedSchoolAdmin.Put("/route/optimize/:id", can("route:write"), owns(entity.PolicySchoolRoute), routeHandler.ApplyRouteOrder)
+	// Drafts only, each route is created through /route/add
+	protectedSchoolAdmin.Post("/route/plan", can("route:write"), routeHandler.PlanSchoolRoutes)
+
+	// LOCATION HISTORY FOR SCHOOL ADMIN
+	protectedSchoolAdmin.Get("/shuttle/path/:id", can("school:location:history:read"), owns(entity.PolicySchoolShuttle), locationHandler.GetShuttlePath)
+	protectedSchoolAdmin.Get("/user/driver/path/:id", can("school:location:history:read"), owns(entity.PolicySchoolDriver), locationHandler.GetDriverPath)
+
+	// LIVE FLEET FOR SCHOOL ADMIN
+	protectedSchoolAdmin.Get("/fleet", can("school:fleet:read"), locationHandler.GetSchoolFleet)
+
+	// GEOFENCES FOR SCHOOL ADMIN
+	protectedSchoolAdmin.Get("/geofence", can("school:geofence:read"), schoolHandler.GetSchoolGeofence)
+	protectedSchoolAdmin.Put("/geofence", can("school:geofence:write"), schoolHandler.UpdateSchoolGeofence)
 
 	//ROUTE FOR DRIVER
-	protectedDriver.Get("/route/all", routeHandler.GetAllRoutesByDriver)
-
-	protectedParent.Get("/my/childern/track", shuttleHandler.GetShuttleTrackByParent)
-	protectedParent.Get("/my/childern/all", childernHandler.GetAllChilderns)
-	protectedParent.Get("/my/childern/shuttle/:id", shuttleHandler.GetSpecShuttle)
-	protectedParent.Get("/my/childern/recap", shuttleHandler.GetAllShuttleByParent)
-	protectedParent.Get("/my/childern/:id", childernHandler.GetSpecChildern)
-	protectedParent.Put("/my/childern/update/:id", childernHandler.UpdateChildern)
-	protectedParent.Put("/my/childern/status/update/:id", childernHandler.UpdateChildernStatus)
-
-	protectedDriver.Get("/shuttle/all", shuttleHandler.GetAllShuttleByDriver)
-	protectedDriver.Post("/shuttle/add", shuttleHandler.AddShuttle)
-	protectedDriver.Get("/shuttle/:id", shuttleHandler.GetSpecShuttle)
-	protectedDriver.Get("/distance", routeHandler.GetDriverDistance)
-	protectedDriver.Put("/shuttle/update/:id", shuttleHandler.EditShuttle) 
-	protectedDriver.Put("/shuttle/order/update/:id", routeHandler.UpdateStudentOrder)
+	protectedDriver.Get("/route/all", can("driver:route:read"), routeHandler.GetAllRoutesByDriver)
+
+	protectedParent.Get("/my/childern/track", can("child:shuttle:read"), shuttleHandler.GetShuttleTrackByParent)
+	protectedParent.Get("/my/childern/all", can("child:read"), childernHandler.GetAllChilderns)
+	protectedParent.Get("/my/childern/shuttle/:id", can("child:shuttle:read"), owns(entity.PolicyParentShuttle), shuttleHandler.GetSpecShuttle)
+	protectedParent.Get("/my/childern/shuttle/path/:id", can("child:shuttle:read"), owns(entity.PolicyParentShuttle), locationHandler.GetShuttlePath)
+	protectedParent.Get("/my/childern/recap", can("child:shuttle:read"), shuttleHandler.GetAllShuttleByParent)
+	protectedParent.Get("/my/childern/:id", can("child:read"), owns(entity.PolicyParentStudent), childernHandler.GetSpecChildern)
+	protectedParent.Put("/my/childern/update/:id", can("child:write"), owns(entity.PolicyParentStudent), childernHandler.UpdateChildern)
+	protectedParent.Put("/my/childern/status/update/:id", can("child:write"), owns(entity.PolicyParentStudent), childernHandler.UpdateChildernStatus)
+
+	protectedDriver.Get("/shuttle/all", can("shuttle:read"), shuttleHandler.GetAllShuttleByDriver)
+	protectedDriver.Post("/shuttle/add", can("shuttle:write"), shuttleHandler.AddShuttle)
+	protectedDriver.Get("/shuttle/:id", can("shuttle:read"), owns(entity.PolicyDriverShuttle), shuttleHandler.GetSpecShuttle)
+	protectedDriver.Get("/distance", can("driver:distance:read"), routeHandler.GetDriverDistance)
+	protectedDriver.Put("/shuttle/update/:id", can("shuttle:status:update"), owns(entity.PolicyDriverShuttle), shuttleHandler.EditShuttle) 
+	protectedDriver.Put("/shuttle/order/update/:id", can("route:order:update"), owns(entity.PolicyDriverStudent), routeHandler.UpdateStudentOrder)
 }
\ No newline at end of file
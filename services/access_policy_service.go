@@ -0,0 +1,54 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+
+	"shuttle/models/entity"
+	"shuttle/repositories"
+
+	"github.com/google/uuid"
+)
+
+type AccessPolicyServiceInterface interface {
+	CheckAccess(policy entity.AccessPolicy, resourceUUID, userUUID, schoolUUID string) (bool, bool, error)
+}
+
+// Decides whether the caller owns a single resource: parents their own
+// children, drivers the students assigned to them in route_assignment and
+// school admins anything within their school.
+type AccessPolicyService struct {
+	accessPolicyRepository repositories.AccessPolicyRepositoryInterface
+}
+
+func NewAccessPolicyService(accessPolicyRepository repositories.AccessPolicyRepositoryInterface) AccessPolicyService {
+	return AccessPolicyService{
+		accessPolicyRepository: accessPolicyRepository,
+	}
+}
+
+// Returns whether the resource exists and whether the caller may access it.
+// A resource that doesn't exist is left to the handler's own not found response.
+func (service *AccessPolicyService) CheckAccess(policy entity.AccessPolicy, resourceUUID, userUUID, schoolUUID string) (bool, bool, error) {
+	if _, err := uuid.Parse(resourceUUID); err != nil {
+		return false, false, nil
+	}
+
+	ownerUUID := userUUID
+	if strings.HasPrefix(string(policy), "school:") {
+		ownerUUID = schoolUUID
+	}
+	if ownerUUID == "" {
+		return true, false, nil
+	}
+
+	owned, err := service.accessPolicyRepository.CheckOwnership(policy, resourceUUID, ownerUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+
+	return true, owned, nil
+}
@@ -1,8 +1,14 @@
 package services
 
 import (
-	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"math/big"
 	"path/filepath"
 	"time"
 
@@ -20,13 +26,16 @@ import (
 type AuthServiceInterface interface {
 	Login(email, password string) (userDataa dto.UserDataOnLoginDTO, err error)
 	GetMyProfile(userUUID, roleCode string) (interface{}, error)
-	CheckStoredRefreshToken(userID string, refreshToken string) error
-	DeleteRefreshTokenOnLogout(ctx context.Context, userID string) error
+	RotateRefreshToken(userUUID, refreshToken, nextRefreshToken string) error
 	UpdateUserStatus(userUUID, status string, lastActive time.Time) error
-	UpdateRefreshToken(userUUID, refreshToken string) error
-	AddDeviceToken(userUUID, fcmToken string) error
+	AddDeviceToken(userUUID, sessionUUID, fcmToken string) error
+	ChangePassword(userUUID, oldPassword, newPassword, updatedBy string) error
+	RequestPasswordReset(email string) (string, error)
+	ResetPassword(email, code, newPassword string) (string, error)
 }
 
+const maxPasswordResetAttempts = 5
+
 type AuthService struct {
 	authRepository repositories.AuthRepositoryInterface
 	userRepository repositories.UserRepositoryInterface
@@ -60,6 +69,14 @@ func (service AuthService) Login(email, password string) (userData dto.UserDataO
 		return dto.UserDataOnLoginDTO{}, errors.New("invalid email or password", 0)
 	}
 
+	// Self-registered accounts can't sign in until a reviewer approved them
+	switch user.RegisterStatus {
+	case dto.RegisterStatusPending:
+		return dto.UserDataOnLoginDTO{}, errors.New("your registration is still waiting for approval", 403)
+	case dto.RegisterStatusRejected:
+		return dto.UserDataOnLoginDTO{}, errors.New("your registration has been rejected", 403)
+	}
+
 	return userDataOnLogin, nil
 }
 
@@ -75,8 +92,8 @@ func (service *AuthService) GetMyProfile(userUUID, roleCode string) (interface{}
 	}
 
 	var details json.RawMessage
-	switch user.RoleCode {
-	case "SA":
+	switch user.Role {
+	case entity.SuperAdmin:
 		superAdminDetails, err := service.userRepository.FetchSuperAdminDetails(parsedUserUUID)
 		if err != nil {
 			return nil, err
@@ -103,7 +120,7 @@ func (service *AuthService) GetMyProfile(userUUID, roleCode string) (interface{}
 			return nil, err
 		}
 
-	case "AS":
+	case entity.SchoolAdmin:
 		schoolAdminDetails, err := service.userRepository.FetchSchoolAdminDetails(parsedUserUUID)
 		if err != nil {
 			return nil, err
@@ -129,7 +146,7 @@ func (service *AuthService) GetMyProfile(userUUID, roleCode string) (interface{}
 			return nil, err
 		}
 
-	case "P":
+	case entity.Parent:
 		parentDetails, err := service.userRepository.FetchParentDetails(parsedUserUUID)
 		if err != nil {
 			return nil, err
@@ -155,7 +172,7 @@ func (service *AuthService) GetMyProfile(userUUID, roleCode string) (interface{}
 			return nil, err
 		}
 
-	case "D":
+	case entity.Driver:
 		driverDetails, err := service.userRepository.FetchDriverDetails(parsedUserUUID)
 		if err != nil {
 			return nil, err
@@ -182,7 +199,7 @@ func (service *AuthService) GetMyProfile(userUUID, roleCode string) (interface{}
 		}
 
 	default:
-		return nil, errors.New("invalid role code", 0)
+		return nil, errors.New("invalid role", 0)
 	}
 
 	result := dto.UserResponseDTO{
@@ -200,56 +217,74 @@ func (service *AuthService) GetMyProfile(userUUID, roleCode string) (interface{}
 	return result, nil
 }
 
-func (service *AuthService) CheckStoredRefreshToken(userUUID string, refreshToken string) error {
-	refreshTokenEntity, err := service.authRepository.CheckRefreshTokenData(userUUID, refreshToken)
+// Returned when an exchanged refresh token is presented again. The family is
+// revoked already, the caller revokes the session and its access tokens.
+var ErrRefreshTokenReused = errors.New("refresh token has already been used", 401)
+
+// Exchange a refresh token for its successor in the same family.
+// Presenting a token that was already exchanged revokes the whole family.
+func (service *AuthService) RotateRefreshToken(userUUID, refreshToken, nextRefreshToken string) error {
+	tokenData, err := service.authRepository.CheckRefreshTokenData(userUUID, refreshToken)
 	if err != nil {
-		return err
+		return errors.New("invalid refresh token", 401)
 	}
 
-	if refreshTokenEntity.RefreshToken != refreshToken {
-		return errors.New("invalid refresh token", 0)
+	if tokenData.Revoked {
+		return errors.New("refresh token has been revoked", 401)
 	}
 
-	if refreshTokenEntity.ExpiredAt.Before(time.Now()) {
-		return errors.New("refresh token has expired", 0)
+	if tokenData.LastUsedAt != nil {
+		service.revokeReusedRefreshTokenFamily(tokenData)
+		return ErrRefreshTokenReused
 	}
 
-	return nil
-}
+	if tokenData.ExpiredAt.Before(time.Now()) {
+		return errors.New("refresh token has expired", 401)
+	}
+
+	nextTokenData := entity.RefreshToken{
+		ID:           time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6),
+		UserUUID:     tokenData.UserUUID,
+		FamilyUUID:   tokenData.FamilyUUID,
+		RefreshToken: nextRefreshToken,
+		ExpiredAt:    time.Now().Add(time.Hour * 24 * 15),
+	}
 
-func (service *AuthService) DeleteRefreshTokenOnLogout(ctx context.Context, userUUID string) error {
-	err := service.authRepository.DeleteRefreshToken(ctx, userUUID)
+	rotated, err := service.authRepository.RotateRefreshToken(tokenData.ID, nextTokenData)
 	if err != nil {
 		return err
 	}
 
+	// Another request exchanged the same token first
+	if !rotated {
+		service.revokeReusedRefreshTokenFamily(tokenData)
+		return ErrRefreshTokenReused
+	}
+
 	return nil
 }
 
-func (service *AuthService) UpdateUserStatus(userUUID, status string, lastActive time.Time) error {
-	err := service.authRepository.UpdateUserStatus(userUUID, status, lastActive)
-	if err != nil {
-		return err
+func (service *AuthService) revokeReusedRefreshTokenFamily(tokenData entity.RefreshToken) {
+	logger.LogWarn("Refresh token reuse detected, revoking token family", map[string]interface{}{
+		"user_uuid":   tokenData.UserUUID.String(),
+		"family_uuid": tokenData.FamilyUUID.String(),
+		"token_id":    tokenData.ID,
+	})
+
+	if err := service.authRepository.RevokeRefreshTokenFamily(tokenData.FamilyUUID); err != nil {
+		logger.LogError(err, "Failed to revoke refresh token family", map[string]interface{}{
+			"user_uuid":   tokenData.UserUUID.String(),
+			"family_uuid": tokenData.FamilyUUID.String(),
+		})
 	}
-
-	return nil
 }
 
-func (service *AuthService) UpdateRefreshToken(userUUID, refreshToken string) error {
-	tokendata, err := service.authRepository.CheckRefreshTokenData(userUUID, refreshToken)
+func (service *AuthService) UpdateUserStatus(userUUID, status string, lastActive time.Time) error {
+	err := service.authRepository.UpdateUserStatus(userUUID, status, lastActive)
 	if err != nil {
 		return err
 	}
 
-	if tokendata.LastUsedAt != nil && time.Since(*tokendata.LastUsedAt) > time.Hour {
-		_, err := service.authRepository.UpdateRefreshToken(userUUID, refreshToken)
-		if err != nil {
-			return err
-		}
-	} else {
-		return errors.New("cannot reissue a new access token yet", 0)
-	}
-
 	return nil
 }
 
@@ -288,18 +323,156 @@ func validatePassword(providedPassword, storedPassword string) bool {
 	return err == nil
 }
 
-func (service *AuthService) AddDeviceToken(userUUID, fcmToken string) error {
+func (service *AuthService) AddDeviceToken(userUUID, sessionUUID, fcmToken string) error {
+	parsedSessionUUID, err := uuid.Parse(sessionUUID)
+	if err != nil {
+		return errors.New("invalid session UUID format", 0)
+	}
+
 	FCMTokenData := entity.FCMToken{
 		ID:          time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6),
 		UserUUID:    uuid.MustParse(userUUID),
+		SessionUUID: parsedSessionUUID,
 		DeviceToken: fcmToken,
 		CreatedAt:   time.Now(),
 	}
 
-	err := service.authRepository.SaveDeviceToken(FCMTokenData)
+	err = service.authRepository.SaveDeviceToken(FCMTokenData)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (service *AuthService) ChangePassword(userUUID, oldPassword, newPassword, updatedBy string) error {
+	parsedUserUUID, err := uuid.Parse(userUUID)
+	if err != nil {
+		return errors.New("invalid user UUID format", 0)
+	}
+
+	storedPassword, err := service.authRepository.FetchPasswordByUUID(parsedUserUUID)
+	if err != nil {
+		return err
+	}
+
+	if !validatePassword(oldPassword, storedPassword) {
+		return errors.New("old password is incorrect", 400)
+	}
+
+	if oldPassword == newPassword {
+		return errors.New("new password must be different from the old password", 400)
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return service.authRepository.UpdatePassword(parsedUserUUID, hashedPassword, updatedBy)
+}
+
+// Issue a single-use reset code for the account. An empty code without an
+// error means the email is unknown, callers must not reveal that difference.
+func (service *AuthService) RequestPasswordReset(email string) (string, error) {
+	user, err := service.authRepository.Login(email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+
+	parsedUserUUID, err := uuid.Parse(user.UUID)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := generateResetCode()
+	if err != nil {
+		return "", err
+	}
+
+	ttl := viper.GetDuration("PASSWORD_RESET_CODE_TTL")
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+
+	err = service.authRepository.SavePasswordResetCode(entity.PasswordResetCode{
+		ID:        time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6),
+		UserUUID:  parsedUserUUID,
+		CodeHash:  hashResetCode(code),
+		ExpiredAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// Consume a reset code and set the new password, returning the user UUID
+func (service *AuthService) ResetPassword(email, code, newPassword string) (string, error) {
+	invalidCodeErr := errors.New("reset code is invalid or has expired", 400)
+
+	user, err := service.authRepository.Login(email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", invalidCodeErr
+		}
+		return "", err
+	}
+
+	parsedUserUUID, err := uuid.Parse(user.UUID)
+	if err != nil {
+		return "", err
+	}
+
+	resetCode, err := service.authRepository.FetchActivePasswordResetCode(parsedUserUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", invalidCodeErr
+		}
+		return "", err
+	}
+
+	if resetCode.Attempts >= maxPasswordResetAttempts {
+		return "", invalidCodeErr
+	}
+
+	if subtle.ConstantTimeCompare([]byte(resetCode.CodeHash), []byte(hashResetCode(code))) != 1 {
+		if err := service.authRepository.IncrementPasswordResetAttempts(resetCode.ID); err != nil {
+			return "", err
+		}
+		return "", invalidCodeErr
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return "", err
+	}
+
+	reset, err := service.authRepository.ResetPassword(resetCode.ID, parsedUserUUID, hashedPassword)
+	if err != nil {
+		return "", err
+	}
+	if !reset {
+		return "", invalidCodeErr
+	}
+
+	return user.UUID, nil
+}
+
+func generateResetCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1e6))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashResetCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"shuttle/errors"
+	"shuttle/models/dto"
+	"shuttle/models/entity"
+	"shuttle/repositories"
+
+	"github.com/google/uuid"
+	"github.com/umahmood/haversine"
+)
+
+// Longest range a single replay may cover
+const maxLocationHistoryRange = 31 * 24 * time.Hour
+
+// Positions older than that are flagged stale on the fleet map, the last
+// position is only looked for within fleetPositionMaxAge
+const (
+	fleetStaleAfter     = 2 * time.Minute
+	fleetPositionMaxAge = 24 * time.Hour
+)
+
+type LocationServiceInterface interface {
+	GetShuttlePath(shuttleUUID string, from, to time.Time) (dto.GeoJSONFeatureCollection, error)
+	GetDriverPath(driverUUID string, from, to time.Time) (dto.GeoJSONFeatureCollection, error)
+	GetSchoolFleet(schoolUUID string) (dto.FleetResponseDTO, error)
+}
+
+// Replays the pings drivers broadcast over the websocket, they are stored as
+// they arrive in the shuttle_locations table
+type LocationService struct {
+	locationRepository repositories.LocationRepositoryInterface
+}
+
+func NewLocationService(locationRepository repositories.LocationRepositoryInterface) LocationService {
+	return LocationService{
+		locationRepository: locationRepository,
+	}
+}
+
+// The path of one shuttle as a single LineString feature
+func (service *LocationService) GetShuttlePath(shuttleUUID string, from, to time.Time) (dto.GeoJSONFeatureCollection, error) {
+	parsedShuttleUUID, err := uuid.Parse(shuttleUUID)
+	if err != nil {
+		return dto.GeoJSONFeatureCollection{}, errors.New("invalid shuttle UUID", 400)
+	}
+
+	if err := validateLocationRange(from, to); err != nil {
+		return dto.GeoJSONFeatureCollection{}, err
+	}
+
+	locations, err := service.locationRepository.FetchShuttleLocations(parsedShuttleUUID, from, to)
+	if err != nil {
+		return dto.GeoJSONFeatureCollection{}, err
+	}
+
+	return buildPathCollection(locations), nil
+}
+
+// Every shuttle the driver drove within the range as its own feature
+func (service *LocationService) GetDriverPath(driverUUID string, from, to time.Time) (dto.GeoJSONFeatureCollection, error) {
+	parsedDriverUUID, err := uuid.Parse(driverUUID)
+	if err != nil {
+		return dto.GeoJSONFeatureCollection{}, errors.New("invalid driver UUID", 400)
+	}
+
+	if err := validateLocationRange(from, to); err != nil {
+		return dto.GeoJSONFeatureCollection{}, err
+	}
+
+	locations, err := service.locationRepository.FetchDriverLocations(parsedDriverUUID, from, to)
+	if err != nil {
+		return dto.GeoJSONFeatureCollection{}, err
+	}
+
+	return buildPathCollection(locations), nil
+}
+
+// Every driver of the school with their vehicle, where they were last seen and
+// today's shuttles by status, for the dispatcher map
+func (service *LocationService) GetSchoolFleet(schoolUUID string) (dto.FleetResponseDTO, error) {
+	parsedSchoolUUID, err := uuid.Parse(schoolUUID)
+	if err != nil {
+		return dto.FleetResponseDTO{}, errors.New("invalid school UUID", 400)
+	}
+
+	drivers, err := service.locationRepository.FetchSchoolFleet(parsedSchoolUUID)
+	if err != nil {
+		return dto.FleetResponseDTO{}, err
+	}
+
+	now := time.Now()
+	locations, err := service.locationRepository.FetchSchoolLastLocations(parsedSchoolUUID, now.Add(-fleetPositionMaxAge))
+	if err != nil {
+		return dto.FleetResponseDTO{}, err
+	}
+
+	counts, err := service.locationRepository.CountSchoolShuttleStatuses(parsedSchoolUUID)
+	if err != nil {
+		return dto.FleetResponseDTO{}, err
+	}
+
+	lastLocations := make(map[uuid.UUID]entity.ShuttleLocation, len(locations))
+	for _, location := range locations {
+		lastLocations[location.DriverUUID] = location
+	}
+
+	fleet := dto.FleetResponseDTO{
+		SchoolUUID:   schoolUUID,
+		StatusCounts: make(map[string]int),
+		Vehicles:     make([]dto.FleetVehicleDTO, 0, len(drivers)),
+		GeneratedAt:  now.Format(time.RFC3339),
+	}
+
+	driverCounts := make(map[uuid.UUID]map[string]int)
+	for _, count := range counts {
+		if _, exists := driverCounts[count.DriverUUID]; !exists {
+			driverCounts[count.DriverUUID] = make(map[string]int)
+		}
+		driverCounts[count.DriverUUID][count.Status] += count.Count
+		fleet.StatusCounts[count.Status] += count.Count
+	}
+
+	for _, driver := range drivers {
+		vehicle := dto.FleetVehicleDTO{
+			DriverUUID:    driver.DriverUUID.String(),
+			DriverName:    strings.TrimSpace(driver.FirstName.String + " " + driver.LastName.String),
+			DriverStatus:  driver.Status.String,
+			VehicleUUID:   driver.VehicleUUID.String,
+			VehicleName:   driver.VehicleName.String,
+			VehicleNumber: driver.VehicleNumber.String,
+			StatusCounts:  make(map[string]int),
+		}
+		if vehicle.DriverName == "" {
+			vehicle.DriverName = driver.Username
+		}
+		if driver.LastActive.Valid {
+			vehicle.DriverLastActive = driver.LastActive.Time.Format(time.RFC3339)
+		}
+
+		for status, count := range driverCounts[driver.DriverUUID] {
+			vehicle.StatusCounts[status] = count
+			// Students still on their way, the same ones the silent driver alerts watch
+			if status != "home" && status != "at_school" {
+				vehicle.Active = true
+			}
+		}
+
+		if location, exists := lastLocations[driver.DriverUUID]; exists {
+			age := now.Sub(location.RecordedAt)
+			position := &dto.FleetPositionDTO{
+				ShuttleUUID: location.ShuttleUUID.String(),
+				Latitude:    location.Latitude,
+				Longitude:   location.Longitude,
+				RecordedAt:  location.RecordedAt.Format(time.RFC3339),
+				AgeSeconds:  int64(age.Seconds()),
+				Stale:       age > fleetStaleAfter,
+			}
+			if location.Speed.Valid {
+				position.Speed = &location.Speed.Float64
+			}
+			if location.Heading.Valid {
+				position.Heading = &location.Heading.Float64
+			}
+			vehicle.LastPosition = position
+		}
+
+		fleet.Vehicles = append(fleet.Vehicles, vehicle)
+	}
+
+	return fleet, nil
+}
+
+func validateLocationRange(from, to time.Time) error {
+	if !to.After(from) {
+		return errors.New("the end of the range must be after its start", 400)
+	}
+	if to.Sub(from) > maxLocationHistoryRange {
+		return errors.New("the range can't be longer than 31 days", 400)
+	}
+	return nil
+}
+
+// Groups the locations, already ordered by time, into one feature per shuttle.
+// Timestamps, speeds and headings follow the coordinates index by index, the
+// same way coordTimes is used by most GeoJSON track viewers.
+func buildPathCollection(locations []entity.ShuttleLocation) dto.GeoJSONFeatureCollection {
+	collection := dto.GeoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []dto.GeoJSONFeature{},
+	}
+
+	var order []uuid.UUID
+	trips := make(map[uuid.UUID][]entity.ShuttleLocation)
+	for _, location := range locations {
+		if _, exists := trips[location.ShuttleUUID]; !exists {
+			order = append(order, location.ShuttleUUID)
+		}
+		trips[location.ShuttleUUID] = append(trips[location.ShuttleUUID], location)
+	}
+
+	for _, shuttleUUID := range order {
+		collection.Features = append(collection.Features, buildPathFeature(trips[shuttleUUID]))
+	}
+
+	return collection
+}
+
+func buildPathFeature(points []entity.ShuttleLocation) dto.GeoJSONFeature {
+	coordinates := make([][]float64, 0, len(points))
+	coordTimes := make([]string, 0, len(points))
+	speeds := make([]interface{}, 0, len(points))
+	headings := make([]interface{}, 0, len(points))
+	distance := 0.0
+
+	for i, point := range points {
+		// GeoJSON positions are longitude first
+		coordinates = append(coordinates, []float64{point.Longitude, point.Latitude})
+		coordTimes = append(coordTimes, point.RecordedAt.Format(time.RFC3339))
+
+		if point.Speed.Valid {
+			speeds = append(speeds, point.Speed.Float64)
+		} else {
+			speeds = append(speeds, nil)
+		}
+		if point.Heading.Valid {
+			headings = append(headings, point.Heading.Float64)
+		} else {
+			headings = append(headings, nil)
+		}
+
+		if i > 0 {
+			previous := points[i-1]
+			_, km := haversine.Distance(
+				haversine.Coord{Lat: previous.Latitude, Lon: previous.Longitude},
+				haversine.Coord{Lat: point.Latitude, Lon: point.Longitude},
+			)
+			distance += km
+		}
+	}
+
+	first, last := points[0], points[len(points)-1]
+
+	// A LineString needs at least two positions
+	geometry := dto.GeoJSONGeometry{Type: "LineString", Coordinates: coordinates}
+	if len(coordinates) == 1 {
+		geometry = dto.GeoJSONGeometry{Type: "Point", Coordinates: coordinates[0]}
+	}
+
+	return dto.GeoJSONFeature{
+		Type:     "Feature",
+		Geometry: geometry,
+		Properties: map[string]interface{}{
+			"shuttle_uuid":     first.ShuttleUUID.String(),
+			"driver_uuid":      first.DriverUUID.String(),
+			"started_at":       first.RecordedAt.Format(time.RFC3339),
+			"ended_at":         last.RecordedAt.Format(time.RFC3339),
+			"duration_seconds": int64(last.RecordedAt.Sub(first.RecordedAt).Seconds()),
+			"distance_km":      distance,
+			"point_count":      len(points),
+			"coordTimes":       coordTimes,
+			"speeds":           speeds,
+			"headings":         headings,
+		},
+	}
+}
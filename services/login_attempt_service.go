@@ -0,0 +1,300 @@
+package services
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+
+	"shuttle/errors"
+	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/models/entity"
+	"shuttle/repositories"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+type LoginAttemptServiceInterface interface {
+	CheckLoginAllowed(email, ipAddress string) (time.Duration, error)
+	RecordLoginSuccess(email, ipAddress, userAgent, userUUID string)
+	RecordLoginFailure(email, ipAddress, userAgent, reason string)
+	CountPasswordResetRequest(email, ipAddress string) (bool, time.Duration, error)
+	UnlockUser(userUUID string) error
+	GetLoginHistory(page, limit int, filter entity.LoginHistoryFilter) ([]dto.LoginHistoryResponseDTO, int, error)
+}
+
+// Failures are counted per account and per IP. Once a counter reaches its
+// threshold the key is locked, and every further failure doubles the lockout.
+type LoginAttemptService struct {
+	loginAttemptRepository repositories.LoginAttemptRepositoryInterface
+	userRepository         repositories.UserRepositoryInterface
+	maxAccountFailures     int
+	maxIPFailures          int
+	failureWindow          time.Duration
+	baseLockout            time.Duration
+	maxLockout             time.Duration
+	maxResetsPerEmail      int
+	maxResetsPerIP         int
+	resetWindow            time.Duration
+}
+
+func NewLoginAttemptService(loginAttemptRepository repositories.LoginAttemptRepositoryInterface, userRepository repositories.UserRepositoryInterface) LoginAttemptService {
+	service := LoginAttemptService{
+		loginAttemptRepository: loginAttemptRepository,
+		userRepository:         userRepository,
+		maxAccountFailures:     viper.GetInt("LOGIN_MAX_FAILED_ATTEMPTS"),
+		maxIPFailures:          viper.GetInt("LOGIN_MAX_FAILED_ATTEMPTS_PER_IP"),
+		failureWindow:          viper.GetDuration("LOGIN_FAILURE_WINDOW"),
+		baseLockout:            viper.GetDuration("LOGIN_LOCKOUT_BASE"),
+		maxLockout:             viper.GetDuration("LOGIN_LOCKOUT_MAX"),
+		maxResetsPerEmail:      viper.GetInt("PASSWORD_RESET_MAX_PER_EMAIL"),
+		maxResetsPerIP:         viper.GetInt("PASSWORD_RESET_MAX_PER_IP"),
+		resetWindow:            viper.GetDuration("PASSWORD_RESET_WINDOW"),
+	}
+
+	if service.maxAccountFailures <= 0 {
+		service.maxAccountFailures = 5
+	}
+	if service.maxIPFailures <= 0 {
+		service.maxIPFailures = 20
+	}
+	if service.failureWindow <= 0 {
+		service.failureWindow = 15 * time.Minute
+	}
+	if service.baseLockout <= 0 {
+		service.baseLockout = time.Minute
+	}
+	if service.maxLockout <= 0 {
+		service.maxLockout = time.Hour
+	}
+	if service.maxResetsPerEmail <= 0 {
+		service.maxResetsPerEmail = 3
+	}
+	if service.maxResetsPerIP <= 0 {
+		service.maxResetsPerIP = 10
+	}
+	if service.resetWindow <= 0 {
+		service.resetWindow = time.Hour
+	}
+
+	return service
+}
+
+// Returns how long the caller has to wait when the account or IP is locked
+func (service *LoginAttemptService) CheckLoginAllowed(email, ipAddress string) (time.Duration, error) {
+	throttles, err := service.loginAttemptRepository.FetchLoginThrottles([]string{accountThrottleKey(email), ipThrottleKey(ipAddress)})
+	if err != nil {
+		return 0, err
+	}
+
+	var retryAfter time.Duration
+	now := time.Now()
+	for _, throttle := range throttles {
+		if throttle.LockedUntil.Valid && throttle.LockedUntil.Time.After(now) {
+			if wait := throttle.LockedUntil.Time.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	return retryAfter, nil
+}
+
+func (service *LoginAttemptService) RecordLoginSuccess(email, ipAddress, userAgent, userUUID string) {
+	// Only the account counter is cleared, one valid account must not reset an attacking IP
+	if err := service.loginAttemptRepository.DeleteLoginThrottle(accountThrottleKey(email)); err != nil {
+		logger.LogError(err, "Failed to reset login throttle", map[string]interface{}{
+			"email": email,
+		})
+	}
+
+	var parsedUserUUID *uuid.UUID
+	if parsed, err := uuid.Parse(userUUID); err == nil {
+		parsedUserUUID = &parsed
+	}
+
+	service.saveLoginAttempt(entity.LoginAttempt{
+		UserUUID:  parsedUserUUID,
+		Email:     email,
+		IPAddress: toNullString(ipAddress),
+		UserAgent: toNullString(userAgent),
+		Success:   true,
+	})
+}
+
+// Record a failed attempt. Only wrong passwords and wrong two-factor codes
+// count towards a lockout, attempts rejected for any other reason (an active
+// lockout, an account still waiting for approval) are only written to the history.
+func (service *LoginAttemptService) RecordLoginFailure(email, ipAddress, userAgent, reason string) {
+	service.saveLoginAttempt(entity.LoginAttempt{
+		UserUUID:      service.attemptedUserUUID(email),
+		Email:         email,
+		IPAddress:     toNullString(ipAddress),
+		UserAgent:     toNullString(userAgent),
+		Success:       false,
+		FailureReason: toNullString(reason),
+	})
+
+	if reason != "invalid_credentials" && reason != "invalid_two_factor_code" {
+		return
+	}
+
+	service.registerFailure(accountThrottleKey(email), service.maxAccountFailures)
+	service.registerFailure(ipThrottleKey(ipAddress), service.maxIPFailures)
+}
+
+// Failures against an existing account show up in its history, unknown
+// emails are only kept with the email
+func (service *LoginAttemptService) attemptedUserUUID(email string) *uuid.UUID {
+	userUUID, err := service.userRepository.FetchUUIDByEmail(email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogWarn("Failed to look up the user of a login attempt", map[string]interface{}{
+				"email": email,
+				"error": err.Error(),
+			})
+		}
+		return nil
+	}
+
+	return &userUUID
+}
+
+// Password reset requests are counted in the login throttles too, under keys
+// of their own. Returns whether a code may be mailed to the email, and how
+// long the IP has to wait when it sent too many requests. An email past its
+// limit is answered like any other so accounts can't be enumerated.
+func (service *LoginAttemptService) CountPasswordResetRequest(email, ipAddress string) (bool, time.Duration, error) {
+	ipCount, err := service.loginAttemptRepository.IncrementFailedLogin(resetIPThrottleKey(ipAddress), service.resetWindow)
+	if err != nil {
+		return false, 0, err
+	}
+	if ipCount > service.maxResetsPerIP {
+		return false, service.resetWindow, nil
+	}
+
+	emailCount, err := service.loginAttemptRepository.IncrementFailedLogin(resetAccountThrottleKey(email), service.resetWindow)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return emailCount <= service.maxResetsPerEmail, 0, nil
+}
+
+func (service *LoginAttemptService) registerFailure(key string, threshold int) {
+	failedCount, err := service.loginAttemptRepository.IncrementFailedLogin(key, service.failureWindow)
+	if err != nil {
+		logger.LogError(err, "Failed to count failed login", map[string]interface{}{
+			"throttle_key": key,
+		})
+		return
+	}
+
+	if failedCount < threshold {
+		return
+	}
+
+	lockout := service.lockoutDuration(failedCount - threshold)
+	if err := service.loginAttemptRepository.LockLoginThrottle(key, time.Now().Add(lockout)); err != nil {
+		logger.LogError(err, "Failed to lock login throttle", map[string]interface{}{
+			"throttle_key": key,
+		})
+		return
+	}
+
+	logger.LogWarn("Login locked after repeated failures", map[string]interface{}{
+		"throttle_key": key,
+		"failed_count": failedCount,
+		"lockout":      lockout.String(),
+	})
+}
+
+func (service *LoginAttemptService) lockoutDuration(exceeded int) time.Duration {
+	lockout := float64(service.baseLockout) * math.Pow(2, float64(exceeded))
+	if lockout > float64(service.maxLockout) {
+		return service.maxLockout
+	}
+
+	return time.Duration(lockout)
+}
+
+func (service *LoginAttemptService) saveLoginAttempt(attempt entity.LoginAttempt) {
+	attempt.ID = time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6)
+	attempt.Email = normalizeEmail(attempt.Email)
+
+	if err := service.loginAttemptRepository.SaveLoginAttempt(attempt); err != nil {
+		logger.LogError(err, "Failed to save login attempt", map[string]interface{}{
+			"email": attempt.Email,
+		})
+	}
+}
+
+func (service *LoginAttemptService) UnlockUser(userUUID string) error {
+	if _, err := uuid.Parse(userUUID); err != nil {
+		return errors.New("invalid user UUID format", 400)
+	}
+
+	user, err := service.userRepository.FetchSpecificUser(userUUID)
+	if err != nil {
+		return errors.New("user not found", 404)
+	}
+
+	return service.loginAttemptRepository.DeleteLoginThrottle(accountThrottleKey(user.Email))
+}
+
+func (service *LoginAttemptService) GetLoginHistory(page, limit int, filter entity.LoginHistoryFilter) ([]dto.LoginHistoryResponseDTO, int, error) {
+	offset := (page - 1) * limit
+
+	attempts, err := service.loginAttemptRepository.FetchLoginHistory(filter, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := service.loginAttemptRepository.CountLoginHistory(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var attemptsDTO []dto.LoginHistoryResponseDTO
+	for _, attempt := range attempts {
+		userUUID := "N/A"
+		if attempt.UserUUID != nil {
+			userUUID = attempt.UserUUID.String()
+		}
+
+		attemptsDTO = append(attemptsDTO, dto.LoginHistoryResponseDTO{
+			ID:            attempt.ID,
+			UserUUID:      userUUID,
+			Email:         attempt.Email,
+			IPAddress:     safeStringFormat(attempt.IPAddress),
+			UserAgent:     safeStringFormat(attempt.UserAgent),
+			Success:       attempt.Success,
+			FailureReason: safeStringFormat(attempt.FailureReason),
+			CreatedAt:     attempt.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return attemptsDTO, total, nil
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + normalizeEmail(email)
+}
+
+func ipThrottleKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
+
+func resetAccountThrottleKey(email string) string {
+	return "reset:account:" + normalizeEmail(email)
+}
+
+func resetIPThrottleKey(ipAddress string) string {
+	return "reset:ip:" + ipAddress
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
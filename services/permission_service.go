@@ -0,0 +1,248 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"shuttle/errors"
+	"shuttle/models/dto"
+	"shuttle/models/entity"
+	"shuttle/repositories"
+
+	"github.com/spf13/viper"
+)
+
+type PermissionServiceInterface interface {
+	HasPermission(roleCode, permission string) (bool, error)
+	GetAllRoles() ([]dto.RoleResponseDTO, error)
+	GetAllPermissions() ([]dto.PermissionResponseDTO, error)
+	AddRole(req dto.RoleRequestDTO, createdBy string) error
+	UpdateRole(roleCode string, req dto.RoleRequestDTO, updatedBy string) error
+	CheckRoleGrant(granterRoleCode, roleCode, builtInRoleCode string) error
+}
+
+// Role permissions are checked on every request, so they are cached per role.
+// Changes made through this service apply at once on this instance and after
+// PERMISSION_CACHE_TTL on the others.
+type rolePermissionCache struct {
+	entries map[string]rolePermissionCacheEntry
+	mutex   sync.RWMutex
+	ttl     time.Duration
+}
+
+type rolePermissionCacheEntry struct {
+	permissions map[string]bool
+	expiresAt   time.Time
+}
+
+type PermissionService struct {
+	permissionRepository repositories.PermissionRepositoryInterface
+	cache                *rolePermissionCache
+}
+
+func NewPermissionService(permissionRepository repositories.PermissionRepositoryInterface) PermissionService {
+	ttl := viper.GetDuration("PERMISSION_CACHE_TTL")
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	return PermissionService{
+		permissionRepository: permissionRepository,
+		cache: &rolePermissionCache{
+			entries: make(map[string]rolePermissionCacheEntry),
+			ttl:     ttl,
+		},
+	}
+}
+
+func (service *PermissionService) HasPermission(roleCode, permission string) (bool, error) {
+	service.cache.mutex.RLock()
+	entry, found := service.cache.entries[roleCode]
+	service.cache.mutex.RUnlock()
+
+	if !found || time.Now().After(entry.expiresAt) {
+		permissionCodes, err := service.permissionRepository.FetchPermissionCodesByRole(roleCode)
+		if err != nil {
+			return false, err
+		}
+
+		entry = rolePermissionCacheEntry{
+			permissions: make(map[string]bool, len(permissionCodes)),
+			expiresAt:   time.Now().Add(service.cache.ttl),
+		}
+		for _, permissionCode := range permissionCodes {
+			entry.permissions[permissionCode] = true
+		}
+
+		service.cache.mutex.Lock()
+		service.cache.entries[roleCode] = entry
+		service.cache.mutex.Unlock()
+	}
+
+	return entry.permissions[permission], nil
+}
+
+func (service *PermissionService) GetAllRoles() ([]dto.RoleResponseDTO, error) {
+	roles, err := service.permissionRepository.FetchAllRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	var rolesDTO []dto.RoleResponseDTO
+	for _, role := range roles {
+		permissionCodes, err := service.permissionRepository.FetchPermissionCodesByRole(role.Code)
+		if err != nil {
+			return nil, err
+		}
+
+		rolesDTO = append(rolesDTO, dto.RoleResponseDTO{
+			Code:              role.Code,
+			Name:              role.Name,
+			Description:       safeStringFormat(role.Description),
+			TwoFactorRequired: role.TwoFactorRequired,
+			Permissions:       permissionCodes,
+			CreatedAt:         safeTimeFormat(role.CreatedAt),
+		})
+	}
+
+	return rolesDTO, nil
+}
+
+func (service *PermissionService) GetAllPermissions() ([]dto.PermissionResponseDTO, error) {
+	permissions, err := service.permissionRepository.FetchAllPermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	var permissionsDTO []dto.PermissionResponseDTO
+	for _, permission := range permissions {
+		permissionsDTO = append(permissionsDTO, dto.PermissionResponseDTO{
+			Code:        permission.Code,
+			Description: permission.Description,
+		})
+	}
+
+	return permissionsDTO, nil
+}
+
+func (service *PermissionService) AddRole(req dto.RoleRequestDTO, createdBy string) error {
+	exists, err := service.permissionRepository.CheckRoleExists(req.Code)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("role code already exists", 409)
+	}
+
+	if err := service.validatePermissionCodes(req.Permissions); err != nil {
+		return err
+	}
+
+	role := entity.AccessRole{
+		Code:              req.Code,
+		Name:              req.Name,
+		Description:       toNullString(req.Description),
+		TwoFactorRequired: req.TwoFactorRequired,
+		CreatedBy:         toNullString(createdBy),
+	}
+
+	if err := service.permissionRepository.SaveRole(role, req.Permissions); err != nil {
+		return err
+	}
+
+	service.invalidateRole(req.Code)
+	return nil
+}
+
+func (service *PermissionService) UpdateRole(roleCode string, req dto.RoleRequestDTO, updatedBy string) error {
+	if req.Code != roleCode {
+		return errors.New("role code can't be changed", 400)
+	}
+
+	exists, err := service.permissionRepository.CheckRoleExists(roleCode)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("role not found", 404)
+	}
+
+	if err := service.validatePermissionCodes(req.Permissions); err != nil {
+		return err
+	}
+
+	role := entity.AccessRole{
+		Code:              roleCode,
+		Name:              req.Name,
+		Description:       toNullString(req.Description),
+		TwoFactorRequired: req.TwoFactorRequired,
+		UpdatedBy:         toNullString(updatedBy),
+	}
+
+	if err := service.permissionRepository.UpdateRole(role, req.Permissions); err != nil {
+		return err
+	}
+
+	service.invalidateRole(roleCode)
+	return nil
+}
+
+// A custom role can only be given by someone who manages roles, and only to a
+// user whose built-in role already holds every permission of it. A school
+// admin can get a read-only school admin role but never a super admin one.
+func (service *PermissionService) CheckRoleGrant(granterRoleCode, roleCode, builtInRoleCode string) error {
+	canManage, err := service.HasPermission(granterRoleCode, "role:manage")
+	if err != nil {
+		return err
+	}
+	if !canManage {
+		return errors.New("you don't have permission to assign custom roles", 403)
+	}
+
+	exists, err := service.permissionRepository.CheckRoleExists(roleCode)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("role not found", 404)
+	}
+
+	permissionCodes, err := service.permissionRepository.FetchPermissionCodesByRole(roleCode)
+	if err != nil {
+		return err
+	}
+	for _, permissionCode := range permissionCodes {
+		allowed, err := service.HasPermission(builtInRoleCode, permissionCode)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return errors.New("the role has permissions this kind of user can't have", 403)
+		}
+	}
+
+	return nil
+}
+
+func (service *PermissionService) validatePermissionCodes(permissionCodes []string) error {
+	unique := make(map[string]bool, len(permissionCodes))
+	for _, permissionCode := range permissionCodes {
+		unique[permissionCode] = true
+	}
+
+	count, err := service.permissionRepository.CountPermissions(permissionCodes)
+	if err != nil {
+		return err
+	}
+	if count != len(unique) {
+		return errors.New("one or more permissions don't exist", 400)
+	}
+
+	return nil
+}
+
+func (service *PermissionService) invalidateRole(roleCode string) {
+	service.cache.mutex.Lock()
+	delete(service.cache.entries, roleCode)
+	service.cache.mutex.Unlock()
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+
+	"shuttle/errors"
+	"shuttle/models/entity"
+)
+
+type fakePermissionRepository struct {
+	rolePermissions map[string][]string
+}
+
+func (r *fakePermissionRepository) FetchPermissionCodesByRole(roleCode string) ([]string, error) {
+	return r.rolePermissions[roleCode], nil
+}
+
+func (r *fakePermissionRepository) FetchAllRoles() ([]entity.AccessRole, error) { return nil, nil }
+
+func (r *fakePermissionRepository) FetchAllPermissions() ([]entity.Permission, error) {
+	return nil, nil
+}
+
+func (r *fakePermissionRepository) CountPermissions(permissionCodes []string) (int, error) {
+	return len(permissionCodes), nil
+}
+
+func (r *fakePermissionRepository) CheckRoleExists(roleCode string) (bool, error) {
+	_, exists := r.rolePermissions[roleCode]
+	return exists, nil
+}
+
+func (r *fakePermissionRepository) SaveRole(role entity.AccessRole, permissionCodes []string) error {
+	return nil
+}
+
+func (r *fakePermissionRepository) UpdateRole(role entity.AccessRole, permissionCodes []string) error {
+	return nil
+}
+
+func TestCheckRoleGrant(t *testing.T) {
+	service := NewPermissionService(&fakePermissionRepository{rolePermissions: map[string][]string{
+		"SA":         {"account:self", "role:manage", "user:write", "school:write"},
+		"AS":         {"account:self", "school:student:read", "school:student:write", "school:fleet:read"},
+		"D":          {"account:self", "driver:route:read"},
+		"AS_READ":    {"account:self", "school:student:read", "school:fleet:read"},
+		"DISPATCHER": {"account:self", "school:fleet:read"},
+		"AS_ROLES":   {"account:self", "role:manage"},
+	}})
+
+	tests := []struct {
+		name       string
+		granter    string
+		role       string
+		builtIn    string
+		wantStatus int
+	}{
+		{"super admin assigns a read-only school admin role", "SA", "AS_READ", "AS", 0},
+		{"super admin assigns a dispatcher role", "SA", "DISPATCHER", "AS", 0},
+		{"school admin can't manage roles", "AS", "AS_READ", "AS", 403},
+		{"role beyond the built-in role of the user", "SA", "AS_ROLES", "AS", 403},
+		{"school admin role for a driver", "SA", "AS_READ", "D", 403},
+		{"unknown role", "SA", "MISSING", "AS", 404},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := service.CheckRoleGrant(test.granter, test.role, test.builtIn)
+			if test.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("expected the grant to pass, got %v", err)
+				}
+				return
+			}
+
+			customErr, ok := err.(*errors.CustomError)
+			if !ok {
+				t.Fatalf("expected a %d error, got %v", test.wantStatus, err)
+			}
+			if customErr.StatusCode != test.wantStatus {
+				t.Fatalf("expected status %d, got %d (%s)", test.wantStatus, customErr.StatusCode, customErr.Message)
+			}
+		})
+	}
+}
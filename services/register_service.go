@@ -1,241 +1,280 @@
 package services
 
-// import (
-// 	// "database/sql"
-// 	// "encoding/json"
-// 	"database/sql"
-// 	"encoding/json"
-// 	"fmt"
-
-// 	// "log"
-
-// 	"shuttle/errors"
-// 	// "shuttle/logger"
-// 	"shuttle/models/dto"
-// 	"shuttle/models/entity"
-// 	"shuttle/repositories"
-// 	"time"
-
-// 	"github.com/google/uuid"
-// 	"github.com/jmoiron/sqlx"
-// )
-
-// type RegisterServiceInterface interface {
-// 	AddUserRegister(req dto.UserRequestsDTO, user_name string) (uuid.UUID, error)
-// 	ApproveUserRegister(userUUID uuid.UUID, username string, approverRole string) error
-// }
-
-// type RegisterService struct {
-// 	registerRepository repositories.RegisterRepositoryInterface
-// }
-
-// func NewRegisterService(registerRepository repositories.RegisterRepositoryInterface) RegisterService {
-// 	return RegisterService{
-// 		registerRepository: registerRepository,
-// 	}
-// }
-
-// func (s *RegisterService) AddUserRegister(req dto.UserRequestsDTO, user_name string) (uuid.UUID, error) {
-// 	if req.RoleCode == "SA" {
-// 		return uuid.Nil, fmt.Errorf("superadmin tidak dapat melakukan self-registration")
-// 	}
-
-// 	exists, err := s.registerRepository.CheckEmailExistForRegister("", req.Email)
-// 	if err != nil {
-// 		return uuid.Nil, err
-// 	}
-// 	if exists {
-// 		return uuid.Nil, fmt.Errorf("email %s sudah terdaftar", req.Email)
-// 	}
-
-// 	exists, err = s.registerRepository.CheckUsernameExistForRegister("", req.Username)
-// 	if err != nil {
-// 		return uuid.Nil, err
-// 	}
-// 	if exists {
-// 		return uuid.Nil, fmt.Errorf("username %s sudah terdaftar", req.Username)
-// 	}
-
-// 	if req.Password != "" {
-// 		hashedPassword, err := hashPassword(req.Password)
-// 		if err != nil {
-// 			return uuid.Nil, err
-// 		}
-// 		req.Password = hashedPassword
-// 	}
-
-// 	tx, err := s.registerRepository.BeginTransaction()
-// 	if err != nil {
-// 		return uuid.Nil, fmt.Errorf("gagal memulai transaksi: %w", err)
-// 	}
-
-// 	var transactionErr error
-// 	defer func() {
-// 		if transactionErr != nil {
-// 			tx.Rollback()
-// 		} else {
-// 			transactionErr = tx.Commit()
-// 		}
-// 	}()
-
-// 	userEntity := entity.User{
-// 		ID:             time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6),
-// 		UUID:           uuid.New(),
-// 		Username:       req.Username,
-// 		Email:          req.Email,
-// 		Password:       req.Password,
-// 		Role:           entity.Role(req.Role),
-// 		RoleCode:       req.RoleCode,
-// 		RegisterStatus: "PENDING", // Selalu pending untuk approval
-// 	}
-
-// 	userUUID, err := s.registerRepository.SaveUserRegister(tx, userEntity)
-// 	if err != nil {
-// 		transactionErr = fmt.Errorf("gagal menyimpan user: %w", err)
-// 		return uuid.Nil, transactionErr
-// 	}
-
-// 	if err := s.saveRoleRegisterDetails(tx, userEntity.UUID, req); err != nil {
-// 		transactionErr = fmt.Errorf("gagal menyimpan detail user: %w", err)
-// 		return uuid.Nil, transactionErr
-// 	}
-
-// 	return userUUID, nil
-// }
-
-// func (s *RegisterService) saveRoleRegisterDetails(tx *sqlx.Tx, userUUID uuid.UUID, req dto.UserRequestsDTO) error {
-// 	switch entity.Role(req.Role) {
-// 	case entity.SchoolAdmin:
-// 		parsedDetails, err := parseDetails[dto.SchoolAdminDetailsRequestsDTO](req.Details)
-// 		if err != nil {
-// 			return errors.New("invalid school admin details format: " + err.Error(), 400)
-// 		}
-// 		if parsedDetails.SchoolUUID == "" && (parsedDetails.School.Name == "" || parsedDetails.School.Address == "") {
-// 			return errors.New("data sekolah tidak lengkap untuk membuat sekolah baru", 400)
-// 		}
-// 		var schoolUUID uuid.UUID
-// 		if parsedDetails.SchoolUUID == "" || parsedDetails.SchoolUUID == "nil" {
-// 			schoolUUID, err = s.createSchoolForRegister(tx, parsedDetails.School)
-// 			if err != nil {
-// 				return fmt.Errorf("gagal membuat sekolah: %w", err)
-// 			}
-// 		} else {
-// 			schoolUUID = uuid.MustParse(parsedDetails.SchoolUUID)
-// 		}
-// 		schoolDetails := entity.SchoolAdminDetails{
-// 			SchoolUUID: schoolUUID,
-// 			Picture:    req.Picture,
-// 			FirstName:  req.FirstName,
-// 			LastName:   req.LastName,
-// 			Gender:     entity.Gender(req.Gender),
-// 			Phone:      req.Phone,
-// 			Address:    req.Address,
-// 		}
-// 		return s.registerRepository.SaveSchoolAdminRegisterDetails(tx, schoolDetails, userUUID, nil)
-
-// 	case entity.Parent:
-// 		details := entity.ParentDetails{
-// 			FirstName: req.FirstName,
-// 			LastName:  req.LastName,
-// 			Gender:    entity.Gender(req.Gender),
-// 			Phone:     req.Phone,
-// 			Address:   req.Address,
-// 		}
-// 		return s.registerRepository.SaveParentRegisterDetails(tx, details, userUUID, nil)
-
-// 	case entity.Driver:
-// 		parsedDetails, err := parseDetails[dto.DriverDetailsRequestsDTO](req.Details)
-// 		if err != nil {
-// 			return errors.New("invalid driver details format: "+err.Error(), 400)
-// 		}
-		
-// 		fmt.Printf("driver details: %+v\n", parsedDetails)
-// 		println("vehicleUUID: ", parsedDetails.VehicleUUID)
-// 		driverDetails := entity.DriverDetails{
-// 			SchoolUUID:    parseSafeUUID(parsedDetails.SchoolUUID),
-// 			VehicleUUID:   parseSafeUUID(parsedDetails.VehicleUUID),
-// 			Picture:       req.Picture,
-// 			FirstName:     req.FirstName,
-// 			LastName:      req.LastName,
-// 			Gender:        entity.Gender(req.Gender),
-// 			Phone:         req.Phone,
-// 			Address:       req.Address,
-// 			LicenseNumber: parsedDetails.LicenseNumber,
-// 		}
-// 		return s.registerRepository.SaveDriverRegisterDetails(tx, driverDetails, userUUID, nil)
-
-// 	default:
-// 		return errors.New("invalid role", 400)
-// 	}
-// }
-
-// func (s *RegisterService) ApproveUserRegister(userUUID uuid.UUID, username string, approverRole string) error {
-// 	var requiredApproverRole string
-
-// 	user, err := s.registerRepository.GetUserByUUID(userUUID)
-// 	if err != nil {
-// 		return fmt.Errorf("user tidak ditemukan: %w", err)
-// 	}
-
-// 	// Menentukan siapa yang berhak approve berdasarkan role yang didaftarkan
-// 	switch user.RoleCode {
-// 	case "P":
-// 		requiredApproverRole = "AS"
-// 	case "AS":
-// 		requiredApproverRole = "SA"
-// 	case "D":
-// 		requiredApproverRole = "SA"
-// 	default:
-// 		return fmt.Errorf("role tidak valid untuk approval")
-// 	}
-
-// 	// Validasi role approver
-// 	if approverRole != requiredApproverRole {
-// 		return fmt.Errorf("anda tidak memiliki izin untuk melakukan approval")
-// 	}
-	
-// 	err = s.registerRepository.ApproveUserRegister(username, userUUID)
-// 	if err != nil {
-// 		return fmt.Errorf("gagal memperbarui status user: %w", err)
-// 	}
-
-// 	return nil
-// }
-
-// func (service *RegisterService) createSchoolForRegister(tx *sqlx.Tx, req dto.SchoolRequestDTO) (uuid.UUID, error) {
-// 	// Convert Point map to JSON string (handling empty Point)
-// 	var point interface{}
-// 	if len(req.Point) > 0 {
-// 		// Marshal Point to JSON string
-// 		pointData, err := json.Marshal(req.Point)
-// 		if err != nil {
-// 			return uuid.Nil, fmt.Errorf("failed to marshal Point: %w", err)
-// 		}
-// 		point = string(pointData) // Store as JSON string
-// 	} else {
-// 		// If Point is empty, set it to NULL
-// 		point = nil
-// 	}
-
-// 	// Create School entity
-// 	school := entity.School{
-// 		ID:          time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6), // Custom ID
-// 		UUID:        uuid.New(),
-// 		Name:        req.Name,
-// 		Address:     req.Address,
-// 		Contact:     req.Contact,
-// 		Email:       req.Email,
-// 		Description: req.Description,
-// 		Point:       sql.NullString{String: fmt.Sprintf("%v", point), Valid: point != nil}, // Handle Point as NULL if not valid
-// 		CreatedAt:   sql.NullTime{Time: time.Now(), Valid: true},
-// 		UpdatedAt:   sql.NullTime{Time: time.Now(), Valid: true},
-// 	}
-
-// 	// Save School entity in the database and get the UUID
-// 	schoolUUID, err := service.registerRepository.SaveSchoolForRegister(school)
-// 	if err != nil {
-// 		return uuid.Nil, fmt.Errorf("failed to save school: %w", err)
-// 	}
-
-// 	return schoolUUID, nil
-// }
\ No newline at end of file
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"shuttle/errors"
+	"shuttle/models/dto"
+	"shuttle/models/entity"
+	"shuttle/repositories"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type RegisterServiceInterface interface {
+	AddUserRegister(req dto.RegisterRequestDTO) (uuid.UUID, error)
+	GetRegistrations(page, limit int, status, schoolUUID string) ([]dto.RegistrationResponseDTO, int, error)
+	ApproveUserRegister(userUUID, schoolUUID, username, reason string) (dto.RegistrationResponseDTO, error)
+	RejectUserRegister(userUUID, schoolUUID, username, reason string) (dto.RegistrationResponseDTO, error)
+}
+
+// Parents are reviewed by the admins of the school they registered for,
+// drivers and school admins by a super admin.
+type RegisterService struct {
+	registerRepository repositories.RegisterRepositoryInterface
+}
+
+func NewRegisterService(registerRepository repositories.RegisterRepositoryInterface) RegisterService {
+	return RegisterService{
+		registerRepository: registerRepository,
+	}
+}
+
+func (s *RegisterService) AddUserRegister(req dto.RegisterRequestDTO) (uuid.UUID, error) {
+	roleCode, err := registerRoleCode(req)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	exists, err := s.registerRepository.CheckSchoolExistForRegister(req.SchoolUUID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !exists {
+		return uuid.Nil, errors.New("school is not found", 404)
+	}
+
+	exists, err = s.registerRepository.CheckEmailExistForRegister(req.Email)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if exists {
+		return uuid.Nil, errors.New("email already exists", 409)
+	}
+
+	exists, err = s.registerRepository.CheckUsernameExistForRegister(req.Username)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if exists {
+		return uuid.Nil, errors.New("username already exists", 409)
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	req.Password = hashedPassword
+
+	tx, err := s.registerRepository.BeginTransaction()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	var transactionErr error
+	defer func() {
+		if transactionErr != nil {
+			tx.Rollback()
+		} else {
+			transactionErr = tx.Commit()
+		}
+	}()
+
+	schoolUUID := uuid.MustParse(req.SchoolUUID)
+	userEntity := entity.User{
+		ID:                 time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6),
+		UUID:               uuid.New(),
+		Username:           req.Username,
+		Email:              req.Email,
+		Password:           req.Password,
+		Role:               entity.Role(req.Role),
+		RoleCode:           roleCode,
+		RegisterStatus:     dto.RegisterStatusPending,
+		RegisterSchoolUUID: &schoolUUID,
+		CreatedBy:          sql.NullString{String: req.Username, Valid: true},
+	}
+
+	userUUID, err := s.registerRepository.SaveUserRegister(tx, userEntity)
+	if err != nil {
+		transactionErr = fmt.Errorf("error saving user: %w", err)
+		return uuid.Nil, transactionErr
+	}
+
+	if err := s.saveRoleRegisterDetails(tx, userUUID, req); err != nil {
+		transactionErr = fmt.Errorf("error saving role details: %w", err)
+		return uuid.Nil, transactionErr
+	}
+
+	return userUUID, nil
+}
+
+func (s *RegisterService) saveRoleRegisterDetails(tx *sqlx.Tx, userUUID uuid.UUID, req dto.RegisterRequestDTO) error {
+	switch entity.Role(req.Role) {
+	case entity.SchoolAdmin:
+		return s.registerRepository.SaveSchoolAdminRegisterDetails(tx, entity.SchoolAdminDetails{
+			UserUUID:   userUUID,
+			FirstName:  req.FirstName,
+			LastName:   req.LastName,
+			Gender:     entity.Gender(req.Gender),
+			Phone:      req.Phone,
+			Address:    req.Address,
+		})
+
+	case entity.Parent:
+		return s.registerRepository.SaveParentRegisterDetails(tx, entity.ParentDetails{
+			UserUUID:  userUUID,
+			FirstName: req.FirstName,
+			LastName:  req.LastName,
+			Gender:    entity.Gender(req.Gender),
+			Phone:     req.Phone,
+			Address:   req.Address,
+		})
+
+	case entity.Driver:
+		return s.registerRepository.SaveDriverRegisterDetails(tx, entity.DriverDetails{
+			UserUUID:      userUUID,
+			FirstName:     req.FirstName,
+			LastName:      req.LastName,
+			Gender:        entity.Gender(req.Gender),
+			Phone:         req.Phone,
+			Address:       req.Address,
+			LicenseNumber: req.LicenseNumber,
+		})
+
+	default:
+		return errors.New("invalid role", 400)
+	}
+}
+
+func (s *RegisterService) GetRegistrations(page, limit int, status, schoolUUID string) ([]dto.RegistrationResponseDTO, int, error) {
+	offset := (page - 1) * limit
+
+	filter := registrationScope(schoolUUID)
+	filter.Status = status
+
+	registrations, err := s.registerRepository.FetchRegistrations(filter, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.registerRepository.CountRegistrations(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var registrationsDTO []dto.RegistrationResponseDTO
+	for _, registration := range registrations {
+		registrationsDTO = append(registrationsDTO, toRegistrationResponse(registration))
+	}
+
+	return registrationsDTO, total, nil
+}
+
+func (s *RegisterService) ApproveUserRegister(userUUID, schoolUUID, username, reason string) (dto.RegistrationResponseDTO, error) {
+	return s.reviewUserRegister(userUUID, schoolUUID, username, dto.RegisterStatusApproved, reason)
+}
+
+func (s *RegisterService) RejectUserRegister(userUUID, schoolUUID, username, reason string) (dto.RegistrationResponseDTO, error) {
+	if strings.TrimSpace(reason) == "" {
+		return dto.RegistrationResponseDTO{}, errors.New("a reason is required to reject a registration", 400)
+	}
+
+	return s.reviewUserRegister(userUUID, schoolUUID, username, dto.RegisterStatusRejected, reason)
+}
+
+func (s *RegisterService) reviewUserRegister(userUUID, schoolUUID, username, status, reason string) (dto.RegistrationResponseDTO, error) {
+	registration, err := s.registerRepository.FetchRegistration(userUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return dto.RegistrationResponseDTO{}, errors.New("registration not found", 404)
+		}
+		return dto.RegistrationResponseDTO{}, err
+	}
+
+	// A registration outside the reviewer's scope is reported as missing
+	if !registrationInScope(registrationScope(schoolUUID), registration) {
+		return dto.RegistrationResponseDTO{}, errors.New("registration not found", 404)
+	}
+
+	if registration.RegisterStatus != dto.RegisterStatusPending {
+		return dto.RegistrationResponseDTO{}, errors.New("registration has already been reviewed", 409)
+	}
+
+	reviewed, err := s.registerRepository.ReviewUserRegister(registration.UUID, status, username, strings.TrimSpace(reason))
+	if err != nil {
+		return dto.RegistrationResponseDTO{}, err
+	}
+	if !reviewed {
+		return dto.RegistrationResponseDTO{}, errors.New("registration has already been reviewed", 409)
+	}
+
+	registration.RegisterStatus = status
+	registration.ReviewedBy = toNullString(username)
+	registration.ReviewedAt = toNullTime(time.Now())
+	registration.ReviewReason = toNullString(strings.TrimSpace(reason))
+
+	return toRegistrationResponse(registration), nil
+}
+
+func registerRoleCode(req dto.RegisterRequestDTO) (string, error) {
+	switch req.Role {
+	case dto.SchoolAdmin:
+		return "AS", nil
+	case dto.Parent:
+		return "P", nil
+	case dto.Driver:
+		if strings.TrimSpace(req.LicenseNumber) == "" {
+			return "", errors.New("license number is required for driver", 400)
+		}
+		return "D", nil
+	default:
+		return "", errors.New("role is not available for registration", 400)
+	}
+}
+
+func registrationScope(schoolUUID string) entity.RegistrationFilter {
+	if schoolUUID != "" {
+		return entity.RegistrationFilter{RoleCodes: []string{"P"}, SchoolUUID: schoolUUID}
+	}
+	return entity.RegistrationFilter{RoleCodes: []string{"AS", "D"}}
+}
+
+func registrationInScope(filter entity.RegistrationFilter, registration entity.Registration) bool {
+	if filter.SchoolUUID != "" && (registration.SchoolUUID == nil || registration.SchoolUUID.String() != filter.SchoolUUID) {
+		return false
+	}
+	for _, roleCode := range filter.RoleCodes {
+		if roleCode == registration.RoleCode {
+			return true
+		}
+	}
+	return false
+}
+
+func toRegistrationResponse(registration entity.Registration) dto.RegistrationResponseDTO {
+	schoolUUID := "N/A"
+	if registration.SchoolUUID != nil {
+		schoolUUID = registration.SchoolUUID.String()
+	}
+
+	return dto.RegistrationResponseDTO{
+		UUID:           registration.UUID.String(),
+		Username:       registration.Username,
+		Email:          registration.Email,
+		Role:           dto.Role(registration.Role),
+		FirstName:      safeStringFormat(registration.FirstName),
+		LastName:       safeStringFormat(registration.LastName),
+		Phone:          safeStringFormat(registration.Phone),
+		SchoolUUID:     schoolUUID,
+		SchoolName:     safeStringFormat(registration.SchoolName),
+		RegisterStatus: registration.RegisterStatus,
+		ReviewedBy:     safeStringFormat(registration.ReviewedBy),
+		ReviewedAt:     safeTimeFormat(registration.ReviewedAt),
+		ReviewReason:   safeStringFormat(registration.ReviewReason),
+		CreatedAt:      safeTimeFormat(registration.CreatedAt),
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"github.com/umahmood/haversine"
+)
+
+// Orders the pickups of a route so the bus drives as little as possible: a
+// nearest neighbour tour is built first then improved with 2-opt until no
+// reversed segment makes it shorter. Both ends are fixed, the tour leaves
+// from the driver's depot and arrives at the school. Without a depot the
+// first pickup is free and every student is tried as the first one.
+type pickupOptimizer struct {
+	// Kilometers between pickups, and from the depot and to the school
+	distances  [][]float64
+	fromDepot  []float64
+	toSchool   []float64
+	withDepot  bool
+	pointCount int
+}
+
+type geoPoint struct {
+	latitude  float64
+	longitude float64
+}
+
+// 2-opt passes are quadratic, a route never has anywhere near that many
+const maxOptimizerPasses = 100
+
+func newPickupOptimizer(depot *geoPoint, pickups []geoPoint, school geoPoint) *pickupOptimizer {
+	optimizer := &pickupOptimizer{
+		distances:  make([][]float64, len(pickups)),
+		fromDepot:  make([]float64, len(pickups)),
+		toSchool:   make([]float64, len(pickups)),
+		withDepot:  depot != nil,
+		pointCount: len(pickups),
+	}
+
+	for i, from := range pickups {
+		optimizer.distances[i] = make([]float64, len(pickups))
+		for j, to := range pickups {
+			optimizer.distances[i][j] = kilometersBetween(from, to)
+		}
+		if depot != nil {
+			optimizer.fromDepot[i] = kilometersBetween(*depot, from)
+		}
+		optimizer.toSchool[i] = kilometersBetween(from, school)
+	}
+
+	return optimizer
+}
+
+func kilometersBetween(from, to geoPoint) float64 {
+	_, km := haversine.Distance(
+		haversine.Coord{Lat: from.latitude, Lon: from.longitude},
+		haversine.Coord{Lat: to.latitude, Lon: to.longitude},
+	)
+	return km
+}
+
+// Length of the tour visiting the pickups in the given order
+func (optimizer *pickupOptimizer) length(order []int) float64 {
+	if len(order) == 0 {
+		return 0
+	}
+
+	total := optimizer.toSchool[order[len(order)-1]]
+	if optimizer.withDepot {
+		total += optimizer.fromDepot[order[0]]
+	}
+	for i := 1; i < len(order); i++ {
+		total += optimizer.distances[order[i-1]][order[i]]
+	}
+	return total
+}
+
+func (optimizer *pickupOptimizer) optimize() []int {
+	if optimizer.pointCount == 0 {
+		return nil
+	}
+
+	if optimizer.withDepot {
+		return optimizer.twoOpt(optimizer.nearestNeighbour(-1))
+	}
+
+	var best []int
+	bestLength := 0.0
+	for first := 0; first < optimizer.pointCount; first++ {
+		order := optimizer.twoOpt(optimizer.nearestNeighbour(first))
+		if length := optimizer.length(order); best == nil || length < bestLength {
+			best, bestLength = order, length
+		}
+	}
+	return best
+}
+
+// Starts from the given pickup, or from the depot when first is -1, and keeps
+// going to the closest pickup not visited yet
+func (optimizer *pickupOptimizer) nearestNeighbour(first int) []int {
+	visited := make([]bool, optimizer.pointCount)
+	order := make([]int, 0, optimizer.pointCount)
+
+	current := first
+	if first >= 0 {
+		visited[first] = true
+		order = append(order, first)
+	}
+
+	for len(order) < optimizer.pointCount {
+		next := -1
+		nextDistance := 0.0
+		for candidate := 0; candidate < optimizer.pointCount; candidate++ {
+			if visited[candidate] {
+				continue
+			}
+
+			distance := optimizer.fromDepot[candidate]
+			if current >= 0 {
+				distance = optimizer.distances[current][candidate]
+			}
+			if next < 0 || distance < nextDistance {
+				next, nextDistance = candidate, distance
+			}
+		}
+
+		visited[next] = true
+		order = append(order, next)
+		current = next
+	}
+
+	return order
+}
+
+// Reverses order[i..j] whenever that shortens the tour, until a pass finds
+// nothing to improve
+func (optimizer *pickupOptimizer) twoOpt(order []int) []int {
+	best := optimizer.length(order)
+
+	for pass := 0; pass < maxOptimizerPasses; pass++ {
+		improved := false
+		for i := 0; i < len(order)-1; i++ {
+			for j := i + 1; j < len(order); j++ {
+				reverseSegment(order, i, j)
+				// Rounding noise must not count as an improvement
+				if length := optimizer.length(order); length < best-1e-9 {
+					best = length
+					improved = true
+				} else {
+					reverseSegment(order, i, j)
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+
+	return order
+}
+
+func reverseSegment(order []int, i, j int) {
+	for ; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+}
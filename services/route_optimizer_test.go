@@ -0,0 +1,106 @@
+package services
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Pickups scattered around a school in Jakarta, the same for every run
+func randomPickups(seed int64, count int) []geoPoint {
+	random := rand.New(rand.NewSource(seed))
+	pickups := make([]geoPoint, count)
+	for i := range pickups {
+		pickups[i] = geoPoint{latitude: -6.2 + random.Float64()*0.1 - 0.05, longitude: 106.8 + random.Float64()*0.1 - 0.05}
+	}
+	return pickups
+}
+
+func TestPickupOptimizerNeverLongerThanNearestNeighbour(t *testing.T) {
+	school := geoPoint{latitude: -6.2, longitude: 106.8}
+	depot := geoPoint{latitude: -6.26, longitude: 106.74}
+
+	tests := []struct {
+		name    string
+		depot   *geoPoint
+		pickups []geoPoint
+	}{
+		{"one pickup with depot", &depot, randomPickups(1, 1)},
+		{"one pickup without depot", nil, randomPickups(1, 1)},
+		{"small route with depot", &depot, randomPickups(2, 5)},
+		{"small route without depot", nil, randomPickups(2, 5)},
+		{"full bus with depot", &depot, randomPickups(3, 25)},
+		{"full bus without depot", nil, randomPickups(3, 25)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			optimizer := newPickupOptimizer(test.depot, test.pickups, school)
+
+			var nearestNeighbourLength float64
+			if test.depot != nil {
+				nearestNeighbourLength = optimizer.length(optimizer.nearestNeighbour(-1))
+			} else {
+				for first := range test.pickups {
+					if length := optimizer.length(optimizer.nearestNeighbour(first)); first == 0 || length < nearestNeighbourLength {
+						nearestNeighbourLength = length
+					}
+				}
+			}
+
+			order := optimizer.optimize()
+			if length := optimizer.length(order); length > nearestNeighbourLength+1e-9 {
+				t.Fatalf("optimized tour is %v km, nearest neighbour is %v km", length, nearestNeighbourLength)
+			}
+
+			visited := append([]int(nil), order...)
+			sort.Ints(visited)
+			if len(visited) != len(test.pickups) {
+				t.Fatalf("expected %d pickups in the tour, got %v", len(test.pickups), order)
+			}
+			for i, pickup := range visited {
+				if pickup != i {
+					t.Fatalf("expected every pickup once, got %v", order)
+				}
+			}
+		})
+	}
+}
+
+func TestPickupOptimizerUntanglesAStraightRoad(t *testing.T) {
+	// Pickups on a road running east to the school, listed out of order
+	school := geoPoint{latitude: -6.2, longitude: 106.9}
+	pickups := []geoPoint{
+		{latitude: -6.2, longitude: 106.84},
+		{latitude: -6.2, longitude: 106.81},
+		{latitude: -6.2, longitude: 106.87},
+		{latitude: -6.2, longitude: 106.82},
+	}
+	want := []int{1, 3, 0, 2}
+
+	tests := []struct {
+		name  string
+		depot *geoPoint
+	}{
+		{"with depot", &geoPoint{latitude: -6.2, longitude: 106.8}},
+		{"without depot", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order := newPickupOptimizer(test.depot, pickups, school).optimize()
+			for i := range want {
+				if order[i] != want[i] {
+					t.Fatalf("expected %v, got %v", want, order)
+				}
+			}
+		})
+	}
+}
+
+func TestPickupOptimizerWithoutPickups(t *testing.T) {
+	optimizer := newPickupOptimizer(nil, nil, geoPoint{latitude: -6.2, longitude: 106.8})
+	if order := optimizer.optimize(); order != nil {
+		t.Fatalf("expected no tour, got %v", order)
+	}
+}
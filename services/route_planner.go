@@ -0,0 +1,189 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Splits a school's unassigned students over the vehicles still free. The
+// students are swept by their bearing from the school, starting after the
+// widest empty sector so a neighbourhood isn't split over two routes, and
+// the next one boards the current vehicle as long as a seat is left and
+// nobody on board rides longer than maxRide. The biggest vehicles are filled
+// first, every route is ordered with the pickup optimizer.
+type routePlanner struct {
+	school  geoPoint
+	maxRide time.Duration
+}
+
+type plannerVehicle struct {
+	depot    *geoPoint
+	capacity int
+}
+
+// Pickups are indexes of the students in driving order, distance is in km
+type plannedRoute struct {
+	vehicle     int
+	pickups     []int
+	distance    float64
+	longestRide time.Duration
+}
+
+// Drive time estimates use the settings of the ETAs
+func plannerSpeed() float64 {
+	if speed := viper.GetFloat64("ETA_DEFAULT_SPEED"); speed > 0 {
+		return speed
+	}
+	return 25 // km/h
+}
+
+func plannerDetourFactor() float64 {
+	if factor := viper.GetFloat64("ETA_DETOUR_FACTOR"); factor >= 1 {
+		return factor
+	}
+	return 1.3
+}
+
+func plannerStopDwell() time.Duration {
+	if dwell := viper.GetDuration("ETA_STOP_DWELL"); dwell > 0 {
+		return dwell
+	}
+	return time.Minute
+}
+
+func routePlanMaxRide() time.Duration {
+	if maxRide := viper.GetDuration("ROUTE_PLAN_MAX_RIDE"); maxRide > 0 {
+		return maxRide
+	}
+	return time.Hour
+}
+
+// Returns the routes, the students whose ride would be longer than maxRide
+// and the ones left when every vehicle was full. A student a vehicle with free
+// seats turned down for the ride time, and no later vehicle took, counts as a
+// ride too long.
+func (planner *routePlanner) plan(students []geoPoint, vehicles []plannerVehicle) ([]plannedRoute, []int, []int) {
+	var routes []plannedRoute
+	var tooLong, remaining []int
+
+	for i, student := range students {
+		if planner.rideTime(kilometersBetween(student, planner.school)) > planner.maxRide {
+			tooLong = append(tooLong, i)
+			continue
+		}
+		remaining = append(remaining, i)
+	}
+	remaining = planner.sweepOrder(students, remaining)
+
+	bySize := make([]int, len(vehicles))
+	for i := range bySize {
+		bySize[i] = i
+	}
+	sort.SliceStable(bySize, func(a, b int) bool {
+		return vehicles[bySize[a]].capacity > vehicles[bySize[b]].capacity
+	})
+
+	turnedDown := make(map[int]bool)
+	for _, v := range bySize {
+		if len(remaining) == 0 {
+			break
+		}
+		vehicle := vehicles[v]
+		if vehicle.capacity <= 0 {
+			continue
+		}
+
+		var route plannedRoute
+		boarded := 0
+		for boarded < len(remaining) && boarded < vehicle.capacity {
+			trial := planner.route(students, remaining[:boarded+1], vehicle.depot)
+			if trial.longestRide > planner.maxRide {
+				turnedDown[remaining[boarded]] = true
+				break
+			}
+			route = trial
+			boarded++
+		}
+
+		if boarded == 0 {
+			continue
+		}
+		route.vehicle = v
+		routes = append(routes, route)
+		remaining = remaining[boarded:]
+	}
+
+	var noSeats []int
+	for _, student := range remaining {
+		if turnedDown[student] {
+			tooLong = append(tooLong, student)
+			continue
+		}
+		noSeats = append(noSeats, student)
+	}
+
+	return routes, tooLong, noSeats
+}
+
+// Orders the students by bearing from the school, starting with the one
+// after the widest gap
+func (planner *routePlanner) sweepOrder(students []geoPoint, indexes []int) []int {
+	if len(indexes) < 2 {
+		return indexes
+	}
+
+	bearings := make(map[int]float64, len(indexes))
+	for _, i := range indexes {
+		bearings[i] = math.Atan2(students[i].latitude-planner.school.latitude, students[i].longitude-planner.school.longitude)
+	}
+	sorted := append([]int(nil), indexes...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return bearings[sorted[a]] < bearings[sorted[b]]
+	})
+
+	start := 0
+	widestGap := bearings[sorted[0]] + 2*math.Pi - bearings[sorted[len(sorted)-1]]
+	for i := 1; i < len(sorted); i++ {
+		if gap := bearings[sorted[i]] - bearings[sorted[i-1]]; gap > widestGap {
+			start, widestGap = i, gap
+		}
+	}
+
+	return append(sorted[start:], sorted[:start]...)
+}
+
+func (planner *routePlanner) route(students []geoPoint, boarded []int, depot *geoPoint) plannedRoute {
+	pickups := make([]geoPoint, len(boarded))
+	for i, student := range boarded {
+		pickups[i] = students[student]
+	}
+
+	optimizer := newPickupOptimizer(depot, pickups, planner.school)
+	order := optimizer.optimize()
+
+	route := plannedRoute{pickups: make([]int, len(order)), distance: optimizer.length(order)}
+	for i, pickup := range order {
+		route.pickups[i] = boarded[pickup]
+	}
+
+	// The first student picked up rides the whole way, stopping at every
+	// pickup after theirs
+	ride := time.Duration(0)
+	for i := len(order) - 1; i >= 0; i-- {
+		if i == len(order)-1 {
+			ride += planner.rideTime(optimizer.toSchool[order[i]])
+		} else {
+			ride += planner.rideTime(optimizer.distances[order[i]][order[i+1]]) + plannerStopDwell()
+		}
+	}
+	route.longestRide = ride
+
+	return route
+}
+
+func (planner *routePlanner) rideTime(kilometers float64) time.Duration {
+	return time.Duration(kilometers * plannerDetourFactor() / plannerSpeed() * float64(time.Hour))
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoutePlannerStaysWithinCapacityAndMaxRide(t *testing.T) {
+	school := geoPoint{latitude: -6.2, longitude: 106.8}
+	depot := geoPoint{latitude: -6.26, longitude: 106.74}
+	farAway := geoPoint{latitude: -6.9, longitude: 107.6}
+
+	tests := []struct {
+		name     string
+		maxRide  time.Duration
+		students []geoPoint
+		vehicles []plannerVehicle
+	}{
+		{"everyone fits", time.Hour, randomPickups(4, 10), []plannerVehicle{{depot: &depot, capacity: 12}}},
+		{"split over vehicles", time.Hour, randomPickups(5, 30), []plannerVehicle{{depot: &depot, capacity: 8}, {capacity: 14}, {depot: &depot, capacity: 10}}},
+		{"not enough seats", time.Hour, randomPickups(6, 20), []plannerVehicle{{capacity: 6}, {depot: &depot, capacity: 4}}},
+		{"short max ride", 15 * time.Minute, randomPickups(7, 25), []plannerVehicle{{capacity: 20}, {capacity: 20}}},
+		{"student too far", time.Hour, append(randomPickups(8, 5), farAway), []plannerVehicle{{capacity: 10}}},
+		{"vehicle without seats", time.Hour, randomPickups(9, 5), []plannerVehicle{{capacity: 0}, {capacity: 5}}},
+		{"no vehicles", time.Hour, randomPickups(10, 5), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			planner := &routePlanner{school: school, maxRide: test.maxRide}
+			routes, tooLong, noSeats := planner.plan(test.students, test.vehicles)
+
+			seen := make(map[int]int)
+			usedVehicles := make(map[int]bool)
+			for _, route := range routes {
+				if usedVehicles[route.vehicle] {
+					t.Fatalf("vehicle %d got two routes", route.vehicle)
+				}
+				usedVehicles[route.vehicle] = true
+
+				if capacity := test.vehicles[route.vehicle].capacity; len(route.pickups) > capacity {
+					t.Fatalf("vehicle %d has %d seats but %d students", route.vehicle, capacity, len(route.pickups))
+				}
+				if route.longestRide > test.maxRide {
+					t.Fatalf("vehicle %d has a ride of %v, the maximum is %v", route.vehicle, route.longestRide, test.maxRide)
+				}
+				for _, student := range route.pickups {
+					seen[student]++
+				}
+			}
+			for _, student := range append(append([]int(nil), tooLong...), noSeats...) {
+				seen[student]++
+			}
+
+			for student := range test.students {
+				if seen[student] != 1 {
+					t.Fatalf("student %d is in %d places, expected exactly one", student, seen[student])
+				}
+			}
+		})
+	}
+}
+
+func TestRoutePlannerReportsRideTooLong(t *testing.T) {
+	school := geoPoint{latitude: -6.2, longitude: 106.8}
+	students := []geoPoint{
+		{latitude: -6.21, longitude: 106.8},
+		{latitude: -6.9, longitude: 107.6},
+	}
+
+	planner := &routePlanner{school: school, maxRide: time.Hour}
+	_, tooLong, noSeats := planner.plan(students, []plannerVehicle{{capacity: 5}})
+
+	if len(tooLong) != 1 || tooLong[0] != 1 {
+		t.Fatalf("expected student 1 to ride too long, got %v", tooLong)
+	}
+	if len(noSeats) != 0 {
+		t.Fatalf("expected every other student seated, got %v left over", noSeats)
+	}
+}
@@ -2,8 +2,11 @@ package services
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"shuttle/errors"
 	"shuttle/models/dto"
 	"shuttle/models/entity"
 	"shuttle/repositories"
@@ -28,15 +31,23 @@ type RouteServiceInterface interface {
 	DeleteRoute(routenameUUID, schoolUUID, username string) error
 
 	GetTotalDistance(driverStart [2]float64, students [][2]float64, school [2]float64) float64
+	GetDriverDistance(driverUUID string) (dto.DriverDistanceResponseDTO, error)
+	ProposeRouteOrder(routeNameUUID, schoolUUID string, startPoint map[string]float64) (dto.RouteOptimizationDTO, error)
+	ApplyRouteOrder(routeNameUUID, schoolUUID string, studentUUIDs []string, username string) error
+	PlanSchoolRoutes(schoolUUID string, maxRideMinutes int) (dto.RoutePlanDTO, error)
 }
 
 type routeService struct {
-	routeRepository repositories.RouteRepositoryInterface
+	routeRepository    repositories.RouteRepositoryInterface
+	locationRepository repositories.LocationRepositoryInterface
+	studentRepository  repositories.StudentRepositoryInterface
 }
 
-func NewRouteService(routeRepository repositories.RouteRepositoryInterface) RouteServiceInterface {
+func NewRouteService(routeRepository repositories.RouteRepositoryInterface, locationRepository repositories.LocationRepositoryInterface, studentRepository repositories.StudentRepositoryInterface) RouteServiceInterface {
 	return &routeService{
-		routeRepository: routeRepository,
+		routeRepository:    routeRepository,
+		locationRepository: locationRepository,
+		studentRepository:  studentRepository,
 	}
 }
 
@@ -44,6 +55,370 @@ func (s *routeService) GetTotalDistance(driverStart [2]float64, students [][2]fl
 	return s.routeRepository.CalculateTotalDistance(driverStart, students, school)
 }
 
+// Distances of the driver's route in both directions, starting where the
+// driver was last seen today. In the morning the students are picked up in
+// student_order and brought to school, in the afternoon they are dropped off
+// from school in the reverse order. Students without a pickup point are
+// left out and listed as skipped.
+func (s *routeService) GetDriverDistance(driverUUID string) (dto.DriverDistanceResponseDTO, error) {
+	parsedDriverUUID, err := uuid.Parse(driverUUID)
+	if err != nil {
+		return dto.DriverDistanceResponseDTO{}, errors.New("invalid driver UUID", 400)
+	}
+
+	stops, err := s.routeRepository.FetchDriverRouteStops(driverUUID)
+	if err != nil {
+		return dto.DriverDistanceResponseDTO{}, err
+	}
+	if len(stops) == 0 {
+		return dto.DriverDistanceResponseDTO{}, errors.New("no students are assigned to this driver", 404)
+	}
+	if !stops[0].SchoolLatitude.Valid || !stops[0].SchoolLongitude.Valid {
+		return dto.DriverDistanceResponseDTO{}, errors.New("the school location hasn't been set", 404)
+	}
+
+	school := dto.RoutePointDTO{
+		Type:      "school",
+		UUID:      stops[0].SchoolUUID.String(),
+		Name:      stops[0].SchoolName,
+		Latitude:  stops[0].SchoolLatitude.Float64,
+		Longitude: stops[0].SchoolLongitude.Float64,
+	}
+
+	response := dto.DriverDistanceResponseDTO{SkippedStudents: []dto.RoutePointDTO{}}
+	var students []dto.RoutePointDTO
+	for _, stop := range stops {
+		student := dto.RoutePointDTO{
+			Type:      "student",
+			UUID:      stop.StudentUUID.String(),
+			Name:      strings.TrimSpace(stop.StudentFirstName + " " + stop.StudentLastName),
+			Latitude:  stop.PickupLatitude.Float64,
+			Longitude: stop.PickupLongitude.Float64,
+		}
+		if !stop.PickupLatitude.Valid || !stop.PickupLongitude.Valid {
+			response.SkippedStudents = append(response.SkippedStudents, student)
+			continue
+		}
+		students = append(students, student)
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	location, err := s.locationRepository.FetchLastDriverLocation(parsedDriverUUID, today)
+	if err != nil && err != sql.ErrNoRows {
+		return dto.DriverDistanceResponseDTO{}, err
+	}
+	if err == nil {
+		response.Start = &dto.RoutePointDTO{
+			Type:      "driver",
+			UUID:      driverUUID,
+			Name:      "Last known position",
+			Latitude:  location.Latitude,
+			Longitude: location.Longitude,
+		}
+	}
+
+	var morning, afternoon []dto.RoutePointDTO
+	if response.Start != nil {
+		morning = append(morning, *response.Start)
+		afternoon = append(afternoon, *response.Start)
+	}
+	morning = append(append(morning, students...), school)
+	afternoon = append(afternoon, school)
+	for i := len(students) - 1; i >= 0; i-- {
+		afternoon = append(afternoon, students[i])
+	}
+
+	response.Morning = s.routeDirection(morning)
+	response.Afternoon = s.routeDirection(afternoon)
+	return response, nil
+}
+
+// One leg between every two consecutive points, rounded to two decimals
+func (s *routeService) routeDirection(points []dto.RoutePointDTO) dto.RouteDirectionDTO {
+	direction := dto.RouteDirectionDTO{Legs: []dto.RouteLegDTO{}}
+	total := 0.0
+	for i := 1; i < len(points); i++ {
+		from, to := points[i-1], points[i]
+		distance := s.routeRepository.CalculateTotalDistance([2]float64{from.Latitude, from.Longitude}, nil, [2]float64{to.Latitude, to.Longitude})
+		total += distance
+		direction.Legs = append(direction.Legs, dto.RouteLegDTO{From: from, To: to, Distance: math.Round(distance*100) / 100})
+	}
+	direction.TotalDistance = math.Round(total*100) / 100
+	return direction
+}
+
+
+// Proposes the pickup order of the route's students, nothing is saved until
+// the proposal is applied with ApplyRouteOrder
+func (s *routeService) ProposeRouteOrder(routeNameUUID, schoolUUID string, startPoint map[string]float64) (dto.RouteOptimizationDTO, error) {
+	stops, err := s.routeRepository.FetchRouteStops(routeNameUUID, schoolUUID)
+	if err != nil {
+		return dto.RouteOptimizationDTO{}, err
+	}
+	if len(stops) == 0 {
+		return dto.RouteOptimizationDTO{}, errors.New("the route has no students", 404)
+	}
+	if !stops[0].SchoolLatitude.Valid || !stops[0].SchoolLongitude.Valid {
+		return dto.RouteOptimizationDTO{}, errors.New("the school location hasn't been set", 404)
+	}
+
+	proposal := dto.RouteOptimizationDTO{
+		RouteNameUUID: routeNameUUID,
+		School: dto.RoutePointDTO{
+			Type:      "school",
+			UUID:      stops[0].SchoolUUID.String(),
+			Name:      stops[0].SchoolName,
+			Latitude:  stops[0].SchoolLatitude.Float64,
+			Longitude: stops[0].SchoolLongitude.Float64,
+		},
+		SkippedStudents: []dto.RoutePointDTO{},
+	}
+
+	if startPoint != nil {
+		latitude, hasLatitude := startPoint["latitude"]
+		longitude, hasLongitude := startPoint["longitude"]
+		if !hasLatitude || !hasLongitude || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			return dto.RouteOptimizationDTO{}, errors.New("start point must contain a valid latitude and longitude", 400)
+		}
+		proposal.Start = &dto.RoutePointDTO{Type: "start", Name: "Start point", Latitude: latitude, Longitude: longitude}
+	} else if stops[0].DepotLatitude.Valid && stops[0].DepotLongitude.Valid {
+		proposal.Start = &dto.RoutePointDTO{
+			Type:      "depot",
+			UUID:      stops[0].DriverUUID.String,
+			Name:      "Driver depot",
+			Latitude:  stops[0].DepotLatitude.Float64,
+			Longitude: stops[0].DepotLongitude.Float64,
+		}
+	}
+
+	var pickups []geoPoint
+	for _, stop := range stops {
+		student := dto.RoutePointDTO{
+			Type:      "student",
+			UUID:      stop.StudentUUID.String(),
+			Name:      strings.TrimSpace(stop.StudentFirstName + " " + stop.StudentLastName),
+			Latitude:  stop.PickupLatitude.Float64,
+			Longitude: stop.PickupLongitude.Float64,
+		}
+		if !stop.PickupLatitude.Valid || !stop.PickupLongitude.Valid {
+			proposal.SkippedStudents = append(proposal.SkippedStudents, student)
+			continue
+		}
+		proposal.CurrentOrder = append(proposal.CurrentOrder, student)
+		pickups = append(pickups, geoPoint{latitude: student.Latitude, longitude: student.Longitude})
+	}
+
+	var depot *geoPoint
+	if proposal.Start != nil {
+		depot = &geoPoint{latitude: proposal.Start.Latitude, longitude: proposal.Start.Longitude}
+	}
+	optimizer := newPickupOptimizer(depot, pickups, geoPoint{latitude: proposal.School.Latitude, longitude: proposal.School.Longitude})
+
+	currentOrder := make([]int, len(pickups))
+	for i := range currentOrder {
+		currentOrder[i] = i
+	}
+	proposedOrder := optimizer.optimize()
+
+	for _, i := range proposedOrder {
+		proposal.ProposedOrder = append(proposal.ProposedOrder, proposal.CurrentOrder[i])
+	}
+	proposal.ProposedOrder = append(proposal.ProposedOrder, proposal.SkippedStudents...)
+	proposal.CurrentOrder = append(proposal.CurrentOrder, proposal.SkippedStudents...)
+
+	currentDistance := optimizer.length(currentOrder)
+	proposedDistance := optimizer.length(proposedOrder)
+	proposal.CurrentDistance = math.Round(currentDistance*100) / 100
+	proposal.ProposedDistance = math.Round(proposedDistance*100) / 100
+	proposal.SavedDistance = math.Round((currentDistance-proposedDistance)*100) / 100
+
+	return proposal, nil
+}
+
+// Saves a confirmed order, it must list every student of the route once
+func (s *routeService) ApplyRouteOrder(routeNameUUID, schoolUUID string, studentUUIDs []string, username string) error {
+	stops, err := s.routeRepository.FetchRouteStops(routeNameUUID, schoolUUID)
+	if err != nil {
+		return err
+	}
+	if len(stops) == 0 {
+		return errors.New("the route has no students", 404)
+	}
+
+	onRoute := make(map[string]bool, len(stops))
+	for _, stop := range stops {
+		onRoute[stop.StudentUUID.String()] = true
+	}
+
+	listed := make(map[string]bool, len(studentUUIDs))
+	for _, studentUUID := range studentUUIDs {
+		if listed[studentUUID] {
+			return errors.New("student "+studentUUID+" is listed more than once", 400)
+		}
+		listed[studentUUID] = true
+	}
+
+	if len(listed) != len(onRoute) {
+		return errors.New("the order must list every student of the route, request a new proposal", 409)
+	}
+	for studentUUID := range listed {
+		if !onRoute[studentUUID] {
+			return errors.New("the order must list every student of the route, request a new proposal", 409)
+		}
+	}
+
+	return s.routeRepository.ApplyRouteOrder(routeNameUUID, schoolUUID, studentUUIDs, username)
+}
+
+// Drafts routes for the students of the school that have none, over the
+// drivers that have a vehicle but no route, see routePlanner. Nothing is
+// saved, each draft is created through AddRoute once the admin agrees.
+func (s *routeService) PlanSchoolRoutes(schoolUUID string, maxRideMinutes int) (dto.RoutePlanDTO, error) {
+	if maxRideMinutes < 0 || maxRideMinutes > 240 {
+		return dto.RoutePlanDTO{}, errors.New("max ride minutes must be between 1 and 240, or 0 for the default", 400)
+	}
+	maxRide := routePlanMaxRide()
+	if maxRideMinutes > 0 {
+		maxRide = time.Duration(maxRideMinutes) * time.Minute
+	}
+
+	school, err := s.routeRepository.FetchSchoolLocation(schoolUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return dto.RoutePlanDTO{}, errors.New("school not found", 404)
+		}
+		return dto.RoutePlanDTO{}, err
+	}
+	if !school.SchoolLatitude.Valid || !school.SchoolLongitude.Valid {
+		return dto.RoutePlanDTO{}, errors.New("the school location hasn't been set", 404)
+	}
+
+	plan := dto.RoutePlanDTO{
+		School: dto.RoutePointDTO{
+			Type:      "school",
+			UUID:      school.SchoolUUID.String(),
+			Name:      school.SchoolName,
+			Latitude:  school.SchoolLatitude.Float64,
+			Longitude: school.SchoolLongitude.Float64,
+		},
+		MaxRideMinutes:     int(maxRide.Minutes()),
+		Routes:             []dto.PlannedRouteDTO{},
+		UnassignedStudents: []dto.UnassignedStudentDTO{},
+	}
+
+	students, err := s.studentRepository.FetchAvailableStudent(schoolUUID)
+	if err != nil {
+		return dto.RoutePlanDTO{}, err
+	}
+
+	var points []dto.RoutePointDTO
+	var pickups []geoPoint
+	for _, student := range students {
+		point := dto.RoutePointDTO{
+			Type: "student",
+			UUID: student.UUID.String(),
+			Name: strings.TrimSpace(student.FirstName + " " + student.LastName),
+		}
+
+		var pickupPoint map[string]float64
+		if !student.StudentPickupPoint.Valid || json.Unmarshal([]byte(student.StudentPickupPoint.String), &pickupPoint) != nil {
+			plan.UnassignedStudents = append(plan.UnassignedStudents, dto.UnassignedStudentDTO{Student: point, Reason: "no_pickup_point"})
+			continue
+		}
+		latitude, hasLatitude := pickupPoint["latitude"]
+		longitude, hasLongitude := pickupPoint["longitude"]
+		if !hasLatitude || !hasLongitude {
+			plan.UnassignedStudents = append(plan.UnassignedStudents, dto.UnassignedStudentDTO{Student: point, Reason: "no_pickup_point"})
+			continue
+		}
+
+		point.Latitude, point.Longitude = latitude, longitude
+		points = append(points, point)
+		pickups = append(pickups, geoPoint{latitude: latitude, longitude: longitude})
+	}
+
+	drivers, err := s.routeRepository.FetchAvailableDrivers(schoolUUID)
+	if err != nil {
+		return dto.RoutePlanDTO{}, err
+	}
+
+	// Seats are counted the way AddRoute checks them
+	tx, err := s.routeRepository.BeginTransaction()
+	if err != nil {
+		return dto.RoutePlanDTO{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	vehicles := make([]plannerVehicle, len(drivers))
+	for i, driver := range drivers {
+		vehicleSeats, err := s.routeRepository.GetVehicleSeatsByDriver(tx, driver.DriverUUID.String())
+		if err != nil {
+			return dto.RoutePlanDTO{}, err
+		}
+		assignedStudentsCount, err := s.routeRepository.CountAssignedStudentsByDriver(tx, driver.DriverUUID.String())
+		if err != nil {
+			return dto.RoutePlanDTO{}, err
+		}
+
+		vehicles[i].capacity = vehicleSeats - assignedStudentsCount
+		if driver.DepotLatitude.Valid && driver.DepotLongitude.Valid {
+			vehicles[i].depot = &geoPoint{latitude: driver.DepotLatitude.Float64, longitude: driver.DepotLongitude.Float64}
+		}
+	}
+
+	planner := &routePlanner{
+		school:  geoPoint{latitude: plan.School.Latitude, longitude: plan.School.Longitude},
+		maxRide: maxRide,
+	}
+	routes, rideTooLong, leftOver := planner.plan(pickups, vehicles)
+
+	for i, route := range routes {
+		driver := drivers[route.vehicle]
+		driverName := strings.TrimSpace(driver.DriverFirstName + " " + driver.DriverLastName)
+
+		planned := dto.PlannedRouteDTO{
+			Route: dto.RoutesRequestDTO{
+				RouteName:        fmt.Sprintf("Route %d - %s", i+1, driverName),
+				RouteDescription: fmt.Sprintf("%s, %d students", driver.VehicleName, len(route.pickups)),
+				RouteAssignment:  []dto.RouteAssignmentRequestDTO{{DriverUUID: driver.DriverUUID}},
+			},
+			DriverName:         driverName,
+			VehicleName:        driver.VehicleName,
+			Capacity:           vehicles[route.vehicle].capacity,
+			Distance:           math.Round(route.distance*100) / 100,
+			LongestRideMinutes: math.Round(route.longestRide.Minutes()*10) / 10,
+		}
+		if depot := vehicles[route.vehicle].depot; depot != nil {
+			planned.Start = &dto.RoutePointDTO{
+				Type:      "depot",
+				UUID:      driver.DriverUUID.String(),
+				Name:      "Driver depot",
+				Latitude:  depot.latitude,
+				Longitude: depot.longitude,
+			}
+		}
+
+		for order, student := range route.pickups {
+			planned.Route.RouteAssignment[0].Students = append(planned.Route.RouteAssignment[0].Students, dto.StudentReqDTO{
+				StudentUUID:  uuid.MustParse(points[student].UUID),
+				StudentOrder: strconv.Itoa(order + 1),
+			})
+			planned.Stops = append(planned.Stops, points[student])
+		}
+
+		plan.Routes = append(plan.Routes, planned)
+	}
+
+	for _, student := range rideTooLong {
+		plan.UnassignedStudents = append(plan.UnassignedStudents, dto.UnassignedStudentDTO{Student: points[student], Reason: "ride_too_long"})
+	}
+	for _, student := range leftOver {
+		plan.UnassignedStudents = append(plan.UnassignedStudents, dto.UnassignedStudentDTO{Student: points[student], Reason: "no_seats_left"})
+	}
+
+	return plan, nil
+}
 
 func (service *routeService) GetAllRoutesByAS(page, limit int, sortField, sortDirection, schoolUUID string) ([]dto.RoutesResponseDTO, int, error) {
 	offset := (page - 1) * limit
@@ -3,9 +3,11 @@ package services
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
+	"shuttle/errors"
 	"shuttle/models/dto"
 	"shuttle/models/entity"
 	"shuttle/repositories"
@@ -19,6 +21,8 @@ type SchoolServiceInterface interface {
 	AddSchool(req dto.SchoolRequestDTO, username string) error
 	UpdateSchool(id string, req dto.SchoolRequestDTO, username string) error
 	DeleteSchool(id, username, adminUUID string) error
+	GetSchoolGeofence(schoolUUID string) (dto.SchoolGeofenceResponseDTO, error)
+	UpdateSchoolGeofence(schoolUUID string, req dto.SchoolGeofenceRequestDTO, username string) error
 }
 
 type SchoolService struct {
@@ -276,6 +280,67 @@ func (service *SchoolService) DeleteSchool(id, username, adminUUID string) error
 	}
 }
 
+// A fence tighter than GPS accuracy may never be entered, a wider one fires
+// streets away from the stop
+const (
+	minGeofenceRadius = 20
+	maxGeofenceRadius = 1000
+)
+
+func (service *SchoolService) GetSchoolGeofence(schoolUUID string) (dto.SchoolGeofenceResponseDTO, error) {
+	parsedUUID, err := uuid.Parse(schoolUUID)
+	if err != nil {
+		return dto.SchoolGeofenceResponseDTO{}, errors.New("invalid school UUID", 400)
+	}
+
+	geofence, err := service.schoolRepository.FetchSchoolGeofence(parsedUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return dto.SchoolGeofenceResponseDTO{}, errors.New("school not found", 404)
+		}
+		return dto.SchoolGeofenceResponseDTO{}, err
+	}
+
+	return dto.SchoolGeofenceResponseDTO{
+		SchoolUUID:     geofence.SchoolUUID.String(),
+		PickupRadius:   geofence.PickupRadius,
+		SchoolRadius:   geofence.SchoolRadius,
+		TransitionMode: geofence.TransitionMode,
+		UpdatedAt:      safeTimeFormat(geofence.UpdatedAt),
+		UpdatedBy:      safeStringFormat(geofence.UpdatedBy),
+	}, nil
+}
+
+func (service *SchoolService) UpdateSchoolGeofence(schoolUUID string, req dto.SchoolGeofenceRequestDTO, username string) error {
+	parsedUUID, err := uuid.Parse(schoolUUID)
+	if err != nil {
+		return errors.New("invalid school UUID", 400)
+	}
+
+	for _, radius := range []float64{req.PickupRadius, req.SchoolRadius} {
+		if radius < minGeofenceRadius || radius > maxGeofenceRadius {
+			return errors.New(fmt.Sprintf("radii must be between %d and %d meters", minGeofenceRadius, maxGeofenceRadius), 400)
+		}
+	}
+	if req.TransitionMode != entity.GeofenceModeAuto && req.TransitionMode != entity.GeofenceModeConfirm {
+		return errors.New("transition mode must be either auto or confirm", 400)
+	}
+
+	geofence := entity.SchoolGeofence{
+		SchoolUUID:     parsedUUID,
+		PickupRadius:   req.PickupRadius,
+		SchoolRadius:   req.SchoolRadius,
+		TransitionMode: req.TransitionMode,
+		UpdatedBy:      toNullString(username),
+	}
+
+	if err := service.schoolRepository.SaveSchoolGeofence(geofence); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func safeStringFormat(s sql.NullString) string {
 	if !s.Valid || s.String == "" {
 		return "N/A"
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"shuttle/errors"
+	"shuttle/models/dto"
+	"shuttle/models/entity"
+	"shuttle/repositories"
+
+	"github.com/google/uuid"
+)
+
+type SessionServiceInterface interface {
+	CreateSession(userUUID, deviceLabel, userAgent, ipAddress, fcmToken string) (uuid.UUID, error)
+	GetActiveSessions(userUUID, currentSessionUUID string) ([]dto.SessionResponseDTO, error)
+	TouchSession(sessionUUID string) error
+	RevokeSession(userUUID, sessionUUID, revokedBy string) error
+	RevokeAllSessions(userUUID, revokedBy string) ([]uuid.UUID, error)
+}
+
+type SessionService struct {
+	sessionRepository repositories.SessionRepositoryInterface
+}
+
+func NewSessionService(sessionRepository repositories.SessionRepositoryInterface) SessionService {
+	return SessionService{
+		sessionRepository: sessionRepository,
+	}
+}
+
+// A session is one logged-in device, its UUID is also the refresh token family
+func (service *SessionService) CreateSession(userUUID, deviceLabel, userAgent, ipAddress, fcmToken string) (uuid.UUID, error) {
+	parsedUserUUID, err := uuid.Parse(userUUID)
+	if err != nil {
+		return uuid.Nil, errors.New("invalid user UUID format", 0)
+	}
+
+	// Device labels are free text from the client
+	if labelRunes := []rune(deviceLabel); len(labelRunes) > 100 {
+		deviceLabel = string(labelRunes[:100])
+	}
+
+	session := entity.UserSession{
+		ID:          time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6),
+		UUID:        uuid.New(),
+		UserUUID:    parsedUserUUID,
+		DeviceLabel: toNullString(deviceLabel),
+		UserAgent:   toNullString(userAgent),
+		IPAddress:   toNullString(ipAddress),
+	}
+
+	fcmTokenData := entity.FCMToken{
+		ID:          time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6),
+		UserUUID:    parsedUserUUID,
+		SessionUUID: session.UUID,
+		DeviceToken: fcmToken,
+	}
+
+	if err := service.sessionRepository.SaveSession(session, fcmTokenData); err != nil {
+		return uuid.Nil, err
+	}
+
+	return session.UUID, nil
+}
+
+func (service *SessionService) GetActiveSessions(userUUID, currentSessionUUID string) ([]dto.SessionResponseDTO, error) {
+	parsedUserUUID, err := uuid.Parse(userUUID)
+	if err != nil {
+		return nil, errors.New("invalid user UUID format", 0)
+	}
+
+	sessions, err := service.sessionRepository.FetchActiveSessions(parsedUserUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionsDTO []dto.SessionResponseDTO
+	for _, session := range sessions {
+		sessionsDTO = append(sessionsDTO, dto.SessionResponseDTO{
+			SessionUUID: session.UUID.String(),
+			DeviceLabel: safeStringFormat(session.DeviceLabel),
+			UserAgent:   safeStringFormat(session.UserAgent),
+			IPAddress:   safeStringFormat(session.IPAddress),
+			PushEnabled: session.HasFCMToken,
+			IsCurrent:   session.UUID.String() == currentSessionUUID,
+			CreatedAt:   safeTimeFormat(session.CreatedAt),
+			LastSeenAt:  safeTimeFormat(session.LastSeenAt),
+		})
+	}
+
+	return sessionsDTO, nil
+}
+
+func (service *SessionService) TouchSession(sessionUUID string) error {
+	parsedSessionUUID, err := uuid.Parse(sessionUUID)
+	if err != nil {
+		return errors.New("invalid session UUID format", 0)
+	}
+
+	return service.sessionRepository.TouchSession(parsedSessionUUID)
+}
+
+func (service *SessionService) RevokeSession(userUUID, sessionUUID, revokedBy string) error {
+	parsedUserUUID, err := uuid.Parse(userUUID)
+	if err != nil {
+		return errors.New("invalid user UUID format", 0)
+	}
+
+	parsedSessionUUID, err := uuid.Parse(sessionUUID)
+	if err != nil {
+		return errors.New("invalid session UUID format", 400)
+	}
+
+	if _, err := service.sessionRepository.FetchActiveSession(parsedUserUUID, parsedSessionUUID); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("session not found", 404)
+		}
+		return err
+	}
+
+	return service.sessionRepository.RevokeSessions(parsedUserUUID, []uuid.UUID{parsedSessionUUID}, revokedBy)
+}
+
+// Revoke every active session of a user and return the revoked session UUIDs
+func (service *SessionService) RevokeAllSessions(userUUID, revokedBy string) ([]uuid.UUID, error) {
+	parsedUserUUID, err := uuid.Parse(userUUID)
+	if err != nil {
+		return nil, errors.New("invalid user UUID format", 400)
+	}
+
+	sessions, err := service.sessionRepository.FetchActiveSessions(parsedUserUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionUUIDs []uuid.UUID
+	for _, session := range sessions {
+		sessionUUIDs = append(sessionUUIDs, session.UUID)
+	}
+
+	if err := service.sessionRepository.RevokeSessions(parsedUserUUID, sessionUUIDs, revokedBy); err != nil {
+		return nil, err
+	}
+
+	return sessionUUIDs, nil
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"shuttle/errors"
+	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/repositories"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+const (
+	totpPeriod         = 30
+	totpDigits         = 6
+	totpSkew           = 1
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+type TwoFactorServiceInterface interface {
+	GetTwoFactorStatus(userUUID, roleCode string) (dto.TwoFactorStatusDTO, error)
+	BeginEnrolment(userUUID, accountName string) (dto.TwoFactorEnrolmentDTO, error)
+	ConfirmEnrolment(userUUID, code string) ([]string, error)
+	VerifyCode(userUUID, code string) error
+	RegenerateRecoveryCodes(userUUID, code string) ([]string, error)
+	DisableTwoFactor(userUUID, roleCode, password, code string) error
+	ResetTwoFactor(userUUID string) error
+}
+
+// Keeps TOTP secrets encrypted at rest, implemented on top of the token keyring
+type SecretCipher interface {
+	EncryptSecret(secret string) (string, error)
+	DecryptSecret(encryptedSecret string) (string, error)
+	IsCurrentSecret(encryptedSecret string) bool
+}
+
+type TwoFactorService struct {
+	twoFactorRepository repositories.TwoFactorRepositoryInterface
+	authRepository      repositories.AuthRepositoryInterface
+	secretCipher        SecretCipher
+	issuer              string
+}
+
+func NewTwoFactorService(twoFactorRepository repositories.TwoFactorRepositoryInterface, authRepository repositories.AuthRepositoryInterface, secretCipher SecretCipher) TwoFactorService {
+	issuer := viper.GetString("TWO_FACTOR_ISSUER")
+	if issuer == "" {
+		issuer = "Shuttle"
+	}
+
+	return TwoFactorService{
+		twoFactorRepository: twoFactorRepository,
+		authRepository:      authRepository,
+		secretCipher:        secretCipher,
+		issuer:              issuer,
+	}
+}
+
+func (service *TwoFactorService) GetTwoFactorStatus(userUUID, roleCode string) (dto.TwoFactorStatusDTO, error) {
+	required, err := service.twoFactorRepository.CheckTwoFactorRequired(roleCode)
+	if err != nil {
+		return dto.TwoFactorStatusDTO{}, err
+	}
+
+	status := dto.TwoFactorStatusDTO{Required: required}
+
+	twoFactor, err := service.twoFactorRepository.FetchTwoFactor(userUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return status, nil
+		}
+		return dto.TwoFactorStatusDTO{}, err
+	}
+	status.Enabled = twoFactor.EnabledAt.Valid
+
+	if status.Enabled {
+		status.RecoveryCodesLeft, err = service.twoFactorRepository.CountUnusedRecoveryCodes(userUUID)
+		if err != nil {
+			return dto.TwoFactorStatusDTO{}, err
+		}
+	}
+
+	return status, nil
+}
+
+// Generate a new secret, it only takes effect once a code from it is confirmed
+func (service *TwoFactorService) BeginEnrolment(userUUID, accountName string) (dto.TwoFactorEnrolmentDTO, error) {
+	twoFactor, err := service.twoFactorRepository.FetchTwoFactor(userUUID)
+	if err != nil && err != sql.ErrNoRows {
+		return dto.TwoFactorEnrolmentDTO{}, err
+	}
+	if err == nil && twoFactor.EnabledAt.Valid {
+		return dto.TwoFactorEnrolmentDTO{}, errors.New("two-factor authentication is already enabled", 409)
+	}
+
+	secretBytes := make([]byte, 20)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return dto.TwoFactorEnrolmentDTO{}, err
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secretBytes)
+
+	encryptedSecret, err := service.secretCipher.EncryptSecret(secret)
+	if err != nil {
+		return dto.TwoFactorEnrolmentDTO{}, err
+	}
+
+	if err := service.twoFactorRepository.SaveTwoFactorSecret(userUUID, encryptedSecret); err != nil {
+		return dto.TwoFactorEnrolmentDTO{}, err
+	}
+
+	return dto.TwoFactorEnrolmentDTO{
+		Secret:          secret,
+		ProvisioningURI: service.provisioningURI(secret, accountName),
+	}, nil
+}
+
+// Enable 2FA with the first valid code and hand out the recovery codes
+func (service *TwoFactorService) ConfirmEnrolment(userUUID, code string) ([]string, error) {
+	twoFactor, err := service.twoFactorRepository.FetchTwoFactor(userUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("two-factor enrolment has not been started", 400)
+		}
+		return nil, err
+	}
+	if twoFactor.EnabledAt.Valid {
+		return nil, errors.New("two-factor authentication is already enabled", 409)
+	}
+
+	secret, err := service.secretCipher.DecryptSecret(twoFactor.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, errors.New("invalid two-factor code", 401)
+	}
+
+	recoveryCodes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.twoFactorRepository.EnableTwoFactor(userUUID, step, codeHashes); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// Accept either a TOTP code or one of the unused recovery codes
+func (service *TwoFactorService) VerifyCode(userUUID, code string) error {
+	twoFactor, err := service.twoFactorRepository.FetchTwoFactor(userUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("two-factor authentication is not enabled", 400)
+		}
+		return err
+	}
+	if !twoFactor.EnabledAt.Valid {
+		return errors.New("two-factor authentication is not enabled", 400)
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		used, err := service.twoFactorRepository.UseRecoveryCode(userUUID, hashResetCode(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errors.New("invalid two-factor code", 401)
+		}
+		return nil
+	}
+
+	return service.verifyTOTP(twoFactor.Secret, userUUID, code)
+}
+
+func (service *TwoFactorService) RegenerateRecoveryCodes(userUUID, code string) ([]string, error) {
+	if err := service.VerifyCode(userUUID, code); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.twoFactorRepository.ReplaceRecoveryCodes(userUUID, codeHashes); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+func (service *TwoFactorService) DisableTwoFactor(userUUID, roleCode, password, code string) error {
+	required, err := service.twoFactorRepository.CheckTwoFactorRequired(roleCode)
+	if err != nil {
+		return err
+	}
+	if required {
+		return errors.New("two-factor authentication is mandatory for your role", 403)
+	}
+
+	parsedUserUUID, err := uuid.Parse(userUUID)
+	if err != nil {
+		return errors.New("invalid user UUID format", 400)
+	}
+
+	storedPassword, err := service.authRepository.FetchPasswordByUUID(parsedUserUUID)
+	if err != nil {
+		return err
+	}
+
+	if !validatePassword(password, storedPassword) {
+		return errors.New("password is incorrect", 400)
+	}
+
+	if err := service.VerifyCode(userUUID, code); err != nil {
+		return err
+	}
+
+	_, err = service.twoFactorRepository.DeleteTwoFactor(userUUID)
+	return err
+}
+
+// Used by super admins when a user lost their authenticator, the user has
+// to enrol again on the next login if their role requires 2FA
+func (service *TwoFactorService) ResetTwoFactor(userUUID string) error {
+	if _, err := uuid.Parse(userUUID); err != nil {
+		return errors.New("invalid user UUID format", 400)
+	}
+
+	deleted, err := service.twoFactorRepository.DeleteTwoFactor(userUUID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.New("two-factor authentication is not enabled for this user", 404)
+	}
+
+	return nil
+}
+
+func (service *TwoFactorService) verifyTOTP(encryptedSecret, userUUID, code string) error {
+	secret, err := service.secretCipher.DecryptSecret(encryptedSecret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return errors.New("invalid two-factor code", 401)
+	}
+
+	fresh, err := service.twoFactorRepository.UpdateLastUsedStep(userUUID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return errors.New("two-factor code has already been used", 401)
+	}
+
+	// Move the secret off an encryption key that is being rotated out
+	if !service.secretCipher.IsCurrentSecret(encryptedSecret) {
+		if reencryptedSecret, err := service.secretCipher.EncryptSecret(secret); err == nil {
+			if err := service.twoFactorRepository.UpdateTwoFactorSecret(userUUID, reencryptedSecret); err != nil {
+				logger.LogError(err, "Failed to re-encrypt two-factor secret", map[string]interface{}{
+					"user_uuid": userUUID,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// otpauth:// URI understood by authenticator apps, clients render it as a QR code
+func (service *TwoFactorService) provisioningURI(secret, accountName string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", service.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprintf("%d", totpDigits))
+	query.Set("period", fmt.Sprintf("%d", totpPeriod))
+
+	label := url.PathEscape(service.issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// RFC 6238 with a window of one step on either side for clock drift.
+// Returns the matched step so it can be marked as used.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	currentStep := now.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := currentStep + offset
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// Recovery codes are shown once in "xxxxx-xxxxx" form and stored hashed
+func generateRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	var recoveryCodes, codeHashes []string
+	for i := 0; i < recoveryCodeCount; i++ {
+		randomBytes := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, nil, err
+		}
+
+		code := make([]byte, recoveryCodeLength)
+		for j, b := range randomBytes {
+			code[j] = alphabet[int(b)%len(alphabet)]
+		}
+
+		recoveryCodes = append(recoveryCodes, string(code[:recoveryCodeLength/2])+"-"+string(code[recoveryCodeLength/2:]))
+		codeHashes = append(codeHashes, hashResetCode(string(code)))
+	}
+
+	return recoveryCodes, codeHashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// The SHA1 secret of RFC 6238 appendix B, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B, cut to the last six digits the apps show
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCode(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		t.Run(vector.code, func(t *testing.T) {
+			if code := totpCode([]byte("12345678901234567890"), vector.unix/totpPeriod); code != vector.code {
+				t.Fatalf("expected %s at %d, got %s", vector.code, vector.unix, code)
+			}
+		})
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		t.Run(vector.code, func(t *testing.T) {
+			step, ok := matchTOTP(rfc6238Secret, vector.code, time.Unix(vector.unix, 0))
+			if !ok {
+				t.Fatalf("expected %s to match at %d", vector.code, vector.unix)
+			}
+			if step != vector.unix/totpPeriod {
+				t.Fatalf("expected step %d, got %d", vector.unix/totpPeriod, step)
+			}
+		})
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		now    time.Time
+		want   bool
+	}{
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", time.Unix(1111111111, 0), true},
+		{"one step late", rfc6238Secret, "050471", time.Unix(1111111111+totpPeriod, 0), true},
+		{"one step early", rfc6238Secret, "050471", time.Unix(1111111111-totpPeriod, 0), true},
+		{"two steps late", rfc6238Secret, "050471", time.Unix(1111111111+2*totpPeriod, 0), false},
+		{"wrong code", rfc6238Secret, "123456", time.Unix(1111111111, 0), false},
+		{"eight digit code", rfc6238Secret, "07081804", time.Unix(1111111109, 0), false},
+		{"secret not base32", "not-a-secret!", "050471", time.Unix(1111111111, 0), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, ok := matchTOTP(test.secret, test.code, test.now); ok != test.want {
+				t.Fatalf("expected match %v, got %v", test.want, ok)
+			}
+		})
+	}
+}
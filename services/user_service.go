@@ -747,29 +747,29 @@ func (service *UserService) GetSpecUserWithDetails(id string) (UserWithDetails,
 		User: user,
 	}
 
-	switch user.RoleCode {
-	case "SA":
+	switch user.Role {
+	case entity.SuperAdmin:
 		superAdminDetails, err := service.userRepository.FetchSuperAdminDetails(user.UUID)
 		if err != nil {
 			return UserWithDetails{}, err
 		}
 		userWithDetails.SuperAdminDetails = &superAdminDetails
 
-	case "AS":
+	case entity.SchoolAdmin:
 		schoolAdminDetails, err := service.userRepository.FetchSchoolAdminDetails(user.UUID)
 		if err != nil {
 			return UserWithDetails{}, err
 		}
 		userWithDetails.SchoolAdminDetails = &schoolAdminDetails
 
-	case "P":
+	case entity.Parent:
 		parentDetails, err := service.userRepository.FetchParentDetails(user.UUID)
 		if err != nil {
 			return UserWithDetails{}, err
 		}
 		userWithDetails.ParentDetails = &parentDetails
 
-	case "D":
+	case entity.Driver:
 		driverDetails, err := service.userRepository.FetchDriverDetails(user.UUID)
 		if err != nil {
 			return UserWithDetails{}, err
@@ -874,6 +874,9 @@ func (s *UserService) saveRoleDetails(tx *sqlx.Tx, userUUID uuid.UUID, req dto.U
 			Address:       req.Address,
 			LicenseNumber: parsedDetails.LicenseNumber,
 		}
+		if driverDetails.DepotPoint, err = depotPointJSON(parsedDetails.DepotPoint); err != nil {
+			return err
+		}
 		return s.userRepository.SaveDriverDetails(tx, driverDetails, userUUID, nil)
 
 	default:
@@ -944,6 +947,11 @@ func (s *UserService) updateRoleDetails(tx *sqlx.Tx, req dto.UserRequestsDTO, id
 			Address:       req.Address,
 			LicenseNumber: details.LicenseNumber,
 		}
+		depotPoint, err := depotPointJSON(details.DepotPoint)
+		if err != nil {
+			return err
+		}
+		driverDetails.DepotPoint = depotPoint
 		parsedUUID, err := uuid.Parse(id)
 		if err != nil {
 			return fmt.Errorf("invalid UUID: %w", err)
@@ -959,6 +967,18 @@ func (s *UserService) updateRoleDetails(tx *sqlx.Tx, req dto.UserRequestsDTO, id
 	return nil
 }
 
+// Stored the same way as the students' pickup points, an absent point stays NULL
+func depotPointJSON(point map[string]float64) (sql.NullString, error) {
+	if point == nil {
+		return sql.NullString{}, nil
+	}
+	pointJSON, err := json.Marshal(map[string]float64{"latitude": point["latitude"], "longitude": point["longitude"]})
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(pointJSON), Valid: true}, nil
+}
+
 func parseSafeUUID(id string) *uuid.UUID {
 	if id == "" || id == "00000000-0000-0000-0000-000000000000" {
 		return nil
@@ -422,20 +422,16 @@ func (service *VehicleService) AddVehicleForPermittedSchool(req dto.VehicleReque
     }
     log.Printf("Vehicle entity created: %+v\n", vehicle)
     // Gunakan schoolUUID yang sudah ada di context
-    if role == "AS" {
-        log.Println("Role is schooladmin, using school_uuid from token")
-        if schoolUUID != "" {
-            schoolUUIDParsed, err := uuid.Parse(schoolUUID)
-            if err != nil {
-                log.Println("Error parsing school UUID:", err)
-                return errors.New("Invalid school UUID", 400)
-            }
-            vehicle.SchoolUUID = &schoolUUIDParsed
-            log.Println("School UUID parsed and assigned to vehicle:", schoolUUIDParsed)
-        } else {
-            log.Println("School UUID is required for schooladmin")
-            return errors.New("School UUID is required for schooladmin", 400)
+    // Callers scoped to a school always add vehicles to that school, whatever their role
+    if schoolUUID != "" {
+        log.Println("Caller is scoped to a school, using school_uuid from context")
+        schoolUUIDParsed, err := uuid.Parse(schoolUUID)
+        if err != nil {
+            log.Println("Error parsing school UUID:", err)
+            return errors.New("Invalid school UUID", 400)
         }
+        vehicle.SchoolUUID = &schoolUUIDParsed
+        log.Println("School UUID parsed and assigned to vehicle:", schoolUUIDParsed)
     } else {
         log.Println("Non-schooladmin role, using provided school UUID or nil")
     }
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"shuttle/databases"
+	"shuttle/logger"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// Backplane carries websocket events between API instances, so a broadcast
+// made on the node holding the driver's connection also reaches parents
+// connected to any other node. WS_BACKPLANE picks the implementation:
+// "postgres" (the default) uses LISTEN/NOTIFY, "local" keeps everything in
+// process and is only correct for a single instance.
+type Backplane interface {
+	Publish(event BackplaneEvent) error
+	Subscribe(handler func(event BackplaneEvent)) error
+	Close() error
+}
+
+const (
+	BackplaneShuttleBroadcast  = "shuttle_broadcast"
+	BackplaneSchoolBroadcast   = "school_broadcast"
+	BackplaneSessionDisconnect = "session_disconnect"
+)
+
+// Target is the shuttle or school UUID for broadcasts and the session UUID
+// for disconnects. LocationOf is the key queued locations are coalesced on.
+type BackplaneEvent struct {
+	Origin      string `json:"origin"`
+	Kind        string `json:"kind"`
+	Target      string `json:"target"`
+	MessageType string `json:"message_type,omitempty"`
+	LocationOf  string `json:"location_of,omitempty"`
+	Payload     []byte `json:"payload,omitempty"`
+}
+
+// Identifies this process, a node already delivered its own events locally
+// and skips them when they come back from the backplane
+var nodeID = uuid.New().String()
+
+func NewBackplane(db *sqlx.DB) Backplane {
+	switch viper.GetString("WS_BACKPLANE") {
+	case "local":
+		return &localBackplane{}
+	default:
+		return &postgresBackplane{
+			db:      db,
+			uri:     databases.PostgresURI(),
+			channel: "shuttle_websocket",
+		}
+	}
+}
+
+type localBackplane struct{}
+
+func (b *localBackplane) Publish(event BackplaneEvent) error {
+	return nil
+}
+
+func (b *localBackplane) Subscribe(handler func(event BackplaneEvent)) error {
+	return nil
+}
+
+func (b *localBackplane) Close() error {
+	return nil
+}
+
+// NOTIFY payloads are capped by Postgres at just under 8000 bytes
+const postgresNotifyMaxPayload = 7999
+
+type postgresBackplane struct {
+	db       *sqlx.DB
+	uri      string
+	channel  string
+	listener *pq.Listener
+}
+
+// Notifications go through the pool, listening needs a dedicated connection
+// that pq.Listener re-establishes after network failures
+func (b *postgresBackplane) Publish(event BackplaneEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if len(payload) > postgresNotifyMaxPayload {
+		return fmt.Errorf("backplane event of %d bytes exceeds the notify limit", len(payload))
+	}
+
+	_, err = b.db.Exec("SELECT pg_notify($1, $2)", b.channel, string(payload))
+	return err
+}
+
+func (b *postgresBackplane) Subscribe(handler func(event BackplaneEvent)) error {
+	b.listener = pq.NewListener(b.uri, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			logger.LogError(err, "Websocket backplane disconnected", nil)
+		case pq.ListenerEventReconnected:
+			logger.LogInfo("Websocket backplane reconnected", nil)
+		case pq.ListenerEventConnectionAttemptFailed:
+			logger.LogError(err, "Websocket backplane failed to reconnect", nil)
+		}
+	})
+
+	if err := b.listener.Listen(b.channel); err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case notification, ok := <-b.listener.Notify:
+				if !ok {
+					return
+				}
+				// A nil notification follows a reconnect, events sent while
+				// disconnected are lost, which is fine for live positions
+				if notification == nil {
+					continue
+				}
+
+				var event BackplaneEvent
+				if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+					logger.LogError(err, "Invalid websocket backplane event", nil)
+					continue
+				}
+				if event.Origin == nodeID {
+					continue
+				}
+				handler(event)
+			case <-time.After(90 * time.Second):
+				// Detects a dead connection when nothing is being published
+				go b.listener.Ping()
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (b *postgresBackplane) Close() error {
+	if b.listener == nil {
+		return nil
+	}
+	return b.listener.Close()
+}
@@ -21,18 +21,8 @@ func InitFirebase() {
 	FirebaseApp = app
 }
 
-// Send a notification to a device
+// Send a notification to every device the user is logged in on
 func SendNotification(userUUID, title, status string) error {
-    deviceToken, err := getDeviceToken(userUUID)
-    if err != nil {
-        return err
-    }
-
-    client, err := FirebaseApp.Messaging(context.Background())
-    if err != nil {
-        return errors.New("fcm: failed to get Firebase Messaging client")
-    }
-
     var body string
     switch status {
     case "home":
@@ -51,31 +41,52 @@ func SendNotification(userUUID, title, status string) error {
         return errors.New("fcm: invalid status")
     }
 
-    message := &messaging.Message{
+    return SendPushMessage(userUUID, title, body)
+}
+
+// Send a free text notification to every device the user is logged in on
+func SendPushMessage(userUUID, title, body string) error {
+    deviceTokens, err := getDeviceTokens(userUUID)
+    if err != nil {
+        return err
+    }
+
+    client, err := FirebaseApp.Messaging(context.Background())
+    if err != nil {
+        return errors.New("fcm: failed to get Firebase Messaging client")
+    }
+
+    message := &messaging.MulticastMessage{
         Notification: &messaging.Notification{
             Title: title,
             Body:  body,
         },
-        Token: deviceToken,
+        Tokens: deviceTokens,
     }
 
-    _, err = client.Send(context.Background(), message)
-    if err != nil {
+    response, err := client.SendEachForMulticast(context.Background(), message)
+    if err != nil || response.SuccessCount == 0 {
         return errors.New("fcm: failed to send message")
     }
     return nil
 }
 
-// Get device token from the database
-func getDeviceToken(userUUID string) (string, error) {
-    var deviceToken string
-    query := "SELECT device_token FROM fcm_tokens WHERE user_uuid = $1"
-    log.Println("Query yang dijalankan:", query, "dengan userUUID:", userUUID) // Logging query sebelum eksekusi
-    err := db.QueryRow(query, userUUID).Scan(&deviceToken)
+// Get the device tokens of the user's active sessions
+func getDeviceTokens(userUUID string) ([]string, error) {
+    var deviceTokens []string
+    query := `
+        SELECT f.device_token
+        FROM fcm_tokens f
+        JOIN user_sessions s ON s.session_uuid = f.session_uuid
+        WHERE f.user_uuid = $1 AND s.revoked_at IS NULL
+    `
+    err := db.Select(&deviceTokens, query, userUUID)
     if err != nil {
-        log.Println("Error saat mengambil token:", err) // Logging error jika terjadi
-        return "", errors.New("fcm: failed to get device token")
+        log.Println("Error saat mengambil token:", err)
+        return nil, errors.New("fcm: failed to get device token")
     }
-    log.Println("Device token yang didapat:", deviceToken) // Logging hasil device token
-    return deviceToken, nil
-}
\ No newline at end of file
+    if len(deviceTokens) == 0 {
+        return nil, errors.New("fcm: no device token registered")
+    }
+    return deviceTokens, nil
+}
@@ -0,0 +1,470 @@
+package utils
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/models/entity"
+	"shuttle/repositories"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/umahmood/haversine"
+)
+
+// ETAs are recomputed on every accepted ping of a driver. The remaining stops
+// of today's trip come from route_assignment in student_order: in the morning
+// the pickup points of the students still waiting then the school, in the
+// afternoon the school while students wait there then their homes in reverse
+// order. Each leg is driven at the average speed learned for it on past
+// trips, or ETA_DEFAULT_SPEED until it has been driven once. Straight line
+// distances are stretched by ETA_DETOUR_FACTOR to account for the roads.
+//
+// Every student gets the ETA of their next stop, pushed to their shuttle
+// group as eta_update when it moved by more than etaPushThreshold.
+type etaStop struct {
+	key       string
+	latitude  float64
+	longitude float64
+	targets   []etaTarget
+}
+
+// A shuttle waiting for the bus at a stop, stop is pickup, school or dropoff
+type etaTarget struct {
+	shuttleUUID string
+	studentUUID string
+	stop        string
+}
+
+type driverETA struct {
+	mutex sync.Mutex
+
+	stops    []etaStop
+	speeds   map[string]float64
+	loadedAt time.Time
+
+	// Stop the bus is standing at, and the last one it left and when, a leg
+	// driven from one stop to the next becomes a speed sample
+	atStop     string
+	leftStop   etaStop
+	leftStopAt time.Time
+
+	pushed    map[string]etaPush
+	updatedAt time.Time
+
+	// The same trip drives the geofences, see checkGeofences
+	trip     []entity.TripStop
+	geofence entity.SchoolGeofence
+	fenced   map[string]string
+}
+
+type etaPush struct {
+	arrivalAt time.Time
+	pushedAt  time.Time
+}
+
+const (
+	// The plan is reloaded that often, status changes are picked up with it
+	etaPlanRefresh   = 30 * time.Second
+	etaPushThreshold = 30 * time.Second
+	etaMaxAge        = 5 * time.Minute
+)
+
+var (
+	driverETAs       = make(map[string]*driverETA)
+	driverETAMutex   = &sync.Mutex{}
+	driverETASweptAt = time.Now()
+
+	// The latest ETA of every shuttle, filled from the pushes this node sees
+	lastETAs       = make(map[string]dto.RealtimeETAUpdatePayload)
+	lastETAMutex   = &sync.RWMutex{}
+	lastETASweptAt = time.Now()
+)
+
+func etaDefaultSpeed() float64 {
+	if speed := viper.GetFloat64("ETA_DEFAULT_SPEED"); speed > 0 {
+		return speed
+	}
+	return 25 // km/h
+}
+
+func etaDetourFactor() float64 {
+	if factor := viper.GetFloat64("ETA_DETOUR_FACTOR"); factor >= 1 {
+		return factor
+	}
+	return 1.3
+}
+
+func etaStopDwell() time.Duration {
+	if dwell := viper.GetDuration("ETA_STOP_DWELL"); dwell > 0 {
+		return dwell
+	}
+	return time.Minute
+}
+
+func etaArrivalRadius() float64 {
+	if radius := viper.GetFloat64("ETA_ARRIVAL_RADIUS"); radius > 0 {
+		return radius
+	}
+	return 80 // meters
+}
+
+// Called with every ping that made it through the GPS filter
+func updateETAs(driverUUID string, latitude, longitude float64, recordedAt time.Time) {
+	state := driverETAState(driverUUID)
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if time.Since(state.loadedAt) >= etaPlanRefresh {
+		if err := state.load(driverUUID); err != nil {
+			logger.LogError(err, "Failed to load the driver's trip for ETAs", map[string]interface{}{"DriverUUID": driverUUID})
+			return
+		}
+	}
+	state.updatedAt = time.Now()
+
+	if len(state.stops) == 0 {
+		return
+	}
+
+	state.trackStops(latitude, longitude, recordedAt)
+
+	for _, payload := range state.compute(latitude, longitude, recordedAt) {
+		arrivalAt, _ := time.Parse(time.RFC3339, payload.ArrivalAt)
+		last, pushed := state.pushed[payload.ShuttleUUID]
+		if pushed && absDuration(arrivalAt.Sub(last.arrivalAt)) < etaPushThreshold && time.Since(last.pushedAt) < etaPushThreshold {
+			continue
+		}
+
+		state.pushed[payload.ShuttleUUID] = etaPush{arrivalAt: arrivalAt, pushedAt: time.Now()}
+		rememberETA(payload)
+		PublishRealtimeMessage(payload.ShuttleUUID, dto.RealtimeTypeETAUpdate, payload)
+	}
+}
+
+// Makes the next ping reload the driver's trip, after a status change
+func ForgetETAPlan(driverUUID string) {
+	driverETAMutex.Lock()
+	defer driverETAMutex.Unlock()
+
+	if state, exists := driverETAs[driverUUID]; exists {
+		state.mutex.Lock()
+		state.loadedAt = time.Time{}
+		state.mutex.Unlock()
+	}
+}
+
+func driverETAState(driverUUID string) *driverETA {
+	driverETAMutex.Lock()
+	defer driverETAMutex.Unlock()
+
+	// Drivers that stopped sending are forgotten after an hour
+	if time.Since(driverETASweptAt) > 10*time.Minute {
+		for key, state := range driverETAs {
+			state.mutex.Lock()
+			stale := time.Since(state.updatedAt) > time.Hour
+			state.mutex.Unlock()
+			if stale {
+				delete(driverETAs, key)
+			}
+		}
+		driverETASweptAt = time.Now()
+	}
+
+	state, exists := driverETAs[driverUUID]
+	if !exists {
+		state = &driverETA{speeds: make(map[string]float64), pushed: make(map[string]etaPush), fenced: make(map[string]string)}
+		driverETAs[driverUUID] = state
+	}
+	return state
+}
+
+func (state *driverETA) load(driverUUID string) error {
+	parsedDriverUUID, err := uuid.Parse(driverUUID)
+	if err != nil {
+		return err
+	}
+
+	etaRepository := repositories.NewETARepository(db)
+	tripStops, err := etaRepository.FetchDriverTripStops(parsedDriverUUID)
+	if err != nil {
+		return err
+	}
+
+	state.stops = buildETAStops(tripStops)
+	state.loadedAt = time.Now()
+	state.loadGeofence(tripStops)
+
+	if len(state.stops) == 0 {
+		return nil
+	}
+
+	fromPoints := make([]string, 0, len(state.stops)+1)
+	for _, stop := range state.stops {
+		fromPoints = append(fromPoints, stop.key)
+	}
+	if state.leftStop.key != "" {
+		fromPoints = append(fromPoints, state.leftStop.key)
+	}
+
+	speeds, err := etaRepository.FetchSegmentSpeeds(fromPoints)
+	if err != nil {
+		return err
+	}
+	for _, speed := range speeds {
+		state.speeds[segmentKey(speed.FromPoint, speed.ToPoint)] = speed.AverageSpeed
+	}
+	return nil
+}
+
+// The remaining stops of the trip in driving order, see updateETAs
+func buildETAStops(tripStops []entity.TripStop) []etaStop {
+	var school *etaStop
+	for _, tripStop := range tripStops {
+		if tripStop.SchoolLatitude.Valid && tripStop.SchoolLongitude.Valid {
+			school = &etaStop{
+				key:       "school:" + tripStop.SchoolUUID.String(),
+				latitude:  tripStop.SchoolLatitude.Float64,
+				longitude: tripStop.SchoolLongitude.Float64,
+			}
+			break
+		}
+	}
+	if school == nil {
+		return nil
+	}
+
+	studentStop := func(tripStop entity.TripStop) (etaStop, bool) {
+		if !tripStop.PickupLatitude.Valid || !tripStop.PickupLongitude.Valid {
+			return etaStop{}, false
+		}
+		return etaStop{
+			key:       "student:" + tripStop.StudentUUID.String(),
+			latitude:  tripStop.PickupLatitude.Float64,
+			longitude: tripStop.PickupLongitude.Float64,
+		}, true
+	}
+	target := func(tripStop entity.TripStop, stop string) etaTarget {
+		return etaTarget{shuttleUUID: tripStop.ShuttleUUID.String(), studentUUID: tripStop.StudentUUID.String(), stop: stop}
+	}
+
+	var morning, afternoon bool
+	for _, tripStop := range tripStops {
+		switch tripStop.Status {
+		case "waiting_to_be_taken_to_school", "going_to_school":
+			morning = true
+		case "waiting_to_be_taken_to_home", "going_to_home":
+			afternoon = true
+		}
+	}
+
+	var stops []etaStop
+	switch {
+	case morning:
+		for _, tripStop := range tripStops {
+			switch tripStop.Status {
+			case "waiting_to_be_taken_to_school":
+				if stop, ok := studentStop(tripStop); ok {
+					stop.targets = []etaTarget{target(tripStop, "pickup")}
+					stops = append(stops, stop)
+				}
+			case "going_to_school":
+				school.targets = append(school.targets, target(tripStop, "school"))
+			}
+		}
+		stops = append(stops, *school)
+	case afternoon:
+		for _, tripStop := range tripStops {
+			if tripStop.Status == "waiting_to_be_taken_to_home" {
+				school.targets = append(school.targets, target(tripStop, "pickup"))
+			}
+		}
+		if len(school.targets) > 0 {
+			stops = append(stops, *school)
+		}
+
+		// Students still at school are dropped off too, only later
+		for i := len(tripStops) - 1; i >= 0; i-- {
+			tripStop := tripStops[i]
+			if tripStop.Status != "waiting_to_be_taken_to_home" && tripStop.Status != "going_to_home" {
+				continue
+			}
+			if stop, ok := studentStop(tripStop); ok {
+				if tripStop.Status == "going_to_home" {
+					stop.targets = []etaTarget{target(tripStop, "dropoff")}
+				}
+				stops = append(stops, stop)
+			}
+		}
+	}
+
+	return stops
+}
+
+// Records a speed sample when the bus reaches a stop after leaving another one
+func (state *driverETA) trackStops(latitude, longitude float64, recordedAt time.Time) {
+	var reached *etaStop
+	for i := range state.stops {
+		if metersBetween(latitude, longitude, state.stops[i].latitude, state.stops[i].longitude) <= etaArrivalRadius() {
+			reached = &state.stops[i]
+			break
+		}
+	}
+
+	if reached == nil {
+		if state.atStop != "" {
+			for _, stop := range state.stops {
+				if stop.key == state.atStop {
+					state.leftStop = stop
+					state.leftStopAt = recordedAt
+				}
+			}
+			state.atStop = ""
+		}
+		return
+	}
+
+	if state.atStop == reached.key {
+		return
+	}
+	state.atStop = reached.key
+
+	if state.leftStop.key == "" || state.leftStop.key == reached.key {
+		return
+	}
+
+	fromPoint, toPoint := state.leftStop.key, reached.key
+	elapsed := recordedAt.Sub(state.leftStopAt)
+	distance := metersBetween(state.leftStop.latitude, state.leftStop.longitude, reached.latitude, reached.longitude) / 1000 * etaDetourFactor()
+	state.leftStop = etaStop{}
+
+	// Breaks and detours on the way would teach the wrong speed
+	if elapsed <= 0 || elapsed > 2*time.Hour {
+		return
+	}
+	speed := distance / elapsed.Hours()
+	if speed < 3 || speed > gpsMaxSpeed() {
+		return
+	}
+
+	key := segmentKey(fromPoint, toPoint)
+	if current, known := state.speeds[key]; known {
+		state.speeds[key] = (current*19 + speed) / 20
+	} else {
+		state.speeds[key] = speed
+	}
+
+	go func() {
+		if err := repositories.NewETARepository(db).SaveSegmentSpeed(fromPoint, toPoint, speed); err != nil {
+			logger.LogError(err, "Failed to save segment speed", map[string]interface{}{"From": fromPoint, "To": toPoint})
+		}
+	}()
+}
+
+func (state *driverETA) compute(latitude, longitude float64, recordedAt time.Time) []dto.RealtimeETAUpdatePayload {
+	var payloads []dto.RealtimeETAUpdatePayload
+
+	elapsed := time.Duration(0)
+	distance := 0.0
+	fromKey := state.leftStop.key
+	fromLatitude, fromLongitude := latitude, longitude
+
+	for i, stop := range state.stops {
+		// Each stop passed on the way costs some time
+		if i > 0 {
+			elapsed += etaStopDwell()
+		}
+
+		legDistance := metersBetween(fromLatitude, fromLongitude, stop.latitude, stop.longitude) / 1000 * etaDetourFactor()
+		speed, known := state.speeds[segmentKey(fromKey, stop.key)]
+		if !known {
+			speed = etaDefaultSpeed()
+		}
+		elapsed += time.Duration(legDistance / speed * float64(time.Hour))
+		distance += legDistance
+
+		arrivalAt := recordedAt.Add(elapsed)
+		for _, target := range stop.targets {
+			payloads = append(payloads, dto.RealtimeETAUpdatePayload{
+				ShuttleUUID: target.shuttleUUID,
+				StudentUUID: target.studentUUID,
+				Stop:        target.stop,
+				StopsAway:   i,
+				ETASeconds:  int64(elapsed.Seconds()),
+				DistanceKm:  math.Round(distance*100) / 100,
+				ArrivalAt:   arrivalAt.Format(time.RFC3339),
+				UpdatedAt:   recordedAt.Format(time.RFC3339),
+			})
+		}
+
+		fromKey = stop.key
+		fromLatitude, fromLongitude = stop.latitude, stop.longitude
+	}
+
+	return payloads
+}
+
+func segmentKey(fromPoint, toPoint string) string {
+	return fromPoint + ">" + toPoint
+}
+
+func metersBetween(fromLatitude, fromLongitude, toLatitude, toLongitude float64) float64 {
+	_, km := haversine.Distance(
+		haversine.Coord{Lat: fromLatitude, Lon: fromLongitude},
+		haversine.Coord{Lat: toLatitude, Lon: toLongitude},
+	)
+	return km * 1000
+}
+
+func absDuration(duration time.Duration) time.Duration {
+	if duration < 0 {
+		return -duration
+	}
+	return duration
+}
+
+func rememberETA(payload dto.RealtimeETAUpdatePayload) {
+	lastETAMutex.Lock()
+	defer lastETAMutex.Unlock()
+
+	lastETAs[payload.ShuttleUUID] = payload
+
+	if time.Since(lastETASweptAt) > 10*time.Minute {
+		for shuttleUUID, eta := range lastETAs {
+			if updatedAt, err := time.Parse(time.RFC3339, eta.UpdatedAt); err != nil || time.Since(updatedAt) > etaMaxAge {
+				delete(lastETAs, shuttleUUID)
+			}
+		}
+		lastETASweptAt = time.Now()
+	}
+}
+
+// ETAs pushed by other nodes are kept as well, for the REST endpoints
+func rememberETAMessage(message []byte) {
+	var envelope dto.RealtimeEnvelope
+	var payload dto.RealtimeETAUpdatePayload
+	if json.Unmarshal(message, &envelope) == nil && json.Unmarshal(envelope.Payload, &payload) == nil {
+		rememberETA(payload)
+	}
+}
+
+// The latest ETA of the shuttle, or false when none was computed lately
+func ShuttleETA(shuttleUUID string) (dto.RealtimeETAUpdatePayload, bool) {
+	lastETAMutex.RLock()
+	eta, exists := lastETAs[shuttleUUID]
+	lastETAMutex.RUnlock()
+
+	if !exists {
+		return dto.RealtimeETAUpdatePayload{}, false
+	}
+	updatedAt, err := time.Parse(time.RFC3339, eta.UpdatedAt)
+	if err != nil || time.Since(updatedAt) > etaMaxAge {
+		return dto.RealtimeETAUpdatePayload{}, false
+	}
+	return eta, true
+}
@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+
+	"shuttle/logger"
+	"shuttle/models/dto"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Server-Sent Events fallback for networks that block websocket upgrades.
+// The stream is receive only: it joins the same shuttle and school groups as
+// a websocket, through the same queue and slow consumer policy, and every
+// event is the JSON envelope a websocket would get as the data of an SSE
+// message. Subscriptions come from the query string:
+//
+//	shuttle_uuids  comma separated shuttles to follow, today's shuttles of the
+//	               caller (as driver or parent) when left out
+//	fleet=true     the school's fleet, needs school:fleet:read
+func (s *WebSocketService) HandleEventStream(c *fiber.Ctx) error {
+	userUUID, _ := c.Locals("userUUID").(string)
+	sessionUUID, _ := c.Locals("sessionUUID").(string)
+	roleCode, _ := c.Locals("role_code").(string)
+	client := newWSClient(nil, userUUID, roleCode)
+
+	shuttleUUIDs, err := s.eventStreamShuttles(c, userUUID)
+	if err != nil {
+		logger.LogError(err, "Failed to fetch the followed shuttles", map[string]interface{}{"UserUUID": userUUID})
+		return InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+	if len(shuttleUUIDs) > maxShuttleSubscriptions {
+		return BadRequestResponse(c, fmt.Sprintf("A connection can follow at most %d shuttles", maxShuttleSubscriptions), nil)
+	}
+
+	fleet := c.QueryBool("fleet")
+	if fleet {
+		allowed, err := s.permissionService.HasPermission(roleCode, fleetPermission)
+		if err != nil {
+			logger.LogError(err, "Failed to check permission", map[string]interface{}{"role_code": roleCode, "permission": fleetPermission})
+			return InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+		}
+		if !allowed {
+			return ForbiddenResponse(c, "You don't have permission to follow the school fleet", nil)
+		}
+	}
+
+	subscribed, err := s.subscribe(client, shuttleUUIDs)
+	if err == nil && fleet {
+		err = s.subscribeFleet(client)
+	}
+	if err != nil {
+		leaveGroups(client)
+		logger.LogError(err, "Failed to check shuttle group access", map[string]interface{}{"UserUUID": userUUID})
+		return InternalServerErrorResponse(c, "Something went wrong, please try again later", nil)
+	}
+	if len(subscribed) == 0 && !fleet {
+		leaveGroups(client)
+		return ForbiddenResponse(c, "You don't have access to any of these shuttles", nil)
+	}
+
+	var denied []string
+	for _, shuttleUUID := range shuttleUUIDs {
+		if _, ok := client.subscriptions[shuttleUUID]; !ok {
+			denied = append(denied, shuttleUUID)
+		}
+	}
+
+	AddConnection(sessionUUID, client)
+	logger.LogInfo("Event Stream Opened", map[string]interface{}{"UserUUID": userUUID})
+
+	client.send(dto.RealtimeTypeAck, "", dto.RealtimeAckPayload{Type: "connect", Subscribed: subscribed, Denied: denied, Fleet: client.fleet})
+	sendLastPositions(client, subscribed)
+	if fleet {
+		s.sendFleetPositions(client)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	// Keeps nginx from buffering the stream
+	c.Set("X-Accel-Buffering", "no")
+
+	// Runs once the handler has returned, the fiber context can't be used in there
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer func() {
+			leaveGroups(client)
+			RemoveConnection(sessionUUID, client)
+			// Nothing is queued for the client anymore
+			client.close(0, "", false)
+			logger.LogInfo("Event Stream Closed", map[string]interface{}{"UserUUID": userUUID})
+		}()
+
+		client.streamPump(w)
+	})
+
+	return nil
+}
+
+// The shuttles asked for in the query string, or today's shuttles of the caller
+func (s *WebSocketService) eventStreamShuttles(c *fiber.Ctx, userUUID string) ([]string, error) {
+	var shuttleUUIDs []string
+	for _, shuttleUUID := range strings.Split(c.Query("shuttle_uuids"), ",") {
+		if shuttleUUID = strings.TrimSpace(shuttleUUID); shuttleUUID != "" {
+			shuttleUUIDs = append(shuttleUUIDs, shuttleUUID)
+		}
+	}
+	if len(shuttleUUIDs) > 0 || c.QueryBool("fleet") {
+		return shuttleUUIDs, nil
+	}
+
+	parsedUserUUID, err := uuid.Parse(userUUID)
+	if err != nil {
+		return nil, nil
+	}
+
+	shuttleUUIDs, err = s.locationRepository.FetchFollowedShuttleUUIDs(parsedUserUUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(shuttleUUIDs) > maxShuttleSubscriptions {
+		shuttleUUIDs = shuttleUUIDs[len(shuttleUUIDs)-maxShuttleSubscriptions:]
+	}
+	return shuttleUUIDs, nil
+}
+
+// Plays the part of writePump for event stream clients. Comments are sent on
+// the ping interval, a failed flush is the only way to notice the client left.
+func (client *wsClient) streamPump(w *bufio.Writer) {
+	pingTicker := time.NewTicker(wsPingInterval())
+	defer pingTicker.Stop()
+
+	// Browsers reconnect on their own, after three seconds
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !client.writeStreamQueued(w) {
+		return
+	}
+
+	for {
+		select {
+		case <-pingTicker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			if err := w.Flush(); err != nil {
+				wsWriteErrors.Add(1)
+				return
+			}
+		case <-client.wake:
+			if !client.writeStreamQueued(w) {
+				return
+			}
+		case <-client.done:
+			client.queueMutex.Lock()
+			flush := client.flush
+			client.queueMutex.Unlock()
+
+			if flush {
+				client.writeStreamQueued(w)
+			}
+			return
+		}
+	}
+}
+
+// Returns false once the client can't be written to anymore
+func (client *wsClient) writeStreamQueued(w *bufio.Writer) bool {
+	for {
+		frame, ok := client.dequeue()
+		if !ok {
+			break
+		}
+
+		// Envelopes are single line JSON, a data field can't hold a newline
+		fmt.Fprintf(w, "data: %s\n\n", frame.message)
+		wsFramesSent.Add(1)
+	}
+
+	if err := w.Flush(); err != nil {
+		wsWriteErrors.Add(1)
+		logger.LogError(err, "Event Stream Write Error", map[string]interface{}{"UserUUID": client.userUUID})
+		return false
+	}
+	return true
+}
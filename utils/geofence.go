@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"time"
+
+	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/models/entity"
+	"shuttle/repositories"
+)
+
+// Shuttles move on by themselves when the bus drives into a fence around a
+// stop of today's trip:
+//
+//	waiting_to_be_taken_to_school  pickup point  going_to_school
+//	going_to_school                school        at_school
+//	waiting_to_be_taken_to_home    school        going_to_home
+//	going_to_home                  pickup point  home
+//
+// The radii come from the school's settings. In auto mode the status is
+// changed the same way the driver would, parents get the usual notification.
+// In confirm mode the driver gets a status_suggestion and confirms it with
+// the shuttle update. Either happens once per shuttle and status.
+type geofenceTransition struct {
+	stop   entity.TripStop
+	status string
+	fence  string
+}
+
+// Called with every ping that made it through the GPS filter, after
+// updateETAs has loaded the driver's trip
+func checkGeofences(client *wsClient, latitude, longitude float64) {
+	state := driverETAState(client.userUUID)
+
+	state.mutex.Lock()
+	transitions := state.enteredFences(latitude, longitude)
+	mode := state.geofence.TransitionMode
+	state.mutex.Unlock()
+
+	for _, transition := range transitions {
+		if mode == entity.GeofenceModeAuto {
+			// Notifications go out over the network, the ping is acked meanwhile
+			go applyGeofenceTransition(client.userUUID, transition)
+			continue
+		}
+
+		client.send(dto.RealtimeTypeStatusSuggestion, "", dto.RealtimeStatusSuggestionPayload{
+			ShuttleUUID: transition.stop.ShuttleUUID.String(),
+			StudentUUID: transition.stop.StudentUUID.String(),
+			StudentName: transition.stop.StudentFirstName,
+			Status:      transition.status,
+			Fence:       transition.fence,
+			SuggestedAt: time.Now().Format(time.RFC3339),
+		})
+	}
+}
+
+// Settings of the school the trip goes to. Shuttles no longer on the trip are
+// forgotten, the plan is reloaded after every status change so a shuttle
+// that moved on can trigger its next fence.
+func (state *driverETA) loadGeofence(tripStops []entity.TripStop) {
+	state.trip = tripStops
+
+	onTrip := make(map[string]bool, len(tripStops))
+	for _, tripStop := range tripStops {
+		onTrip[tripStop.ShuttleUUID.String()] = true
+	}
+	for shuttleUUID := range state.fenced {
+		if !onTrip[shuttleUUID] {
+			delete(state.fenced, shuttleUUID)
+		}
+	}
+
+	if len(tripStops) == 0 {
+		return
+	}
+
+	schoolUUID := tripStops[0].SchoolUUID
+	geofence, err := repositories.NewSchoolRepository(db).FetchSchoolGeofence(schoolUUID)
+	if err != nil {
+		logger.LogError(err, "Failed to load the school's geofences", map[string]interface{}{"SchoolUUID": schoolUUID.String()})
+		// Nothing changes by itself until the settings can be read again
+		if state.geofence.SchoolUUID != schoolUUID {
+			state.geofence = entity.SchoolGeofence{
+				SchoolUUID:     schoolUUID,
+				PickupRadius:   entity.DefaultPickupRadius,
+				SchoolRadius:   entity.DefaultSchoolRadius,
+				TransitionMode: entity.GeofenceModeConfirm,
+			}
+		}
+		return
+	}
+	state.geofence = geofence
+}
+
+func (state *driverETA) enteredFences(latitude, longitude float64) []geofenceTransition {
+	var transitions []geofenceTransition
+
+	for _, tripStop := range state.trip {
+		insidePickup := tripStop.PickupLatitude.Valid && tripStop.PickupLongitude.Valid &&
+			metersBetween(latitude, longitude, tripStop.PickupLatitude.Float64, tripStop.PickupLongitude.Float64) <= state.geofence.PickupRadius
+		insideSchool := tripStop.SchoolLatitude.Valid && tripStop.SchoolLongitude.Valid &&
+			metersBetween(latitude, longitude, tripStop.SchoolLatitude.Float64, tripStop.SchoolLongitude.Float64) <= state.geofence.SchoolRadius
+
+		var transition geofenceTransition
+		switch {
+		case tripStop.Status == "waiting_to_be_taken_to_school" && insidePickup:
+			transition = geofenceTransition{stop: tripStop, status: "going_to_school", fence: "pickup"}
+		case tripStop.Status == "going_to_school" && insideSchool:
+			transition = geofenceTransition{stop: tripStop, status: "at_school", fence: "school"}
+		case tripStop.Status == "waiting_to_be_taken_to_home" && insideSchool:
+			transition = geofenceTransition{stop: tripStop, status: "going_to_home", fence: "school"}
+		case tripStop.Status == "going_to_home" && insidePickup:
+			transition = geofenceTransition{stop: tripStop, status: "home", fence: "dropoff"}
+		default:
+			continue
+		}
+
+		shuttleUUID := tripStop.ShuttleUUID.String()
+		if state.fenced[shuttleUUID] == transition.status {
+			continue
+		}
+		state.fenced[shuttleUUID] = transition.status
+		transitions = append(transitions, transition)
+	}
+
+	return transitions
+}
+
+// Does what the shuttle update does when a driver changes the status
+func applyGeofenceTransition(driverUUID string, transition geofenceTransition) {
+	shuttleUUID := transition.stop.ShuttleUUID.String()
+
+	if err := repositories.NewShuttleRepository(db).UpdateShuttleStatus(transition.stop.ShuttleUUID, transition.status); err != nil {
+		logger.LogError(err, "Failed to apply geofence transition", map[string]interface{}{"ShuttleUUID": shuttleUUID, "Status": transition.status})
+		forgetGeofenceTransition(driverUUID, shuttleUUID)
+		return
+	}
+
+	logger.LogInfo("Geofence Transition Applied", map[string]interface{}{
+		"ShuttleUUID": shuttleUUID,
+		"DriverUUID":  driverUUID,
+		"Status":      transition.status,
+		"Fence":       transition.fence,
+	})
+
+	parentUUID := transition.stop.ParentUUID.String()
+	if err := SendNotification(parentUUID, "Shuttle Status Update", transition.status); err != nil {
+		logger.LogWarn("Failed to send notification to parent", map[string]interface{}{
+			"error":         err.Error(),
+			"shuttleUUID":   shuttleUUID,
+			"parentUUID":    parentUUID,
+			"shuttleStatus": transition.status,
+		})
+	}
+
+	statusChanged := dto.RealtimeStatusChangedPayload{
+		ShuttleUUID: shuttleUUID,
+		StudentUUID: transition.stop.StudentUUID.String(),
+		DriverUUID:  driverUUID,
+		Status:      transition.status,
+		ChangedAt:   time.Now().Format(time.RFC3339),
+		Automatic:   true,
+	}
+	PublishRealtimeMessage(shuttleUUID, dto.RealtimeTypeStatusChanged, statusChanged)
+	PublishSchoolMessage(transition.stop.SchoolUUID.String(), dto.RealtimeTypeStatusChanged, "", statusChanged)
+	ForgetETAPlan(driverUUID)
+}
+
+// Lets the next ping inside the fence try again
+func forgetGeofenceTransition(driverUUID, shuttleUUID string) {
+	state := driverETAState(driverUUID)
+
+	state.mutex.Lock()
+	delete(state.fenced, shuttleUUID)
+	state.mutex.Unlock()
+}
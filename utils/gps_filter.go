@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shuttle/logger"
+
+	"github.com/spf13/viper"
+	"github.com/umahmood/haversine"
+)
+
+// Driver pings go through a filter before anyone sees them: coordinates out
+// of range, mocked or too inaccurate are rejected, so are jumps the bus
+// couldn't have driven. What's left is smoothed with a Kalman filter and
+// broadcast at most once per GPS_BROADCAST_INTERVAL, every accepted ping is
+// still stored in the history.
+type gpsPing struct {
+	latitude   float64
+	longitude  float64
+	speed      *float64
+	heading    *float64
+	accuracy   *float64
+	mocked     bool
+	recordedAt time.Time
+}
+
+type gpsTrack struct {
+	kalman          kalmanLatLong
+	lastAccepted    gpsPing
+	lastBroadcastAt time.Time
+	rejectedInRow   int
+	updatedAt       time.Time
+}
+
+// After that many outliers in a row the bus most likely really is there, as
+// after a tunnel, and the track starts over from the new position
+const gpsMaxRejectedInRow = 3
+
+// Assumed accuracy in meters when the client doesn't send one
+const gpsDefaultAccuracy = 15.0
+
+var (
+	gpsTracks       = make(map[string]*gpsTrack)
+	gpsTrackMutex   = &sync.Mutex{}
+	gpsTrackSweptAt = time.Now()
+
+	wsPingsRejected atomic.Int64
+)
+
+func gpsMaxSpeed() float64 {
+	if maxSpeed := viper.GetFloat64("GPS_MAX_SPEED"); maxSpeed > 0 {
+		return maxSpeed
+	}
+	return 140 // km/h
+}
+
+func gpsMaxAccuracy() float64 {
+	if maxAccuracy := viper.GetFloat64("GPS_MAX_ACCURACY"); maxAccuracy > 0 {
+		return maxAccuracy
+	}
+	return 100 // meters
+}
+
+func gpsBroadcastInterval() time.Duration {
+	if interval := viper.GetDuration("GPS_BROADCAST_INTERVAL"); interval > 0 {
+		return interval
+	}
+	return 2 * time.Second
+}
+
+// Returns the smoothed position and whether it is due for broadcast, or the
+// reason the ping was rejected
+func filterGPSPing(driverUUID, shuttleUUID string, ping gpsPing) (float64, float64, bool, string) {
+	if reason := validateGPSPing(ping); reason != "" {
+		rejectGPSPing(driverUUID, shuttleUUID, ping, reason)
+		return 0, 0, false, reason
+	}
+
+	gpsTrackMutex.Lock()
+	defer gpsTrackMutex.Unlock()
+
+	sweepGPSTracks()
+
+	track, exists := gpsTracks[driverUUID]
+	if !exists {
+		track = &gpsTrack{kalman: newKalmanLatLong()}
+		gpsTracks[driverUUID] = track
+	}
+
+	if exists && track.rejectedInRow < gpsMaxRejectedInRow {
+		if reason := checkGPSMovement(track.lastAccepted, ping); reason != "" {
+			track.rejectedInRow++
+			track.updatedAt = time.Now()
+			rejectGPSPing(driverUUID, shuttleUUID, ping, reason)
+			return 0, 0, false, reason
+		}
+	} else if exists {
+		logger.LogInfo("GPS track reset after repeated outliers", map[string]interface{}{"DriverUUID": driverUUID, "ShuttleUUID": shuttleUUID})
+		track.kalman = newKalmanLatLong()
+	}
+
+	accuracy := gpsDefaultAccuracy
+	if ping.accuracy != nil {
+		accuracy = *ping.accuracy
+	}
+	latitude, longitude := track.kalman.process(ping.latitude, ping.longitude, accuracy, ping.recordedAt)
+
+	track.lastAccepted = ping
+	track.rejectedInRow = 0
+	track.updatedAt = time.Now()
+
+	broadcast := ping.recordedAt.Sub(track.lastBroadcastAt) >= gpsBroadcastInterval()
+	if broadcast {
+		track.lastBroadcastAt = ping.recordedAt
+	}
+
+	return latitude, longitude, broadcast, ""
+}
+
+func validateGPSPing(ping gpsPing) string {
+	switch {
+	case math.IsNaN(ping.latitude) || math.IsNaN(ping.longitude):
+		return "coordinates are not numbers"
+	case ping.latitude < -90 || ping.latitude > 90 || ping.longitude < -180 || ping.longitude > 180:
+		return "coordinates out of range"
+	case ping.latitude == 0 && ping.longitude == 0:
+		return "null island coordinates"
+	case ping.mocked:
+		return "mocked location"
+	case ping.accuracy != nil && (*ping.accuracy < 0 || *ping.accuracy > gpsMaxAccuracy()):
+		return "accuracy too low"
+	case ping.speed != nil && (*ping.speed < 0 || *ping.speed*3.6 > gpsMaxSpeed()):
+		return "reported speed out of range"
+	case ping.heading != nil && (*ping.heading < 0 || *ping.heading > 360):
+		return "heading out of range"
+	}
+	return ""
+}
+
+// Compares the ping with the last accepted one of the same driver
+func checkGPSMovement(previous, ping gpsPing) string {
+	elapsed := ping.recordedAt.Sub(previous.recordedAt).Seconds()
+	if elapsed < 0 {
+		return "older than the previous ping"
+	}
+
+	_, km := haversine.Distance(
+		haversine.Coord{Lat: previous.latitude, Lon: previous.longitude},
+		haversine.Coord{Lat: ping.latitude, Lon: ping.longitude},
+	)
+
+	// Pings taken within the same second are compared with a one second gap
+	if elapsed < 1 {
+		elapsed = 1
+	}
+	if km/(elapsed/3600) > gpsMaxSpeed() {
+		return "impossible speed since the previous ping"
+	}
+	return ""
+}
+
+func rejectGPSPing(driverUUID, shuttleUUID string, ping gpsPing, reason string) {
+	wsPingsRejected.Add(1)
+	logger.LogWarn("GPS ping rejected", map[string]interface{}{
+		"DriverUUID":  driverUUID,
+		"ShuttleUUID": shuttleUUID,
+		"Reason":      reason,
+		"Latitude":    ping.latitude,
+		"Longitude":   ping.longitude,
+		"RecordedAt":  ping.recordedAt,
+		"Mocked":      ping.mocked,
+	})
+}
+
+// Drivers that stopped sending are forgotten after an hour, called with the lock held
+func sweepGPSTracks() {
+	if time.Since(gpsTrackSweptAt) < 10*time.Minute {
+		return
+	}
+	for driverUUID, track := range gpsTracks {
+		if time.Since(track.updatedAt) > time.Hour {
+			delete(gpsTracks, driverUUID)
+		}
+	}
+	gpsTrackSweptAt = time.Now()
+}
+
+// Kalman filter on latitude and longitude with the variance kept in meters,
+// the process noise is how fast the position is expected to drift.
+type kalmanLatLong struct {
+	latitude   float64
+	longitude  float64
+	variance   float64
+	timestamp  time.Time
+	metersPerS float64
+}
+
+func newKalmanLatLong() kalmanLatLong {
+	return kalmanLatLong{variance: -1, metersPerS: 15}
+}
+
+func (k *kalmanLatLong) process(latitude, longitude, accuracy float64, timestamp time.Time) (float64, float64) {
+	if accuracy < 1 {
+		accuracy = 1
+	}
+
+	if k.variance < 0 {
+		k.latitude, k.longitude = latitude, longitude
+		k.variance = accuracy * accuracy
+		k.timestamp = timestamp
+		return latitude, longitude
+	}
+
+	if elapsed := timestamp.Sub(k.timestamp).Seconds(); elapsed > 0 {
+		k.variance += elapsed * k.metersPerS * k.metersPerS
+		k.timestamp = timestamp
+	}
+
+	gain := k.variance / (k.variance + accuracy*accuracy)
+	k.latitude += gain * (latitude - k.latitude)
+	k.longitude += gain * (longitude - k.longitude)
+	k.variance = (1 - gain) * k.variance
+
+	return k.latitude, k.longitude
+}
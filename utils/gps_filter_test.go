@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func floatPointer(value float64) *float64 {
+	return &value
+}
+
+func TestValidateGPSPing(t *testing.T) {
+	tests := []struct {
+		name   string
+		ping   gpsPing
+		reason string
+	}{
+		{"valid", gpsPing{latitude: -6.2, longitude: 106.8}, ""},
+		{"valid with every reading", gpsPing{latitude: -6.2, longitude: 106.8, speed: floatPointer(10), heading: floatPointer(90), accuracy: floatPointer(20)}, ""},
+		{"not a number", gpsPing{latitude: math.NaN(), longitude: 106.8}, "coordinates are not numbers"},
+		{"latitude out of range", gpsPing{latitude: 91, longitude: 106.8}, "coordinates out of range"},
+		{"longitude out of range", gpsPing{latitude: -6.2, longitude: -181}, "coordinates out of range"},
+		{"null island", gpsPing{}, "null island coordinates"},
+		{"mocked", gpsPing{latitude: -6.2, longitude: 106.8, mocked: true}, "mocked location"},
+		{"accuracy too low", gpsPing{latitude: -6.2, longitude: 106.8, accuracy: floatPointer(150)}, "accuracy too low"},
+		{"negative accuracy", gpsPing{latitude: -6.2, longitude: 106.8, accuracy: floatPointer(-1)}, "accuracy too low"},
+		{"speed above the limit", gpsPing{latitude: -6.2, longitude: 106.8, speed: floatPointer(50)}, "reported speed out of range"},
+		{"negative speed", gpsPing{latitude: -6.2, longitude: 106.8, speed: floatPointer(-1)}, "reported speed out of range"},
+		{"heading out of range", gpsPing{latitude: -6.2, longitude: 106.8, heading: floatPointer(361)}, "heading out of range"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if reason := validateGPSPing(test.ping); reason != test.reason {
+				t.Fatalf("expected %q, got %q", test.reason, reason)
+			}
+		})
+	}
+}
+
+func TestCheckGPSMovement(t *testing.T) {
+	start := time.Date(2026, 1, 5, 7, 0, 0, 0, time.UTC)
+	previous := gpsPing{latitude: -6.2, longitude: 106.8, recordedAt: start}
+
+	tests := []struct {
+		name   string
+		ping   gpsPing
+		reason string
+	}{
+		// About 111 meters in 10 seconds, 40 km/h
+		{"driving", gpsPing{latitude: -6.199, longitude: 106.8, recordedAt: start.Add(10 * time.Second)}, ""},
+		{"older than the previous ping", gpsPing{latitude: -6.2, longitude: 106.8, recordedAt: start.Add(-time.Second)}, "older than the previous ping"},
+		// About 11 km in 10 seconds
+		{"jump", gpsPing{latitude: -6.1, longitude: 106.8, recordedAt: start.Add(10 * time.Second)}, "impossible speed since the previous ping"},
+		// Same second is compared as one second, 111 meters is 400 km/h
+		{"jump within the same second", gpsPing{latitude: -6.199, longitude: 106.8, recordedAt: start}, "impossible speed since the previous ping"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if reason := checkGPSMovement(previous, test.ping); reason != test.reason {
+				t.Fatalf("expected %q, got %q", test.reason, reason)
+			}
+		})
+	}
+}
+
+func TestFilterGPSPingResetsAfterRepeatedOutliers(t *testing.T) {
+	driverUUID := "gps-filter-test-driver"
+	defer func() {
+		gpsTrackMutex.Lock()
+		delete(gpsTracks, driverUUID)
+		gpsTrackMutex.Unlock()
+	}()
+
+	start := time.Date(2026, 1, 5, 7, 0, 0, 0, time.UTC)
+	if _, _, _, reason := filterGPSPing(driverUUID, "", gpsPing{latitude: -6.2, longitude: 106.8, recordedAt: start}); reason != "" {
+		t.Fatalf("expected the first ping to be accepted, got %q", reason)
+	}
+
+	// The bus shows up 20 km further every second
+	far := gpsPing{latitude: -6.02, longitude: 106.8}
+	for i := 1; i <= gpsMaxRejectedInRow; i++ {
+		far.recordedAt = start.Add(time.Duration(i) * time.Second)
+		if _, _, _, reason := filterGPSPing(driverUUID, "", far); reason != "impossible speed since the previous ping" {
+			t.Fatalf("expected outlier %d to be rejected, got %q", i, reason)
+		}
+	}
+
+	far.recordedAt = start.Add(time.Duration(gpsMaxRejectedInRow+1) * time.Second)
+	latitude, longitude, _, reason := filterGPSPing(driverUUID, "", far)
+	if reason != "" {
+		t.Fatalf("expected the track to start over, got %q", reason)
+	}
+	if latitude != far.latitude || longitude != far.longitude {
+		t.Fatalf("expected the new track to start at %v,%v, got %v,%v", far.latitude, far.longitude, latitude, longitude)
+	}
+
+	// The new position is the reference from now on
+	far.recordedAt = far.recordedAt.Add(time.Second)
+	if _, _, _, reason := filterGPSPing(driverUUID, "", far); reason != "" {
+		t.Fatalf("expected a ping at the new position to be accepted, got %q", reason)
+	}
+}
+
+func TestKalmanLatLongConverges(t *testing.T) {
+	tests := []struct {
+		name     string
+		accuracy float64
+		interval time.Duration
+	}{
+		{"accurate pings", 5, time.Second},
+		{"inaccurate pings", 50, time.Second},
+		{"sparse pings", 15, 10 * time.Second},
+	}
+
+	targetLatitude, targetLongitude := -6.2, 106.8
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kalman := newKalmanLatLong()
+			timestamp := time.Date(2026, 1, 5, 7, 0, 0, 0, time.UTC)
+			kalman.process(targetLatitude+0.01, targetLongitude-0.01, test.accuracy, timestamp)
+
+			previousDistance := math.Inf(1)
+			for i := 0; i < 50; i++ {
+				timestamp = timestamp.Add(test.interval)
+				latitude, longitude := kalman.process(targetLatitude, targetLongitude, test.accuracy, timestamp)
+
+				distance := math.Hypot(latitude-targetLatitude, longitude-targetLongitude)
+				if distance > previousDistance {
+					t.Fatalf("ping %d moved away from the input, %v after %v", i, distance, previousDistance)
+				}
+				previousDistance = distance
+			}
+
+			if previousDistance > 1e-4 {
+				t.Fatalf("expected to end within 1e-4 degrees of the input, still %v away", previousDistance)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"shuttle/logger"
+
+	"github.com/spf13/viper"
+)
+
+// Tokens are signed and encrypted with the active key of each set and carry
+// its kid, so older keys keep validating until their retirement date.
+//
+// Without KEYRING_FILE the keyring holds a single "default" key taken from
+// JWT_SECRET and ENCRYPTION_KEY. Tokens issued before key IDs existed have no
+// kid and are always checked against the "default" key.
+//
+// Rotation without downtime:
+//  1. Add the new key to KEYRING_FILE, not active yet, and wait for every
+//     instance to reload it so they all accept it.
+//  2. Mark the new key active and the old one inactive.
+//  3. Give the old key a retire_at no earlier than the longest token lifetime
+//     from now, then remove it from the file once that date has passed.
+//
+// Encryption keys also protect TOTP secrets in the database. Those are moved
+// to the active key whenever they are used, a user who doesn't sign in
+// before an old encryption key retires has to have their 2FA reset.
+const legacyKeyID = "default"
+
+type keyringKey struct {
+	KID      string     `json:"kid"`
+	Secret   string     `json:"secret"`
+	Active   bool       `json:"active"`
+	RetireAt *time.Time `json:"retire_at"`
+}
+
+type keyringFile struct {
+	SigningKeys    []keyringKey `json:"signing_keys"`
+	EncryptionKeys []keyringKey `json:"encryption_keys"`
+}
+
+type keySet struct {
+	activeKID string
+	keys      map[string]keyringKey
+}
+
+type tokenKeyring struct {
+	path       string
+	modTime    time.Time
+	signing    keySet
+	encryption keySet
+	mutex      sync.RWMutex
+}
+
+var keyring *tokenKeyring
+
+func newTokenKeyring(path string) (*tokenKeyring, error) {
+	k := &tokenKeyring{path: path}
+
+	if path == "" {
+		file := keyringFile{
+			SigningKeys:    []keyringKey{{KID: legacyKeyID, Secret: viper.GetString("JWT_SECRET"), Active: true}},
+			EncryptionKeys: []keyringKey{{KID: legacyKeyID, Secret: viper.GetString("ENCRYPTION_KEY"), Active: true}},
+		}
+		if err := k.apply(file); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (k *tokenKeyring) reload() error {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("keyring: invalid file: %w", err)
+	}
+
+	if err := k.apply(file); err != nil {
+		return err
+	}
+
+	k.mutex.Lock()
+	k.modTime = info.ModTime()
+	k.mutex.Unlock()
+
+	return nil
+}
+
+func (k *tokenKeyring) apply(file keyringFile) error {
+	signing, err := buildKeySet("signing", file.SigningKeys, func(key keyringKey) error {
+		if key.Secret == "" {
+			return errors.New("secret is empty")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	encryption, err := buildKeySet("encryption", file.EncryptionKeys, func(key keyringKey) error {
+		if l := len(key.Secret); l != 16 && l != 24 && l != 32 {
+			return errors.New("key must be 16, 24 or 32 bytes")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	k.mutex.Lock()
+	k.signing = signing
+	k.encryption = encryption
+	k.mutex.Unlock()
+
+	return nil
+}
+
+func buildKeySet(name string, keys []keyringKey, validate func(keyringKey) error) (keySet, error) {
+	set := keySet{keys: make(map[string]keyringKey)}
+
+	for _, key := range keys {
+		if key.KID == "" {
+			return keySet{}, fmt.Errorf("keyring: %s key without kid", name)
+		}
+		if _, exists := set.keys[key.KID]; exists {
+			return keySet{}, fmt.Errorf("keyring: duplicate %s kid %q", name, key.KID)
+		}
+		if err := validate(key); err != nil {
+			return keySet{}, fmt.Errorf("keyring: %s key %q: %w", name, key.KID, err)
+		}
+
+		if key.Active {
+			if set.activeKID != "" {
+				return keySet{}, fmt.Errorf("keyring: more than one active %s key", name)
+			}
+			if key.RetireAt != nil && key.RetireAt.Before(time.Now()) {
+				return keySet{}, fmt.Errorf("keyring: active %s key %q is retired", name, key.KID)
+			}
+			set.activeKID = key.KID
+		}
+
+		set.keys[key.KID] = key
+	}
+
+	if set.activeKID == "" {
+		return keySet{}, fmt.Errorf("keyring: no active %s key", name)
+	}
+
+	return set, nil
+}
+
+func (k *tokenKeyring) activeKey(set *keySet) (string, []byte) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return set.activeKID, []byte(set.keys[set.activeKID].Secret)
+}
+
+func (k *tokenKeyring) key(set *keySet, kid string) ([]byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	key, found := set.keys[kid]
+	if !found {
+		return nil, fmt.Errorf("keyring: unknown kid %q", kid)
+	}
+	if key.RetireAt != nil && key.RetireAt.Before(time.Now()) {
+		return nil, fmt.Errorf("keyring: kid %q is retired", kid)
+	}
+
+	return []byte(key.Secret), nil
+}
+
+func (k *tokenKeyring) activeSigningKey() (string, []byte) {
+	return k.activeKey(&k.signing)
+}
+
+func (k *tokenKeyring) signingKey(kid string) ([]byte, error) {
+	return k.key(&k.signing, kid)
+}
+
+func (k *tokenKeyring) activeEncryptionKey() (string, []byte) {
+	return k.activeKey(&k.encryption)
+}
+
+func (k *tokenKeyring) encryptionKey(kid string) ([]byte, error) {
+	return k.key(&k.encryption, kid)
+}
+
+func (k *tokenKeyring) changed() bool {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return false
+	}
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return !info.ModTime().Equal(k.modTime)
+}
+
+// Pick up edits to KEYRING_FILE, a broken file keeps the previous keys
+func StartKeyringReloader() {
+	if keyring.path == "" {
+		return
+	}
+
+	interval := viper.GetDuration("KEYRING_RELOAD_INTERVAL")
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !keyring.changed() {
+				continue
+			}
+
+			if err := keyring.reload(); err != nil {
+				logger.LogError(err, "Failed to reload keyring, keeping previous keys", map[string]interface{}{
+					"path": keyring.path,
+				})
+				continue
+			}
+
+			logger.LogInfo("Keyring reloaded", map[string]interface{}{
+				"path": keyring.path,
+			})
+		}
+	}()
+}
+
+// Encrypts secrets stored in the database, such as TOTP secrets, with the
+// same rotating keys as the tokens
+type KeyringSecretCipher struct{}
+
+func NewKeyringSecretCipher() KeyringSecretCipher {
+	return KeyringSecretCipher{}
+}
+
+func (KeyringSecretCipher) EncryptSecret(secret string) (string, error) {
+	return encryptToken(secret)
+}
+
+func (KeyringSecretCipher) DecryptSecret(encryptedSecret string) (string, error) {
+	return decryptToken(encryptedSecret)
+}
+
+func (KeyringSecretCipher) IsCurrentSecret(encryptedSecret string) bool {
+	kid, _ := keyring.activeEncryptionKey()
+	return strings.HasPrefix(encryptedSecret, kid+".")
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeKeyringFile(t *testing.T, path string, file keyringFile) {
+	t.Helper()
+
+	content, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyringAcceptsTokensOfThePreviousKey(t *testing.T) {
+	previous := keyring
+	defer func() { keyring = previous }()
+
+	oldSigning := keyringKey{KID: "2026-01", Secret: "old-signing-secret"}
+	oldEncryption := keyringKey{KID: "2026-01", Secret: "0123456789abcdef0123456789abcdef"}
+	newSigning := keyringKey{KID: "2026-02", Secret: "new-signing-secret", Active: true}
+	newEncryption := keyringKey{KID: "2026-02", Secret: "fedcba9876543210fedcba9876543210", Active: true}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	retire := func(key keyringKey, at time.Time) keyringKey {
+		key.RetireAt = &at
+		return key
+	}
+
+	tests := []struct {
+		name     string
+		rotated  keyringFile
+		accepted bool
+	}{
+		{"old keys inactive", keyringFile{
+			SigningKeys:    []keyringKey{oldSigning, newSigning},
+			EncryptionKeys: []keyringKey{oldEncryption, newEncryption},
+		}, true},
+		{"old keys retiring later", keyringFile{
+			SigningKeys:    []keyringKey{retire(oldSigning, future), newSigning},
+			EncryptionKeys: []keyringKey{retire(oldEncryption, future), newEncryption},
+		}, true},
+		{"old keys retired", keyringFile{
+			SigningKeys:    []keyringKey{retire(oldSigning, past), newSigning},
+			EncryptionKeys: []keyringKey{retire(oldEncryption, past), newEncryption},
+		}, false},
+		{"old signing key retired", keyringFile{
+			SigningKeys:    []keyringKey{retire(oldSigning, past), newSigning},
+			EncryptionKeys: []keyringKey{oldEncryption, newEncryption},
+		}, false},
+		{"old keys removed", keyringFile{
+			SigningKeys:    []keyringKey{newSigning},
+			EncryptionKeys: []keyringKey{newEncryption},
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keyring.json")
+
+			activeSigning, activeEncryption := oldSigning, oldEncryption
+			activeSigning.Active, activeEncryption.Active = true, true
+			writeKeyringFile(t, path, keyringFile{
+				SigningKeys:    []keyringKey{activeSigning},
+				EncryptionKeys: []keyringKey{activeEncryption},
+			})
+
+			var err error
+			if keyring, err = newTokenKeyring(path); err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := GenerateToken("1", "user-uuid", "driver", "D", "session-uuid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(token, "2026-01.") {
+				t.Fatalf("expected the token to carry kid 2026-01, got %s", token)
+			}
+
+			writeKeyringFile(t, path, test.rotated)
+			if err := keyring.reload(); err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := ValidateToken(token)
+			if test.accepted {
+				if err != nil {
+					t.Fatalf("expected the token to stay valid, got %v", err)
+				}
+				if claims["user_uuid"] != "user-uuid" || claims["sid"] != "session-uuid" {
+					t.Fatalf("unexpected claims %v", claims)
+				}
+			} else if err == nil {
+				t.Fatal("expected the token to be rejected")
+			}
+
+			rotatedToken, err := GenerateToken("1", "user-uuid", "driver", "D", "session-uuid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(rotatedToken, "2026-02.") {
+				t.Fatalf("expected new tokens to carry kid 2026-02, got %s", rotatedToken)
+			}
+			if _, err := ValidateToken(rotatedToken); err != nil {
+				t.Fatalf("expected a token of the new key to be valid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyringRejectsInvalidFiles(t *testing.T) {
+	signing := keyringKey{KID: "2026-01", Secret: "signing-secret", Active: true}
+	encryption := keyringKey{KID: "2026-01", Secret: "0123456789abcdef", Active: true}
+	retired := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		file keyringFile
+	}{
+		{"no active signing key", keyringFile{
+			SigningKeys:    []keyringKey{{KID: "2026-01", Secret: "signing-secret"}},
+			EncryptionKeys: []keyringKey{encryption},
+		}},
+		{"two active encryption keys", keyringFile{
+			SigningKeys:    []keyringKey{signing},
+			EncryptionKeys: []keyringKey{encryption, {KID: "2026-02", Secret: "fedcba9876543210", Active: true}},
+		}},
+		{"duplicate kid", keyringFile{
+			SigningKeys:    []keyringKey{signing, {KID: "2026-01", Secret: "other-secret"}},
+			EncryptionKeys: []keyringKey{encryption},
+		}},
+		{"key without kid", keyringFile{
+			SigningKeys:    []keyringKey{signing, {Secret: "other-secret"}},
+			EncryptionKeys: []keyringKey{encryption},
+		}},
+		{"encryption key of the wrong size", keyringFile{
+			SigningKeys:    []keyringKey{signing},
+			EncryptionKeys: []keyringKey{{KID: "2026-01", Secret: "too-short", Active: true}},
+		}},
+		{"active key retired", keyringFile{
+			SigningKeys:    []keyringKey{{KID: "2026-01", Secret: "signing-secret", Active: true, RetireAt: &retired}},
+			EncryptionKeys: []keyringKey{encryption},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keyring.json")
+			writeKeyringFile(t, path, test.file)
+
+			if _, err := newTokenKeyring(path); err == nil {
+				t.Fatal("expected the keyring file to be rejected")
+			}
+		})
+	}
+}
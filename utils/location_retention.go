@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"time"
+
+	"shuttle/logger"
+	"shuttle/repositories"
+
+	"github.com/spf13/viper"
+)
+
+// Pings are deleted in batches so the purge never holds many rows locked
+const locationPurgeBatchSize = 5000
+
+func locationRetention() time.Duration {
+	if retention := viper.GetDuration("SHUTTLE_LOCATION_RETENTION"); retention > 0 {
+		return retention
+	}
+	return 30 * 24 * time.Hour
+}
+
+// Periodically deletes the location history older than SHUTTLE_LOCATION_RETENTION
+func StartLocationHistoryPurge() {
+	interval := viper.GetDuration("SHUTTLE_LOCATION_PURGE_INTERVAL")
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	locationRepository := repositories.NewLocationRepository(db)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purgeLocationHistory(locationRepository)
+		}
+	}()
+}
+
+func purgeLocationHistory(locationRepository repositories.LocationRepositoryInterface) {
+	before := time.Now().Add(-locationRetention())
+
+	var purged int64
+	for {
+		deleted, err := locationRepository.DeleteLocationsBefore(before, locationPurgeBatchSize)
+		if err != nil {
+			logger.LogError(err, "Failed to purge the location history", map[string]interface{}{"Before": before})
+			return
+		}
+		purged += deleted
+		if deleted < locationPurgeBatchSize {
+			break
+		}
+	}
+
+	if purged > 0 {
+		logger.LogInfo("Location History Purged", map[string]interface{}{"Before": before, "Deleted": purged})
+	}
+}
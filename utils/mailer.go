@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"shuttle/logger"
+
+	"github.com/spf13/viper"
+)
+
+// Mailer delivers plain-text emails. MAIL_DRIVER picks the implementation:
+// "smtp" for real delivery, anything else writes the mail to the log
+// (and to MAIL_LOG_FILE when set) for local testing.
+type Mailer interface {
+	SendMail(to, subject, body string) error
+}
+
+func NewMailer() Mailer {
+	switch viper.GetString("MAIL_DRIVER") {
+	case "smtp":
+		return &smtpMailer{
+			host:     viper.GetString("SMTP_HOST"),
+			port:     viper.GetString("SMTP_PORT"),
+			username: viper.GetString("SMTP_USERNAME"),
+			password: viper.GetString("SMTP_PASSWORD"),
+			from:     viper.GetString("MAIL_FROM"),
+		}
+	default:
+		return &logMailer{
+			filePath: viper.GetString("MAIL_LOG_FILE"),
+		}
+	}
+}
+
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func (m *smtpMailer) SendMail(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"UTF-8\"",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(m.host+":"+m.port, auth, m.from, []string{to}, []byte(message))
+}
+
+type logMailer struct {
+	filePath string
+	mutex    sync.Mutex
+}
+
+func (m *logMailer) SendMail(to, subject, body string) error {
+	logger.LogInfo("Mail sent to log", map[string]interface{}{
+		"to":      to,
+		"subject": subject,
+	})
+
+	if m.filePath == "" {
+		logger.LogDebug("Mail body", map[string]interface{}{"body": body})
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	file, err := os.OpenFile(m.filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), to, subject, body)
+	return err
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/repositories"
+
+	"github.com/google/uuid"
+)
+
+// The latest location of every shuttle, so parents joining mid-trip see the
+// bus straight away instead of waiting for the next ping. Each node fills it
+// from the broadcasts it sees, locally or through the backplane, and falls
+// back to the location history after a restart.
+const positionMaxAge = 24 * time.Hour
+
+var (
+	lastPositions       = make(map[string]dto.RealtimeLocationPayload)
+	lastPositionMutex   = &sync.RWMutex{}
+	lastPositionSweptAt = time.Now()
+)
+
+func rememberPosition(payload dto.RealtimeLocationPayload) {
+	recordedAt, err := time.Parse(time.RFC3339, payload.RecordedAt)
+	if err != nil {
+		return
+	}
+
+	payload.AgeSeconds = nil
+	payload.Snapshot = false
+
+	lastPositionMutex.Lock()
+	defer lastPositionMutex.Unlock()
+
+	if current, exists := lastPositions[payload.ShuttleUUID]; exists {
+		if currentAt, err := time.Parse(time.RFC3339, current.RecordedAt); err == nil && currentAt.After(recordedAt) {
+			return
+		}
+	}
+	lastPositions[payload.ShuttleUUID] = payload
+
+	// Shuttles are created per trip, old ones are dropped now and then
+	if time.Since(lastPositionSweptAt) > 10*time.Minute {
+		for shuttleUUID, position := range lastPositions {
+			if positionAt, err := time.Parse(time.RFC3339, position.RecordedAt); err != nil || time.Since(positionAt) > positionMaxAge {
+				delete(lastPositions, shuttleUUID)
+			}
+		}
+		lastPositionSweptAt = time.Now()
+	}
+}
+
+// Returns the latest location of the shuttle with its age, or false when none
+// was sent within the last 24 hours
+func LastKnownPosition(shuttleUUID string) (dto.RealtimeLocationPayload, bool) {
+	lastPositionMutex.RLock()
+	position, exists := lastPositions[shuttleUUID]
+	lastPositionMutex.RUnlock()
+
+	if !exists {
+		parsedShuttleUUID, err := uuid.Parse(shuttleUUID)
+		if err != nil {
+			return dto.RealtimeLocationPayload{}, false
+		}
+
+		location, err := repositories.NewLocationRepository(db).FetchLastShuttleLocation(parsedShuttleUUID, time.Now().Add(-positionMaxAge))
+		if err != nil {
+			if err != sql.ErrNoRows {
+				logger.LogError(err, "Failed to fetch last shuttle location", map[string]interface{}{"ShuttleUUID": shuttleUUID})
+			}
+			return dto.RealtimeLocationPayload{}, false
+		}
+
+		position = dto.RealtimeLocationPayload{
+			ShuttleUUID: location.ShuttleUUID.String(),
+			DriverUUID:  location.DriverUUID.String(),
+			Latitude:    location.Latitude,
+			Longitude:   location.Longitude,
+			RecordedAt:  location.RecordedAt.Format(time.RFC3339),
+		}
+		if location.Speed.Valid {
+			position.Speed = &location.Speed.Float64
+		}
+		if location.Heading.Valid {
+			position.Heading = &location.Heading.Float64
+		}
+		rememberPosition(position)
+	}
+
+	recordedAt, err := time.Parse(time.RFC3339, position.RecordedAt)
+	if err != nil || time.Since(recordedAt) > positionMaxAge {
+		return dto.RealtimeLocationPayload{}, false
+	}
+
+	age := int64(time.Since(recordedAt).Seconds())
+	position.AgeSeconds = &age
+	position.Snapshot = true
+	return position, true
+}
@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/models/entity"
+	"shuttle/repositories"
+
+	"github.com/spf13/viper"
+)
+
+// Driver presence is kept in users.user_status and user_last_active, driven by
+// the driver's websocket: online while locations come in, idle when still
+// connected but quiet for DRIVER_IDLE_AFTER. The driver may be connected to
+// several nodes, so none of them decides offline alone: each one refreshes
+// driver_presence for the drivers it holds, and whichever node sweeps first
+// marks a driver offline once nobody refreshed it for DRIVER_OFFLINE_AFTER.
+const (
+	PresenceOnline  = "online"
+	PresenceIdle    = "idle"
+	PresenceOffline = "offline"
+)
+
+// user_last_active is only rewritten this often while the driver stays online
+const presenceWriteInterval = 30 * time.Second
+
+type driverPresence struct {
+	connections   int
+	status        string
+	lastActiveAt  time.Time
+	lastWrittenAt time.Time
+}
+
+type driverPresenceTracker struct {
+	authRepository     repositories.AuthRepositoryInterface
+	locationRepository repositories.LocationRepositoryInterface
+	drivers            map[string]*driverPresence
+	mutex              sync.Mutex
+}
+
+var presenceTracker *driverPresenceTracker
+
+func driverIdleAfter() time.Duration {
+	if idleAfter := viper.GetDuration("DRIVER_IDLE_AFTER"); idleAfter > 0 {
+		return idleAfter
+	}
+	return 2 * time.Minute
+}
+
+func driverOfflineAfter() time.Duration {
+	if offlineAfter := viper.GetDuration("DRIVER_OFFLINE_AFTER"); offlineAfter > 0 {
+		return offlineAfter
+	}
+	return time.Minute
+}
+
+func driverSilentAlertAfter() time.Duration {
+	if silentAfter := viper.GetDuration("DRIVER_SILENT_ALERT_AFTER"); silentAfter > 0 {
+		return silentAfter
+	}
+	return 5 * time.Minute
+}
+
+// Tracks driver presence and periodically looks for drivers on an active trip
+// that went silent, to alert the parents and the school admins
+func StartDriverPresenceMonitor() {
+	presenceTracker = &driverPresenceTracker{
+		authRepository:     repositories.NewAuthRepository(db),
+		locationRepository: repositories.NewLocationRepository(db),
+		drivers:            make(map[string]*driverPresence),
+	}
+
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			presenceTracker.refreshPresence()
+			presenceTracker.markIdleDrivers()
+			presenceTracker.alertSilentTrips()
+		}
+	}()
+}
+
+func markDriverConnected(userUUID string) {
+	if presenceTracker == nil {
+		return
+	}
+
+	now := time.Now()
+	presenceTracker.mutex.Lock()
+	driver, exists := presenceTracker.drivers[userUUID]
+	if !exists {
+		driver = &driverPresence{status: PresenceOffline}
+		presenceTracker.drivers[userUUID] = driver
+	}
+	driver.connections++
+	driver.lastActiveAt = now
+	changed := driver.status != PresenceOnline
+	driver.status = PresenceOnline
+	if changed {
+		driver.lastWrittenAt = now
+	}
+	presenceTracker.mutex.Unlock()
+
+	// Refreshed before going online so a sweep in between can't take it back
+	if err := presenceTracker.authRepository.RefreshDriverPresence([]string{userUUID}, now); err != nil {
+		logger.LogError(err, "Failed to refresh driver presence", map[string]interface{}{"UserUUID": userUUID})
+	}
+	if changed {
+		presenceTracker.writeStatus(userUUID, PresenceOnline, now)
+	}
+}
+
+func markDriverActive(userUUID string) {
+	if presenceTracker == nil {
+		return
+	}
+
+	now := time.Now()
+	presenceTracker.mutex.Lock()
+	driver, exists := presenceTracker.drivers[userUUID]
+	if !exists {
+		presenceTracker.mutex.Unlock()
+		return
+	}
+	driver.lastActiveAt = now
+	write := driver.status != PresenceOnline || now.Sub(driver.lastWrittenAt) >= presenceWriteInterval
+	driver.status = PresenceOnline
+	if write {
+		driver.lastWrittenAt = now
+	}
+	presenceTracker.mutex.Unlock()
+
+	if write {
+		presenceTracker.writeStatus(userUUID, PresenceOnline, now)
+	}
+}
+
+func markDriverDisconnected(userUUID string) {
+	if presenceTracker == nil {
+		return
+	}
+
+	presenceTracker.mutex.Lock()
+	driver, exists := presenceTracker.drivers[userUUID]
+	if !exists {
+		presenceTracker.mutex.Unlock()
+		return
+	}
+	// Once nothing refreshes the driver, the sweep marks them offline
+	driver.connections--
+	if driver.connections <= 0 {
+		delete(presenceTracker.drivers, userUUID)
+	}
+	presenceTracker.mutex.Unlock()
+}
+
+func (tracker *driverPresenceTracker) refreshPresence() {
+	now := time.Now()
+
+	tracker.mutex.Lock()
+	connected := make([]string, 0, len(tracker.drivers))
+	for userUUID := range tracker.drivers {
+		connected = append(connected, userUUID)
+	}
+	tracker.mutex.Unlock()
+
+	if len(connected) > 0 {
+		if err := tracker.authRepository.RefreshDriverPresence(connected, now); err != nil {
+			logger.LogError(err, "Failed to refresh driver presence", nil)
+		}
+	}
+	if err := tracker.authRepository.MarkStaleDriversOffline(now.Add(-driverOfflineAfter())); err != nil {
+		logger.LogError(err, "Failed to mark stale drivers offline", nil)
+	}
+}
+
+func (tracker *driverPresenceTracker) markIdleDrivers() {
+	idleSince := time.Now().Add(-driverIdleAfter())
+
+	idle := make(map[string]time.Time)
+	tracker.mutex.Lock()
+	for userUUID, driver := range tracker.drivers {
+		if driver.status == PresenceOnline && driver.lastActiveAt.Before(idleSince) {
+			driver.status = PresenceIdle
+			idle[userUUID] = driver.lastActiveAt
+		}
+	}
+	tracker.mutex.Unlock()
+
+	for userUUID, lastActiveAt := range idle {
+		if err := tracker.authRepository.MarkDriverIdle(userUUID, lastActiveAt); err != nil {
+			logger.LogError(err, "Failed to update driver presence", map[string]interface{}{"UserUUID": userUUID, "Status": PresenceIdle})
+		}
+	}
+}
+
+func (tracker *driverPresenceTracker) writeStatus(userUUID, status string, lastActive time.Time) {
+	if err := tracker.authRepository.UpdateUserStatus(userUUID, status, lastActive); err != nil {
+		logger.LogError(err, "Failed to update driver presence", map[string]interface{}{"UserUUID": userUUID, "Status": status})
+	}
+}
+
+func (tracker *driverPresenceTracker) alertSilentTrips() {
+	trips, err := tracker.locationRepository.ClaimSilentTrips(time.Now().Add(-driverSilentAlertAfter()))
+	if err != nil {
+		logger.LogError(err, "Failed to check silent drivers", nil)
+		return
+	}
+
+	// A driver carries several students, the school admins hear about them once
+	alertedDrivers := make(map[string]bool)
+	for _, trip := range trips {
+		lastSeen := trip.LastSeenAt.Format("15:04")
+
+		logger.LogWarn("Driver on an active trip went silent", map[string]interface{}{
+			"ShuttleUUID": trip.ShuttleUUID.String(),
+			"DriverUUID":  trip.DriverUUID.String(),
+			"LastSeenAt":  trip.LastSeenAt,
+		})
+
+		if err := SendPushMessage(trip.ParentUUID.String(), "Shuttle Location Unavailable",
+			fmt.Sprintf("We haven't received the shuttle's location since %s. The school has been notified.", lastSeen)); err != nil {
+			logger.LogWarn("Failed to send notification to parent", map[string]interface{}{
+				"error":       err.Error(),
+				"shuttleUUID": trip.ShuttleUUID.String(),
+				"parentUUID":  trip.ParentUUID.String(),
+			})
+		}
+
+		announcement := dto.RealtimeAnnouncementPayload{
+			ShuttleUUID: trip.ShuttleUUID.String(),
+			Message:     fmt.Sprintf("The driver's location hasn't been updated since %s.", lastSeen),
+			SentAt:      time.Now().Format(time.RFC3339),
+		}
+		PublishRealtimeMessage(trip.ShuttleUUID.String(), dto.RealtimeTypeAnnouncement, announcement)
+		PublishSchoolMessage(trip.SchoolUUID.String(), dto.RealtimeTypeAnnouncement, "", announcement)
+
+		driverKey := trip.SchoolUUID.String() + "/" + trip.DriverUUID.String()
+		if alertedDrivers[driverKey] {
+			continue
+		}
+		alertedDrivers[driverKey] = true
+		tracker.alertSchoolAdmins(trip)
+	}
+}
+
+func (tracker *driverPresenceTracker) alertSchoolAdmins(trip entity.SilentTrip) {
+	adminUUIDs, err := tracker.locationRepository.FetchSchoolAdminUUIDs(trip.SchoolUUID)
+	if err != nil {
+		logger.LogError(err, "Failed to fetch school admins", map[string]interface{}{"SchoolUUID": trip.SchoolUUID.String()})
+		return
+	}
+
+	body := fmt.Sprintf("Driver %s is on an active trip but hasn't sent a location since %s.", trip.DriverName, trip.LastSeenAt.Format("15:04"))
+	for _, adminUUID := range adminUUIDs {
+		if err := SendPushMessage(adminUUID.String(), "Driver Not Responding", body); err != nil {
+			logger.LogWarn("Failed to send notification to school admin", map[string]interface{}{
+				"error":      err.Error(),
+				"driverUUID": trip.DriverUUID.String(),
+				"adminUUID":  adminUUID.String(),
+			})
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"shuttle/logger"
+	"shuttle/models/entity"
+	"shuttle/repositories"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// Revoked tokens and sessions are stored in Postgres so every instance sees them and they
+// survive restarts. The cache only saves a database round trip per request:
+// revoked entries are kept until the token expires, not-revoked entries are
+// re-checked after a short TTL so revocations from other nodes are picked up.
+type revocationCacheEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+type tokenRevocationStore struct {
+	tokenRepository repositories.TokenRepositoryInterface
+	cache           map[string]revocationCacheEntry
+	cacheMutex      sync.RWMutex
+	negativeTTL     time.Duration
+}
+
+var revocationStore *tokenRevocationStore
+
+func newTokenRevocationStore(tokenRepository repositories.TokenRepositoryInterface) *tokenRevocationStore {
+	negativeTTL := viper.GetDuration("TOKEN_REVOCATION_CACHE_TTL")
+	if negativeTTL <= 0 {
+		negativeTTL = 15 * time.Second
+	}
+
+	return &tokenRevocationStore{
+		tokenRepository: tokenRepository,
+		cache:           make(map[string]revocationCacheEntry),
+		negativeTTL:     negativeTTL,
+	}
+}
+
+func (s *tokenRevocationStore) revoke(jti string, userUUID uuid.UUID, expiredAt time.Time) error {
+	err := s.tokenRepository.SaveRevokedToken(entity.RevokedToken{
+		JTI:       jti,
+		UserUUID:  userUUID,
+		ExpiredAt: expiredAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.cacheMutex.Lock()
+	s.cache[jti] = revocationCacheEntry{revoked: true, expiresAt: expiredAt}
+	s.cacheMutex.Unlock()
+
+	return nil
+}
+
+func (s *tokenRevocationStore) isRevoked(jti string, tokenExpiresAt time.Time) (bool, error) {
+	now := time.Now()
+
+	s.cacheMutex.RLock()
+	entry, found := s.cache[jti]
+	s.cacheMutex.RUnlock()
+	if found && now.Before(entry.expiresAt) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := s.tokenRepository.IsTokenRevoked(jti)
+	if err != nil {
+		return false, err
+	}
+
+	// Revoked entries only need to live as long as the token itself
+	expiresAt := now.Add(s.negativeTTL)
+	if revoked {
+		expiresAt = tokenExpiresAt
+	}
+
+	s.cacheMutex.Lock()
+	s.cache[jti] = revocationCacheEntry{revoked: revoked, expiresAt: expiresAt}
+	s.cacheMutex.Unlock()
+
+	return revoked, nil
+}
+
+func (s *tokenRevocationStore) sweep() {
+	deleted, err := s.tokenRepository.DeleteExpiredRevokedTokens()
+	if err != nil {
+		logger.LogError(err, "Failed to prune revoked tokens", nil)
+	} else if deleted > 0 {
+		logger.LogInfo("Pruned revoked tokens", map[string]interface{}{"deleted": deleted})
+	}
+
+	now := time.Now()
+	s.cacheMutex.Lock()
+	for jti, entry := range s.cache {
+		if !now.Before(entry.expiresAt) {
+			delete(s.cache, jti)
+		}
+	}
+	s.cacheMutex.Unlock()
+}
+
+// Revoke an access or refresh token until its own expiration time
+func InvalidateToken(token string) error {
+	const bearerPrefix = "Bearer "
+	if len(token) > len(bearerPrefix) && token[:len(bearerPrefix)] == bearerPrefix {
+		token = token[len(bearerPrefix):]
+	}
+
+	claims, err := ValidateToken(token)
+	if err != nil {
+		return err
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return errors.New("token does not contain a jti claim")
+	}
+
+	userUUID, err := uuid.Parse(claimString(claims, "user_uuid"))
+	if err != nil {
+		return err
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token does not contain an exp claim")
+	}
+
+	return revocationStore.revoke(jti, userUUID, time.Unix(int64(exp), 0))
+}
+
+// Revoke every access token issued for a session. Refresh tokens of the
+// session are revoked in the database, so only access tokens need covering.
+func InvalidateSession(sessionUUID, userUUID uuid.UUID) error {
+	return revocationStore.revoke(sessionUUID.String(), userUUID, time.Now().Add(accessTokenLifetime))
+}
+
+// A token is revoked when either the token itself or its session was revoked
+func IsTokenRevoked(claims jwt.MapClaims) (bool, error) {
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return false, errors.New("token does not contain a jti claim")
+	}
+
+	sid, ok := claims["sid"].(string)
+	if !ok || sid == "" {
+		return false, errors.New("token does not contain a sid claim")
+	}
+
+	exp, _ := claims["exp"].(float64)
+	tokenExpiresAt := time.Unix(int64(exp), 0)
+
+	revoked, err := revocationStore.isRevoked(jti, tokenExpiresAt)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	return revocationStore.isRevoked(sid, tokenExpiresAt)
+}
+
+// Periodically delete revocations whose tokens have already expired
+func StartRevokedTokenSweeper() {
+	interval := viper.GetDuration("TOKEN_REVOCATION_SWEEP_INTERVAL")
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			revocationStore.sweep()
+		}
+	}()
+}
+
+func claimString(claims jwt.MapClaims, key string) string {
+	value, _ := claims[key].(string)
+	return value
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"io"
+	"strings"
 	"time"
 
 	"shuttle/databases"
@@ -20,75 +21,132 @@ import (
 	"github.com/spf13/viper"
 )
 
-var jwtSecret []byte
-var encryptionKey []byte
+const (
+	accessTokenLifetime  = time.Hour * 6
+	refreshTokenLifetime = time.Hour * 24 * 15
+	preAuthTokenLifetime = time.Minute * 5
+
+	preAuthTokenType = "pre_auth"
+)
+
 var db *sqlx.DB
 
-func init() {
+// Loads the settings, the token keyring and the database connection the rest
+// of this package works with. Called first thing by main, before any token is
+// issued or checked.
+func Init() {
 	viper.SetConfigFile(".env")
 	err := viper.ReadInConfig()
 	if err != nil {
 		panic(err)
 	}
 
-	jwtSecret = []byte(viper.GetString("JWT_SECRET"))
-	encryptionKey = []byte(viper.GetString("ENCRYPTION_KEY"))
+	keyring, err = newTokenKeyring(viper.GetString("KEYRING_FILE"))
+	if err != nil {
+		panic(err)
+	}
 
 	db, err = databases.PostgresConnection()
 	if err != nil {
 		panic(err)
 	}
+
+	revocationStore = newTokenRevocationStore(repositories.NewTokenRepository(db))
+}
+
+// Signed Access Token, sid ties it to the device session it was issued for
+func GenerateToken(userID, userUUID, username, role_code, sessionUUID string) (string, error) {
+	return signToken(jwt.MapClaims{
+		"jti":       uuid.New().String(),
+		"sid":       sessionUUID,
+		"sub":       userID,
+		"user_uuid": userUUID,
+		"user_name": username,
+		"role_code": role_code,
+		"exp":       time.Now().Add(accessTokenLifetime).Unix(), // 6 hours expiration
+	})
+}
+
+// Same, but with 15 days expiration time and for reissuing access token
+func GenerateRefreshToken(userID, userUUID, username, role_code, sessionUUID string) (string, error) {
+
+	return signToken(jwt.MapClaims{
+		"jti":       uuid.New().String(),
+		"sid":       sessionUUID,
+		"sub":       userID,
+		"user_uuid": userUUID,
+		"user_name": username,
+		"role_code": role_code,
+		"exp":       time.Now().Add(refreshTokenLifetime).Unix(), // 15 days expiration
+	})
 }
 
-// Signed Access Token
-func GenerateToken(userID, userUUID, username, role_code string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// Issued after the password check when the account needs a second factor.
+// It has no sid, so it is never accepted where an access token is expected.
+func GeneratePreAuthToken(userID, userUUID, username, role_code, email string) (string, error) {
+	return signToken(jwt.MapClaims{
+		"jti":       uuid.New().String(),
+		"typ":       preAuthTokenType,
 		"sub":       userID,
 		"user_uuid": userUUID,
 		"user_name": username,
 		"role_code": role_code,
-		"exp":       time.Now().Add(time.Hour * 6).Unix(), // 2 hours expiration
+		"email":     email,
+		"exp":       time.Now().Add(preAuthTokenLifetime).Unix(), // 5 minutes expiration
 	})
+}
 
-	signedToken, err := token.SignedString(jwtSecret)
+func ValidatePreAuthToken(encryptedToken string) (jwt.MapClaims, error) {
+	claims, err := ValidateToken(encryptedToken)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	encryptedToken, err := encryptToken(signedToken)
+	if claimString(claims, "typ") != preAuthTokenType {
+		return nil, errors.New("token is not a pre-auth token")
+	}
+
+	jti := claimString(claims, "jti")
+	if jti == "" {
+		return nil, errors.New("token does not contain a jti claim")
+	}
+
+	exp, _ := claims["exp"].(float64)
+	revoked, err := revocationStore.isRevoked(jti, time.Unix(int64(exp), 0))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.New("pre-auth token has already been used")
 	}
 
-	return encryptedToken, nil
+	return claims, nil
 }
 
-// Same, but with 15 days expiration time and for reissuing access token
-func GenerateRefreshToken(userID, userUUID, username, role_code string) (string, error) {
+// Sign with the active signing key and encrypt with the active encryption key
+func signToken(claims jwt.MapClaims) (string, error) {
+	kid, secret := keyring.activeSigningKey()
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":       userID,
-		"user_uuid": userUUID,
-		"user_name": username,
-		"role_code": role_code,
-		"exp":       time.Now().Add(time.Hour * 24 * 15).Unix(), // 15 days expiration
-	})
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
 
-	signedRefreshToken, err := refreshToken.SignedString(jwtSecret)
+	signedToken, err := token.SignedString(secret)
 	if err != nil {
 		return "", err
 	}
 
-	encryptedRefreshToken, err := encryptToken(signedRefreshToken)
+	encryptedToken, err := encryptToken(signedToken)
 	if err != nil {
 		return "", err
 	}
 
-	return encryptedRefreshToken, nil
+	return encryptedToken, nil
 }
 
-// AES encryption for tokens
+// AES encryption for tokens, the output is prefixed with the key's kid
 func encryptToken(token string) (string, error) {
+	kid, encryptionKey := keyring.activeEncryptionKey()
+
 	block, err := aes.NewCipher(encryptionKey)
 	if err != nil {
 		return "", err
@@ -105,10 +163,21 @@ func encryptToken(token string) (string, error) {
 	}
 
 	encryptedToken := gcm.Seal(nonce, nonce, []byte(token), nil)
-	return base64.URLEncoding.EncodeToString(encryptedToken), nil
+	return kid + "." + base64.URLEncoding.EncodeToString(encryptedToken), nil
 }
 
 func decryptToken(encryptedToken string) (string, error) {
+	// Tokens without a kid prefix predate the keyring
+	kid := legacyKeyID
+	if separator := strings.LastIndexByte(encryptedToken, '.'); separator >= 0 {
+		kid, encryptedToken = encryptedToken[:separator], encryptedToken[separator+1:]
+	}
+
+	encryptionKey, err := keyring.encryptionKey(kid)
+	if err != nil {
+		return "", err
+	}
+
 	encryptedBytes, err := base64.URLEncoding.DecodeString(encryptedToken)
 	if err != nil {
 		return "", err
@@ -145,27 +214,41 @@ func ValidateToken(encryptedToken string) (jwt.MapClaims, error) {
 	}
 
 	token, err := jwt.Parse(decryptedToken, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = legacyKeyID
+		}
+
+		return keyring.signingKey(kid)
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		return claims, nil
 	}
-	return nil, err
+	return nil, errors.New("invalid token")
 }
 
-func SaveRefreshToken(userUUID string, refreshToken string) error {
+func SaveRefreshToken(userUUID string, refreshToken string, sessionUUID uuid.UUID) error {
 	ID := time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6)
-	expiration := time.Now().Add(time.Hour * 24 * 15)
+	expiration := time.Now().Add(refreshTokenLifetime)
 
 	parsedUUID, parseErr := uuid.Parse(userUUID)
 	if parseErr != nil {
 		return parseErr
 	}
 
+	// Every login starts a new token family named after its session, rotations stay inside it
 	err := repositories.SaveRefreshToken(*db, entity.RefreshToken{
 		ID:           ID,
 		UserUUID:     parsedUUID,
+		FamilyUUID:   sessionUUID,
 		RefreshToken: refreshToken,
 		ExpiredAt:    expiration,
 	})
@@ -178,13 +261,3 @@ func SaveRefreshToken(userUUID string, refreshToken string) error {
 
 	return nil
 }
-
-var InvalidTokens = make(map[string]struct{})
-
-func InvalidateToken(token string) {
-	const bearerPrefix = "Bearer "
-	if len(token) > len(bearerPrefix) && token[:len(bearerPrefix)] == bearerPrefix {
-		token = token[len(bearerPrefix):]
-	}
-	InvalidTokens[token] = struct{}{}
-}
@@ -1,162 +1,743 @@
 package utils
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"sync"
-	// "time"
+	"time"
 
 	"shuttle/logger"
+	"shuttle/models/dto"
+	"shuttle/models/entity"
 	"shuttle/repositories"
+	"shuttle/services"
 
 	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type WebSocketServiceInterface interface {
 	HandleWebSocketConnection(c *websocket.Conn)
+	HandleEventStream(c *fiber.Ctx) error
 }
 
 type WebSocketService struct {
-	userRepository repositories.UserRepositoryInterface
-	authRepository repositories.AuthRepositoryInterface
+	userRepository         repositories.UserRepositoryInterface
+	authRepository         repositories.AuthRepositoryInterface
+	accessPolicyRepository repositories.AccessPolicyRepositoryInterface
+	locationRepository     repositories.LocationRepositoryInterface
+	permissionService      services.PermissionService
 }
 
-func NewWebSocketService(userRepository repositories.UserRepositoryInterface, authRepository repositories.AuthRepositoryInterface) WebSocketServiceInterface {
+func NewWebSocketService(userRepository repositories.UserRepositoryInterface, authRepository repositories.AuthRepositoryInterface, accessPolicyRepository repositories.AccessPolicyRepositoryInterface, locationRepository repositories.LocationRepositoryInterface, permissionService services.PermissionService) WebSocketServiceInterface {
 	return &WebSocketService{
-		userRepository: userRepository,
-		authRepository: authRepository,
+		userRepository:         userRepository,
+		authRepository:         authRepository,
+		accessPolicyRepository: accessPolicyRepository,
+		locationRepository:     locationRepository,
+		permissionService:      permissionService,
 	}
 }
 
 var (
-	activeConnections = make(map[string]*websocket.Conn) // Save active WebSocket connections
-	mutex             = &sync.Mutex{}                    // Ensure atomic operations
+	activeConnections = make(map[string]map[*wsClient]struct{}) // Save active WebSocket connections per session
+	mutex             = &sync.Mutex{}                           // Ensure atomic operations
 )
 
-func AddConnection(ID string, conn *websocket.Conn) {
+func AddConnection(ID string, client *wsClient) {
 	mutex.Lock()
 	defer mutex.Unlock()
-	activeConnections[ID] = conn
+
+	if _, exists := activeConnections[ID]; !exists {
+		activeConnections[ID] = make(map[*wsClient]struct{})
+	}
+	activeConnections[ID][client] = struct{}{}
 }
 
-func RemoveConnection(ID string) {
+func RemoveConnection(ID string, client *wsClient) {
 	mutex.Lock()
 	defer mutex.Unlock()
-	delete(activeConnections, ID)
+
+	if clients, exists := activeConnections[ID]; exists {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(activeConnections, ID)
+		}
+	}
 }
 
-func GetConnection(ID string) (*websocket.Conn, bool) {
+// Closes the realtime connections opened with the session's tokens, on this
+// node and on the others. Other devices of the user stay connected.
+func DisconnectSession(ID string) {
+	closeSessionConnections(ID)
+
+	if err := wsBackplane.Publish(BackplaneEvent{Origin: nodeID, Kind: BackplaneSessionDisconnect, Target: ID}); err != nil {
+		logger.LogError(err, "Failed to publish websocket disconnect", map[string]interface{}{"SessionUUID": ID})
+	}
+}
+
+func closeSessionConnections(ID string) {
 	mutex.Lock()
 	defer mutex.Unlock()
-	conn, exists := activeConnections[ID]
-	return conn, exists
+
+	for client := range activeConnections[ID] {
+		client.close(websocket.CloseNormalClosure, "Logged out", false)
+	}
+	delete(activeConnections, ID)
 }
 
 // Handle WebSocket connection
 var (
-	shuttleGroups = make(map[string]map[string]*websocket.Conn) // Save active WebSocket connections
-	groupMutex    = &sync.Mutex{}                               // Ensure atomic operations
+	shuttleGroups = make(map[string]map[*wsClient]struct{}) // Save active WebSocket connections
+	groupMutex    = &sync.Mutex{}                           // Ensure atomic operations
 )
 
-func AddToShuttleGroup(shuttleUUID, userUUID string, conn *websocket.Conn) {
+func AddToShuttleGroup(shuttleUUID string, client *wsClient) {
 	groupMutex.Lock()
 	defer groupMutex.Unlock()
 
 	if _, exists := shuttleGroups[shuttleUUID]; !exists {
-		shuttleGroups[shuttleUUID] = make(map[string]*websocket.Conn)
+		shuttleGroups[shuttleUUID] = make(map[*wsClient]struct{})
 	}
-	shuttleGroups[shuttleUUID][userUUID] = conn
+	shuttleGroups[shuttleUUID][client] = struct{}{}
 }
 
-func RemoveFromShuttleGroup(shuttleUUID, userUUID string) {
+func RemoveFromShuttleGroup(shuttleUUID string, client *wsClient) {
 	groupMutex.Lock()
 	defer groupMutex.Unlock()
 
 	if group, exists := shuttleGroups[shuttleUUID]; exists {
-		delete(group, userUUID)
+		delete(group, client)
 		if len(group) == 0 {
 			delete(shuttleGroups, shuttleUUID)
 		}
 	}
 }
 
-func BroadcastToShuttleGroup(shuttleUUID string, message []byte) {
+// Pushes a server event such as status_changed or eta_update to everyone
+// following the shuttle
+func PublishRealtimeMessage(shuttleUUID, messageType string, payload interface{}) {
+	message, err := newRealtimeMessage(messageType, uuid.New().String(), payload)
+	if err != nil {
+		logger.LogError(err, "Failed to encode realtime message", map[string]interface{}{"ShuttleUUID": shuttleUUID, "Type": messageType})
+		return
+	}
+	PublishToShuttleGroup(shuttleUUID, messageType, message)
+}
+
+// Sends the message to the group members connected to every node
+func PublishToShuttleGroup(shuttleUUID, messageType string, message []byte) {
+	BroadcastToShuttleGroup(shuttleUUID, messageType, message)
+
+	event := BackplaneEvent{Origin: nodeID, Kind: BackplaneShuttleBroadcast, Target: shuttleUUID, MessageType: messageType, Payload: message}
+	if err := wsBackplane.Publish(event); err != nil {
+		logger.LogError(err, "Failed to publish shuttle broadcast", map[string]interface{}{"ShuttleUUID": shuttleUUID})
+	}
+}
+
+// Only reaches the group members connected to this node. The message is
+// queued on every member, none of them is written to here.
+func BroadcastToShuttleGroup(shuttleUUID, messageType string, message []byte) {
+	frame := wsFrame{message: message}
+	switch messageType {
+	case dto.RealtimeTypeLocation:
+		frame.locationOf = shuttleUUID
+	case dto.RealtimeTypeETAUpdate:
+		// Only the latest ETA matters as well
+		frame.locationOf = "eta:" + shuttleUUID
+	}
+
 	groupMutex.Lock()
 	defer groupMutex.Unlock()
 
-	if group, exists := shuttleGroups[shuttleUUID]; exists {
-		for _, conn := range group {
-			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				logger.LogError(err, "WebSocket Broadcast Error", nil)
+	for client := range shuttleGroups[shuttleUUID] {
+		client.enqueue(frame)
+	}
+}
+
+var (
+	schoolGroups     = make(map[string]map[*wsClient]struct{}) // School admins following the whole fleet
+	schoolGroupMutex = &sync.Mutex{}
+)
+
+func AddToSchoolGroup(schoolUUID string, client *wsClient) {
+	schoolGroupMutex.Lock()
+	defer schoolGroupMutex.Unlock()
+
+	if _, exists := schoolGroups[schoolUUID]; !exists {
+		schoolGroups[schoolUUID] = make(map[*wsClient]struct{})
+	}
+	schoolGroups[schoolUUID][client] = struct{}{}
+}
+
+func RemoveFromSchoolGroup(schoolUUID string, client *wsClient) {
+	schoolGroupMutex.Lock()
+	defer schoolGroupMutex.Unlock()
+
+	if group, exists := schoolGroups[schoolUUID]; exists {
+		delete(group, client)
+		if len(group) == 0 {
+			delete(schoolGroups, schoolUUID)
+		}
+	}
+}
+
+// Pushes a server event to the admins following the school's fleet, messages
+// sharing a non empty locationOf replace each other in the queues
+func PublishSchoolMessage(schoolUUID, messageType, locationOf string, payload interface{}) {
+	message, err := newRealtimeMessage(messageType, uuid.New().String(), payload)
+	if err != nil {
+		logger.LogError(err, "Failed to encode realtime message", map[string]interface{}{"SchoolUUID": schoolUUID, "Type": messageType})
+		return
+	}
+	PublishToSchoolGroup(schoolUUID, messageType, locationOf, message)
+}
+
+func PublishToSchoolGroup(schoolUUID, messageType, locationOf string, message []byte) {
+	BroadcastToSchoolGroup(schoolUUID, locationOf, message)
+
+	event := BackplaneEvent{Origin: nodeID, Kind: BackplaneSchoolBroadcast, Target: schoolUUID, MessageType: messageType, LocationOf: locationOf, Payload: message}
+	if err := wsBackplane.Publish(event); err != nil {
+		logger.LogError(err, "Failed to publish school broadcast", map[string]interface{}{"SchoolUUID": schoolUUID})
+	}
+}
+
+// Only reaches the fleet followers connected to this node
+func BroadcastToSchoolGroup(schoolUUID, locationOf string, message []byte) {
+	frame := wsFrame{message: message, locationOf: locationOf}
+
+	schoolGroupMutex.Lock()
+	defer schoolGroupMutex.Unlock()
+
+	for client := range schoolGroups[schoolUUID] {
+		client.enqueue(frame)
+	}
+}
+
+// Fleet locations are coalesced per driver, a shuttle UUID never collides
+func fleetLocationKey(driverUUID string) string {
+	return "driver:" + driverUUID
+}
+
+var wsBackplane Backplane = &localBackplane{}
+
+// Connects this node to the other instances, until then broadcasts stay local
+func StartWebSocketBackplane() {
+	backplane := NewBackplane(db)
+	if err := backplane.Subscribe(deliverBackplaneEvent); err != nil {
+		logger.LogFatal(err, "Failed to subscribe to the websocket backplane", nil)
+	}
+	wsBackplane = backplane
+}
+
+func deliverBackplaneEvent(event BackplaneEvent) {
+	switch event.Kind {
+	case BackplaneShuttleBroadcast:
+		BroadcastToShuttleGroup(event.Target, event.MessageType, event.Payload)
+
+		switch event.MessageType {
+		case dto.RealtimeTypeLocation:
+			var envelope dto.RealtimeEnvelope
+			var payload dto.RealtimeLocationPayload
+			if json.Unmarshal(event.Payload, &envelope) == nil && json.Unmarshal(envelope.Payload, &payload) == nil {
+				rememberPosition(payload)
 			}
+		case dto.RealtimeTypeETAUpdate:
+			rememberETAMessage(event.Payload)
 		}
+	case BackplaneSchoolBroadcast:
+		BroadcastToSchoolGroup(event.Target, event.LocationOf, event.Payload)
+	case BackplaneSessionDisconnect:
+		closeSessionConnections(event.Target)
+	default:
+		logger.LogWarn("Unknown websocket backplane event", map[string]interface{}{"Kind": event.Kind})
 	}
 }
 
+// A connection may follow several shuttles at once
+const maxShuttleSubscriptions = 20
+
+// The connection has already been authenticated by
+// WebSocketAuthenticationMiddleware, the user comes from the token claims
 func (s *WebSocketService) HandleWebSocketConnection(c *websocket.Conn) {
-	userUUID := c.Params("id")
-	shuttleUUID := c.Query("shuttle_uuid")
+	userUUID, _ := c.Locals("userUUID").(string)
+	sessionUUID, _ := c.Locals("sessionUUID").(string)
+	roleCode, _ := c.Locals("role_code").(string)
+	client := newWSClient(c, userUUID, roleCode)
+	go client.writePump()
 
-	// Validate user access to shuttle group
-	// if !s.userRepository.HasAccessToShuttle(userUUID, shuttleUUID) {
-	// 	c.WriteMessage(websocket.TextMessage, []byte("Unauthorized access to shuttle group"))
-	// 	c.Close()
-	// 	return
-	// }
+	client.extendReadDeadline()
+	c.SetPongHandler(func(string) error {
+		client.extendReadDeadline()
+		return nil
+	})
 
-	AddToShuttleGroup(shuttleUUID, userUUID, c)
+	AddConnection(sessionUUID, client)
+	if roleCode == "D" {
+		markDriverConnected(userUUID)
+	}
 	defer func() {
-		RemoveFromShuttleGroup(shuttleUUID, userUUID)
-		logger.LogInfo("WebSocket Connection Removed from Group", map[string]interface{}{"ShuttleUUID": shuttleUUID, "UserUUID": userUUID})
+		if roleCode == "D" {
+			markDriverDisconnected(userUUID)
+		}
+		leaveGroups(client)
+		RemoveConnection(sessionUUID, client)
+
+		// The connection is released once the handler returns
+		client.close(websocket.CloseNormalClosure, "", false)
+		<-client.writerDone
+
+		logger.LogInfo("WebSocket Connection Closed", map[string]interface{}{"UserUUID": userUUID})
 	}()
 
-	logger.LogInfo("WebSocket Connection Added to Group", map[string]interface{}{"ShuttleUUID": shuttleUUID, "UserUUID": userUUID})
-	c.WriteMessage(websocket.TextMessage, []byte("Connected to shuttle group"))
+	// Older clients join a single shuttle group from the query string
+	if shuttleUUID := c.Query("shuttle_uuid"); shuttleUUID != "" {
+		subscribed, err := s.subscribe(client, []string{shuttleUUID})
+		if err != nil {
+			logger.LogError(err, "Failed to check shuttle group access", map[string]interface{}{"ShuttleUUID": shuttleUUID, "UserUUID": userUUID})
+			closeWithError(client, 500, "Internal Server Error", "Something went wrong, please try again later", websocket.CloseInternalServerErr)
+			return
+		}
+		if len(subscribed) == 0 {
+			logger.LogWarn("WebSocket access to shuttle group denied", map[string]interface{}{"ShuttleUUID": shuttleUUID, "UserUUID": userUUID})
+			closeWithError(client, 403, "Forbidden", "You don't have access to this shuttle group", websocket.ClosePolicyViolation)
+			return
+		}
+	}
+
+	logger.LogInfo("WebSocket Connection Opened", map[string]interface{}{"UserUUID": userUUID})
+	client.send(dto.RealtimeTypeAck, "", dto.RealtimeAckPayload{Type: "connect", Subscribed: subscribedShuttles(client)})
+	sendLastPositions(client, subscribedShuttles(client))
 
 	for {
-		mt, msg, err := c.ReadMessage()
+		_, msg, err := c.ReadMessage()
 		if err != nil {
 			logger.LogError(err, "WebSocket Error Reading Message", nil)
 			break
 		}
+		client.extendReadDeadline()
+
+		s.handleMessage(client, msg)
+	}
+}
+
+func (s *WebSocketService) handleMessage(client *wsClient, msg []byte) {
+	var envelope dto.RealtimeEnvelope
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		client.sendError("", 400, "Bad Request", "Invalid message format, it must be a JSON envelope")
+		return
+	}
+
+	// Before the envelope drivers only sent bare coordinates
+	if envelope.Type == "" {
+		envelope = dto.RealtimeEnvelope{Type: dto.RealtimeTypeLocation, Version: dto.RealtimeProtocolVersion, Payload: msg}
+	}
+
+	if envelope.Version > dto.RealtimeProtocolVersion {
+		client.sendError(envelope.ID, 400, "Bad Request", fmt.Sprintf("Unsupported protocol version, the latest is %d", dto.RealtimeProtocolVersion))
+		return
+	}
+
+	switch envelope.Type {
+	case dto.RealtimeTypeSubscribe:
+		s.handleSubscribe(client, envelope)
+	case dto.RealtimeTypeUnsubscribe:
+		s.handleUnsubscribe(client, envelope)
+	case dto.RealtimeTypeLocation:
+		s.handleLocation(client, envelope)
+	case dto.RealtimeTypeAnnouncement:
+		s.handleAnnouncement(client, envelope)
+	case dto.RealtimeTypePing:
+		client.send(dto.RealtimeTypePong, envelope.ID, struct{}{})
+	default:
+		client.sendError(envelope.ID, 400, "Bad Request", "Unsupported message type '"+envelope.Type+"'")
+	}
+}
+
+func (s *WebSocketService) handleSubscribe(client *wsClient, envelope dto.RealtimeEnvelope) {
+	var payload dto.RealtimeSubscriptionPayload
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil || (len(payload.ShuttleUUIDs) == 0 && !payload.Fleet) {
+		client.sendError(envelope.ID, 400, "Bad Request", "Invalid subscribe payload, it must contain 'shuttle_uuids' or 'fleet'")
+		return
+	}
+
+	// A rejected subscribe leaves the connection as it was
+	if len(client.subscriptions)+len(payload.ShuttleUUIDs) > maxShuttleSubscriptions {
+		client.sendError(envelope.ID, 400, "Bad Request", fmt.Sprintf("A connection can follow at most %d shuttles", maxShuttleSubscriptions))
+		return
+	}
+
+	if payload.Fleet {
+		allowed, err := s.permissionService.HasPermission(client.roleCode, fleetPermission)
+		if err != nil {
+			logger.LogError(err, "Failed to check permission", map[string]interface{}{"role_code": client.roleCode, "permission": fleetPermission})
+			client.sendError(envelope.ID, 500, "Internal Server Error", "Something went wrong, please try again later")
+			return
+		}
+		if !allowed {
+			client.sendError(envelope.ID, 403, "Forbidden", "You don't have permission to follow the school fleet")
+			return
+		}
+		if err := s.subscribeFleet(client); err != nil {
+			logger.LogError(err, "Failed to subscribe to the school fleet", map[string]interface{}{"UserUUID": client.userUUID})
+			client.sendError(envelope.ID, 500, "Internal Server Error", "Something went wrong, please try again later")
+			return
+		}
+	}
+
+	subscribed, err := s.subscribe(client, payload.ShuttleUUIDs)
+	if err != nil {
+		logger.LogError(err, "Failed to check shuttle group access", map[string]interface{}{"UserUUID": client.userUUID})
+		client.sendError(envelope.ID, 500, "Internal Server Error", "Something went wrong, please try again later")
+		return
+	}
 
-		var data struct {
-			Longitude float64 `json:"longitude"`
-			Latitude  float64 `json:"latitude"`
+	var denied []string
+	for _, shuttleUUID := range payload.ShuttleUUIDs {
+		if _, ok := client.subscriptions[shuttleUUID]; !ok {
+			denied = append(denied, shuttleUUID)
 		}
+	}
 
-		if err := json.Unmarshal(msg, &data); err != nil || data.Longitude == 0 || data.Latitude == 0 {
-			errorResponse := struct {
-				Code    int    `json:"code"`
-				Status  string `json:"status"`
-				Message string `json:"message"`
-			}{
-				Code:    400,
-				Status:  "Bad Request",
-				Message: "Invalid message format. Must contain 'longitude' and 'latitude'.",
-			}
-			responseMsg, _ := json.Marshal(errorResponse)
-			c.WriteMessage(websocket.TextMessage, responseMsg)
-			continue
+	client.send(dto.RealtimeTypeAck, envelope.ID, dto.RealtimeAckPayload{Type: envelope.Type, Subscribed: subscribed, Denied: denied, Fleet: client.fleet})
+	sendLastPositions(client, subscribed)
+	if payload.Fleet {
+		s.sendFleetPositions(client)
+	}
+}
+
+func (s *WebSocketService) handleUnsubscribe(client *wsClient, envelope dto.RealtimeEnvelope) {
+	var payload dto.RealtimeSubscriptionPayload
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil || (len(payload.ShuttleUUIDs) == 0 && !payload.Fleet) {
+		client.sendError(envelope.ID, 400, "Bad Request", "Invalid unsubscribe payload, it must contain 'shuttle_uuids' or 'fleet'")
+		return
+	}
+
+	if payload.Fleet && client.fleet != "" {
+		RemoveFromSchoolGroup(client.fleet, client)
+		client.fleet = ""
+	}
+
+	for _, shuttleUUID := range payload.ShuttleUUIDs {
+		if _, ok := client.subscriptions[shuttleUUID]; ok {
+			RemoveFromShuttleGroup(shuttleUUID, client)
+			delete(client.subscriptions, shuttleUUID)
 		}
+	}
+
+	client.send(dto.RealtimeTypeAck, envelope.ID, dto.RealtimeAckPayload{Type: envelope.Type, Subscribed: subscribedShuttles(client), Fleet: client.fleet})
+}
+
+func (s *WebSocketService) handleLocation(client *wsClient, envelope dto.RealtimeEnvelope) {
+	var payload dto.RealtimeLocationPayload
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil || payload.Longitude == 0 || payload.Latitude == 0 {
+		client.sendError(envelope.ID, 400, "Bad Request", "Invalid message format. Must contain 'longitude' and 'latitude'.")
+		return
+	}
+
+	shuttleUUID, ok := drivenShuttle(client, payload.ShuttleUUID)
+	if !ok {
+		client.sendError(envelope.ID, 403, "Forbidden", "Only the driver of this shuttle can broadcast locations")
+		return
+	}
+
+	recordedAt := locationRecordedAt(payload.RecordedAt)
+	latitude, longitude, broadcast, reason := filterGPSPing(client.userUUID, shuttleUUID, gpsPing{
+		latitude:   payload.Latitude,
+		longitude:  payload.Longitude,
+		speed:      payload.Speed,
+		heading:    payload.Heading,
+		accuracy:   payload.Accuracy,
+		mocked:     payload.Mocked,
+		recordedAt: recordedAt,
+	})
+	if reason != "" {
+		client.sendError(envelope.ID, 422, "Unprocessable Entity", "Location rejected: "+reason)
+		return
+	}
 
-		logger.LogInfo("Broadcasting Message", map[string]interface{}{
+	payload.ShuttleUUID = shuttleUUID
+	payload.DriverUUID = client.userUUID
+	payload.Latitude = latitude
+	payload.Longitude = longitude
+	payload.Mocked = false
+	payload.RecordedAt = recordedAt.Format(time.RFC3339)
+	markDriverActive(client.userUUID)
+	updateETAs(client.userUUID, latitude, longitude, recordedAt)
+	checkGeofences(client, latitude, longitude)
+
+	// Pings in between are kept in the history but not sent to parents
+	if broadcast {
+		logger.LogInfo("Broadcasting Location", map[string]interface{}{
 			"ShuttleUUID": shuttleUUID,
-			"UserUUID":    userUUID,
-			"Longitude":   data.Longitude,
-			"Latitude":    data.Latitude,
+			"UserUUID":    client.userUUID,
+			"Longitude":   payload.Longitude,
+			"Latitude":    payload.Latitude,
 		})
-		BroadcastToShuttleGroup(shuttleUUID, msg)
+		PublishRealtimeMessage(shuttleUUID, dto.RealtimeTypeLocation, payload)
+		rememberPosition(payload)
+
+		if schoolUUID := s.driverSchool(client); schoolUUID != "" {
+			PublishSchoolMessage(schoolUUID, dto.RealtimeTypeLocation, fleetLocationKey(client.userUUID), payload)
+		}
+	}
+
+	// The history is best effort, a failed write must not stop the live broadcast
+	location := entity.ShuttleLocation{
+		ID:          time.Now().UnixMilli()*1e6 + int64(uuid.New().ID()%1e6),
+		ShuttleUUID: uuid.MustParse(shuttleUUID),
+		DriverUUID:  uuid.MustParse(client.userUUID),
+		Latitude:    payload.Latitude,
+		Longitude:   payload.Longitude,
+		Speed:       toNullFloat64(payload.Speed),
+		Heading:     toNullFloat64(payload.Heading),
+		RecordedAt:  recordedAt,
+	}
+	if err := s.locationRepository.SaveLocation(location); err != nil {
+		logger.LogError(err, "Failed to save shuttle location", map[string]interface{}{"ShuttleUUID": shuttleUUID, "UserUUID": client.userUUID})
+	}
+
+	client.send(dto.RealtimeTypeAck, envelope.ID, dto.RealtimeAckPayload{Type: envelope.Type})
+}
+
+// Drivers tell the parents following the shuttle about delays and the like
+func (s *WebSocketService) handleAnnouncement(client *wsClient, envelope dto.RealtimeEnvelope) {
+	var payload dto.RealtimeAnnouncementPayload
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		client.sendError(envelope.ID, 400, "Bad Request", "Invalid announcement payload")
+		return
+	}
+
+	payload.Message = strings.TrimSpace(payload.Message)
+	if payload.Message == "" || len([]rune(payload.Message)) > 500 {
+		client.sendError(envelope.ID, 400, "Bad Request", "Announcement message is required and can't be longer than 500 characters")
+		return
+	}
+
+	shuttleUUID, ok := drivenShuttle(client, payload.ShuttleUUID)
+	if !ok {
+		client.sendError(envelope.ID, 403, "Forbidden", "Only the driver of this shuttle can send announcements")
+		return
+	}
+
+	payload.ShuttleUUID = shuttleUUID
+	payload.SenderUUID = client.userUUID
+	payload.SentAt = time.Now().Format(time.RFC3339)
+	PublishRealtimeMessage(shuttleUUID, dto.RealtimeTypeAnnouncement, payload)
+
+	client.send(dto.RealtimeTypeAck, envelope.ID, dto.RealtimeAckPayload{Type: envelope.Type})
+}
+
+// Joins the groups the user may follow and returns them, the others are skipped
+func (s *WebSocketService) subscribe(client *wsClient, shuttleUUIDs []string) ([]string, error) {
+	var subscribed []string
+	for _, shuttleUUID := range shuttleUUIDs {
+		if _, ok := client.subscriptions[shuttleUUID]; ok {
+			subscribed = append(subscribed, shuttleUUID)
+			continue
+		}
+
+		// Only the driver of the shuttle, a parent of its student or an admin of
+		// its school may join the group, and only the driver may publish to it
+		isMember, isDriver, err := s.checkShuttleGroupAccess(shuttleUUID, client.userUUID)
+		if err != nil {
+			return nil, err
+		}
+		if !isMember {
+			continue
+		}
+
+		client.subscriptions[shuttleUUID] = isDriver
+		AddToShuttleGroup(shuttleUUID, client)
+		subscribed = append(subscribed, shuttleUUID)
+	}
+
+	return subscribed, nil
+}
+
+// Websocket and event stream clients share the groups, both leave them the same way
+func leaveGroups(client *wsClient) {
+	for shuttleUUID := range client.subscriptions {
+		RemoveFromShuttleGroup(shuttleUUID, client)
+	}
+	if client.fleet != "" {
+		RemoveFromSchoolGroup(client.fleet, client)
+	}
+}
+
+// School admins follow the fleet of the school they administer
+// The same permission guards GET /api/school/fleet
+const fleetPermission = "school:fleet:read"
+
+func (s *WebSocketService) subscribeFleet(client *wsClient) error {
+	schoolUUID, err := s.userRepository.FetchPermittedSchoolAccess(client.userUUID)
+	if err != nil {
+		return err
+	}
+
+	if client.fleet != "" && client.fleet != schoolUUID {
+		RemoveFromSchoolGroup(client.fleet, client)
+	}
+	client.fleet = schoolUUID
+	AddToSchoolGroup(schoolUUID, client)
+	return nil
+}
+
+// Where every driver of the school was last seen within the past day
+func (s *WebSocketService) sendFleetPositions(client *wsClient) {
+	schoolUUID, err := uuid.Parse(client.fleet)
+	if err != nil {
+		return
+	}
+
+	locations, err := s.locationRepository.FetchSchoolLastLocations(schoolUUID, time.Now().Add(-positionMaxAge))
+	if err != nil {
+		logger.LogError(err, "Failed to fetch the school fleet positions", map[string]interface{}{"SchoolUUID": client.fleet})
+		return
+	}
+
+	for _, location := range locations {
+		age := int64(time.Since(location.RecordedAt).Seconds())
+		position := dto.RealtimeLocationPayload{
+			ShuttleUUID: location.ShuttleUUID.String(),
+			DriverUUID:  location.DriverUUID.String(),
+			Latitude:    location.Latitude,
+			Longitude:   location.Longitude,
+			RecordedAt:  location.RecordedAt.Format(time.RFC3339),
+			AgeSeconds:  &age,
+			Snapshot:    true,
+		}
+		if location.Speed.Valid {
+			position.Speed = &location.Speed.Float64
+		}
+		if location.Heading.Valid {
+			position.Heading = &location.Heading.Float64
+		}
+
+		message, err := newRealtimeMessage(dto.RealtimeTypeLocation, uuid.New().String(), position)
+		if err != nil {
+			logger.LogError(err, "Failed to encode realtime message", map[string]interface{}{"SchoolUUID": client.fleet})
+			continue
+		}
+		client.enqueue(wsFrame{message: message, locationOf: fleetLocationKey(position.DriverUUID)})
+	}
+}
+
+// The school a driver's locations are also sent to, looked up once per
+// connection, empty when the driver doesn't belong to one
+func (s *WebSocketService) driverSchool(client *wsClient) string {
+	if client.driverSchool != nil {
+		return *client.driverSchool
+	}
+
+	parsedUserUUID, err := uuid.Parse(client.userUUID)
+	if err != nil {
+		return ""
+	}
+
+	schoolUUID, err := s.locationRepository.FetchDriverSchoolUUID(parsedUserUUID)
+	if err != nil {
+		logger.LogError(err, "Failed to fetch the driver's school", map[string]interface{}{"UserUUID": client.userUUID})
+		return ""
+	}
+	client.driverSchool = &schoolUUID
+	return schoolUUID
+}
+
+// Late joiners get where the bus was last seen and how long ago right away
+func sendLastPositions(client *wsClient, shuttleUUIDs []string) {
+	for _, shuttleUUID := range shuttleUUIDs {
+		position, ok := LastKnownPosition(shuttleUUID)
+		if !ok {
+			continue
+		}
+
+		message, err := newRealtimeMessage(dto.RealtimeTypeLocation, uuid.New().String(), position)
+		if err != nil {
+			logger.LogError(err, "Failed to encode realtime message", map[string]interface{}{"ShuttleUUID": shuttleUUID})
+			continue
+		}
+		client.enqueue(wsFrame{message: message, locationOf: shuttleUUID})
+	}
+}
+
+// The shuttle a driver publishes to, it may be left out when the connection
+// drives a single shuttle
+func drivenShuttle(client *wsClient, shuttleUUID string) (string, bool) {
+	if shuttleUUID != "" {
+		return shuttleUUID, client.subscriptions[shuttleUUID]
+	}
 
-		response := struct {
-			Code    int    `json:"code"`
-			Status  string `json:"status"`
-			Message string `json:"message"`
-		}{
-			Code:    200,
-			Status:  "OK",
-			Message: "Message broadcasted to shuttle group",
+	var driven []string
+	for subscribedUUID, isDriver := range client.subscriptions {
+		if isDriver {
+			driven = append(driven, subscribedUUID)
 		}
-		responseMsg, _ := json.Marshal(response)
-		c.WriteMessage(mt, responseMsg)
 	}
-}
\ No newline at end of file
+	if len(driven) != 1 {
+		return "", false
+	}
+	return driven[0], true
+}
+
+func subscribedShuttles(client *wsClient) []string {
+	shuttleUUIDs := make([]string, 0, len(client.subscriptions))
+	for shuttleUUID := range client.subscriptions {
+		shuttleUUIDs = append(shuttleUUIDs, shuttleUUID)
+	}
+	return shuttleUUIDs
+}
+
+func (s *WebSocketService) checkShuttleGroupAccess(shuttleUUID, userUUID string) (bool, bool, error) {
+	if _, err := uuid.Parse(shuttleUUID); err != nil || userUUID == "" {
+		return false, false, nil
+	}
+
+	isMember, err := s.accessPolicyRepository.CheckOwnership(entity.PolicyShuttleMember, shuttleUUID, userUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	if !isMember {
+		return false, false, nil
+	}
+
+	isDriver, err := s.accessPolicyRepository.CheckOwnership(entity.PolicyShuttleDriver, shuttleUUID, userUUID)
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, isDriver, nil
+}
+
+// Drivers may buffer pings while offline and send them later with the time
+// they were taken. Anything too old or from the future falls back to now.
+func locationRecordedAt(value string) time.Time {
+	now := time.Now()
+	if value == "" {
+		return now
+	}
+
+	recordedAt, err := time.Parse(time.RFC3339, value)
+	if err != nil || recordedAt.After(now.Add(time.Minute)) || recordedAt.Before(now.Add(-24*time.Hour)) {
+		return now
+	}
+	return recordedAt
+}
+
+func toNullFloat64(value *float64) sql.NullFloat64 {
+	if value == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *value, Valid: true}
+}
+
+func closeWithError(client *wsClient, code int, status, message string, closeCode int) {
+	client.sendError("", code, status, message)
+	client.close(closeCode, message, true)
+}
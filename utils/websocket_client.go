@@ -0,0 +1,321 @@
+package utils
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shuttle/logger"
+	"shuttle/models/dto"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/spf13/viper"
+)
+
+// One websocket connection, or event stream when conn is nil, subscribed to
+// any number of shuttle groups. Broadcasts only append to its bounded queue, a
+// writer goroutine of its own drains it, so a slow phone never holds up the
+// other members of a group.
+//
+// When the queue is full the client is a slow consumer: a queued location of
+// the same shuttle is replaced since only the latest position matters, then
+// the oldest queued location is dropped, and when only other messages are
+// waiting the client is disconnected rather than silently losing them.
+type wsClient struct {
+	conn     *websocket.Conn
+	userUUID string
+	roleCode string
+
+	// Shuttle UUID to whether the client drives it, only touched by the
+	// goroutine reading the connection
+	subscriptions map[string]bool
+	// School whose fleet the client follows, and for drivers the school their
+	// locations are also sent to, looked up on the first ping
+	fleet        string
+	driverSchool *string
+
+	queueMutex sync.Mutex
+	queue      []wsFrame
+	closing    bool
+	flush      bool
+	closeCode  int
+	closeText  string
+
+	wake       chan struct{}
+	done       chan struct{}
+	writerDone chan struct{}
+	closeOnce  sync.Once
+}
+
+type wsFrame struct {
+	message []byte
+	// Set for location frames, a newer one of the same shuttle, or of the same
+	// driver on the fleet channel, replaces it
+	locationOf string
+}
+
+func newWSClient(conn *websocket.Conn, userUUID, roleCode string) *wsClient {
+	return &wsClient{
+		conn:          conn,
+		userUUID:      userUUID,
+		roleCode:      roleCode,
+		subscriptions: make(map[string]bool),
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		writerDone:    make(chan struct{}),
+	}
+}
+
+// Counters since start, exposed through WebSocketMetrics
+var (
+	wsFramesSent        atomic.Int64
+	wsFramesCoalesced   atomic.Int64
+	wsFramesDropped     atomic.Int64
+	wsSlowConsumerKicks atomic.Int64
+	wsWriteErrors       atomic.Int64
+)
+
+func wsSendQueueSize() int {
+	if size := viper.GetInt("WS_SEND_QUEUE_SIZE"); size > 0 {
+		return size
+	}
+	return 64
+}
+
+// Pings keep idle connections alive through proxies, a client that neither
+// answers them nor sends anything within WS_PONG_TIMEOUT is considered dead
+func wsPingInterval() time.Duration {
+	if interval := viper.GetDuration("WS_PING_INTERVAL"); interval > 0 {
+		return interval
+	}
+	return 25 * time.Second
+}
+
+func wsPongTimeout() time.Duration {
+	if timeout := viper.GetDuration("WS_PONG_TIMEOUT"); timeout > 0 {
+		return timeout
+	}
+	return 60 * time.Second
+}
+
+// Called on every read and pong
+func (client *wsClient) extendReadDeadline() {
+	client.conn.SetReadDeadline(time.Now().Add(wsPongTimeout()))
+}
+
+func wsWriteTimeout() time.Duration {
+	if timeout := viper.GetDuration("WS_WRITE_TIMEOUT"); timeout > 0 {
+		return timeout
+	}
+	return 10 * time.Second
+}
+
+// Never blocks, see the slow consumer policy on wsClient
+func (client *wsClient) enqueue(frame wsFrame) {
+	client.queueMutex.Lock()
+	defer client.queueMutex.Unlock()
+
+	if client.closing {
+		return
+	}
+
+	if frame.locationOf != "" {
+		for i := range client.queue {
+			if client.queue[i].locationOf == frame.locationOf {
+				client.queue[i] = frame
+				wsFramesCoalesced.Add(1)
+				return
+			}
+		}
+	}
+
+	if len(client.queue) >= wsSendQueueSize() {
+		stale := -1
+		for i := range client.queue {
+			if client.queue[i].locationOf != "" {
+				stale = i
+				break
+			}
+		}
+
+		switch {
+		case stale >= 0:
+			client.queue = append(client.queue[:stale], client.queue[stale+1:]...)
+			wsFramesDropped.Add(1)
+		case frame.locationOf != "":
+			wsFramesDropped.Add(1)
+			return
+		default:
+			wsFramesDropped.Add(int64(len(client.queue)) + 1)
+			wsSlowConsumerKicks.Add(1)
+			logger.LogWarn("Disconnecting slow websocket consumer", map[string]interface{}{"UserUUID": client.userUUID, "QueueDepth": len(client.queue)})
+			client.closeLocked(websocket.ClosePolicyViolation, "Slow consumer", false)
+			return
+		}
+	}
+
+	client.queue = append(client.queue, frame)
+
+	select {
+	case client.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (client *wsClient) dequeue() (wsFrame, bool) {
+	client.queueMutex.Lock()
+	defer client.queueMutex.Unlock()
+
+	if len(client.queue) == 0 {
+		return wsFrame{}, false
+	}
+	frame := client.queue[0]
+	client.queue[0] = wsFrame{}
+	client.queue = client.queue[1:]
+	return frame, true
+}
+
+func (client *wsClient) queueDepth() int {
+	client.queueMutex.Lock()
+	defer client.queueMutex.Unlock()
+	return len(client.queue)
+}
+
+// Asks the writer to send a close frame and end the connection. With flush
+// the frames already queued, such as a final error, are written first.
+func (client *wsClient) close(closeCode int, closeText string, flush bool) {
+	client.queueMutex.Lock()
+	defer client.queueMutex.Unlock()
+	client.closeLocked(closeCode, closeText, flush)
+}
+
+func (client *wsClient) closeLocked(closeCode int, closeText string, flush bool) {
+	client.closeOnce.Do(func() {
+		client.closing = true
+		client.flush = flush
+		client.closeCode = closeCode
+		client.closeText = closeText
+		close(client.done)
+	})
+}
+
+// The only goroutine writing to the connection
+func (client *wsClient) writePump() {
+	defer close(client.writerDone)
+	// Unblocks the reader whichever way the writer stops
+	defer client.conn.Close()
+
+	pingTicker := time.NewTicker(wsPingInterval())
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case <-pingTicker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout()))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				wsWriteErrors.Add(1)
+				client.close(websocket.CloseGoingAway, "", false)
+				return
+			}
+		case <-client.wake:
+			if !client.writeQueued() {
+				client.close(websocket.CloseGoingAway, "", false)
+				return
+			}
+		case <-client.done:
+			client.queueMutex.Lock()
+			flush, closeCode, closeText := client.flush, client.closeCode, client.closeText
+			client.queueMutex.Unlock()
+
+			if flush {
+				client.writeQueued()
+			}
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout()))
+			client.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, closeText))
+			return
+		}
+	}
+}
+
+// Returns false once the connection can't be written to anymore
+func (client *wsClient) writeQueued() bool {
+	for {
+		frame, ok := client.dequeue()
+		if !ok {
+			return true
+		}
+
+		client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout()))
+		if err := client.conn.WriteMessage(websocket.TextMessage, frame.message); err != nil {
+			wsWriteErrors.Add(1)
+			logger.LogError(err, "WebSocket Write Error", map[string]interface{}{"UserUUID": client.userUUID})
+			return false
+		}
+		wsFramesSent.Add(1)
+	}
+}
+
+func (client *wsClient) send(messageType, id string, payload interface{}) {
+	message, err := newRealtimeMessage(messageType, id, payload)
+	if err != nil {
+		logger.LogError(err, "Failed to encode realtime message", map[string]interface{}{"Type": messageType})
+		return
+	}
+	client.enqueue(wsFrame{message: message})
+}
+
+func (client *wsClient) sendError(id string, code int, status, message string) {
+	client.send(dto.RealtimeTypeError, id, dto.RealtimeErrorPayload{Code: code, Status: status, Message: message})
+}
+
+func newRealtimeMessage(messageType, id string, payload interface{}) ([]byte, error) {
+	encodedPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(dto.RealtimeEnvelope{
+		Type:    messageType,
+		Version: dto.RealtimeProtocolVersion,
+		ID:      id,
+		Payload: encodedPayload,
+	})
+}
+
+// Snapshot of the websocket connections held by this node
+func WebSocketMetrics() dto.RealtimeMetricsDTO {
+	metrics := dto.RealtimeMetricsDTO{
+		NodeID:            nodeID,
+		QueueCapacity:     wsSendQueueSize(),
+		FramesSent:        wsFramesSent.Load(),
+		FramesCoalesced:   wsFramesCoalesced.Load(),
+		FramesDropped:     wsFramesDropped.Load(),
+		SlowConsumerKicks: wsSlowConsumerKicks.Load(),
+		WriteErrors:       wsWriteErrors.Load(),
+		PingsRejected:     wsPingsRejected.Load(),
+	}
+
+	mutex.Lock()
+	for _, clients := range activeConnections {
+		for client := range clients {
+			depth := client.queueDepth()
+			metrics.Connections++
+			metrics.QueuedFrames += depth
+			if depth > metrics.MaxQueueDepth {
+				metrics.MaxQueueDepth = depth
+			}
+		}
+	}
+	mutex.Unlock()
+
+	groupMutex.Lock()
+	metrics.ShuttleGroups = len(shuttleGroups)
+	groupMutex.Unlock()
+
+	schoolGroupMutex.Lock()
+	metrics.SchoolGroups = len(schoolGroups)
+	schoolGroupMutex.Unlock()
+
+	return metrics
+}